@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS preferred_locale;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS preferred_locale varchar(16) NOT NULL DEFAULT 'en';
\ No newline at end of file
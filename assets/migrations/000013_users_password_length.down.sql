@@ -0,0 +1,2 @@
+-- Fails if any stored hash is longer than 64 characters, rather than truncating it.
+ALTER TABLE users ALTER COLUMN password TYPE varchar(64);
\ No newline at end of file
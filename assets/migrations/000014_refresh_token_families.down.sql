@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS family_id,
+    DROP COLUMN IF EXISTS token_id;
\ No newline at end of file
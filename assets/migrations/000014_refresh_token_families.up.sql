@@ -0,0 +1,10 @@
+-- Refresh tokens issued before rotation was introduced carry no family and cannot be
+-- rotated, so they are discarded.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS token_id uuid NOT NULL,
+    ADD COLUMN IF NOT EXISTS family_id uuid NOT NULL,
+    ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
\ No newline at end of file
@@ -0,0 +1,6 @@
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_family_id_fkey;
+ALTER TABLE refresh_tokens RENAME COLUMN hash TO token;
+
+DROP TABLE IF EXISTS sessions;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id uuid PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    user_agent text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+-- Existing refresh tokens are stored in plaintext and belong to no session, so they
+-- are discarded. From now on only the SHA-256 hash of a refresh token is stored, and
+-- every token family is a session.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens RENAME COLUMN token TO hash;
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_id_fkey
+    FOREIGN KEY (family_id) REFERENCES sessions (session_id) ON DELETE CASCADE;
\ No newline at end of file
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS oidc_states;
+DROP TABLE IF EXISTS user_identities;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'iss_type') THEN
+        CREATE TYPE iss_type AS ENUM('google');
+    END IF;
+END$$;
+
+UPDATE users SET iss = NULL, sub = NULL WHERE iss IS DISTINCT FROM 'google';
+ALTER TABLE users ALTER COLUMN iss TYPE iss_type USING iss::iss_type;
\ No newline at end of file
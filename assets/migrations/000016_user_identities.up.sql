@@ -0,0 +1,29 @@
+-- users.iss only knew about Google; any configured provider can now sign users up.
+ALTER TABLE users ALTER COLUMN iss TYPE varchar(64) USING iss::text;
+DROP TYPE IF EXISTS iss_type;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    email varchar(255) NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+-- Carry over the Google accounts recorded in users.iss/users.sub.
+INSERT INTO user_identities (provider, subject, user_id, email)
+SELECT iss, sub, user_id, email
+FROM users
+WHERE iss IS NOT NULL AND sub IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+    hash bytea PRIMARY KEY,
+    provider varchar(64) NOT NULL,
+    code_verifier text NOT NULL,
+    nonce text NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- A state issued to a logged-in user links the provider account to that user
+-- instead of signing in with it.
+ALTER TABLE oidc_states ADD COLUMN IF NOT EXISTS user_id varchar(255) REFERENCES users ON DELETE CASCADE;
\ No newline at end of file
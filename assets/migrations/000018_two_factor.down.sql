@@ -0,0 +1,5 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS stepped_up_at;
+DROP TABLE IF EXISTS remembered_devices;
+DROP TABLE IF EXISTS two_factor_tokens;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
\ No newline at end of file
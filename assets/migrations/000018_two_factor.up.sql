@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id varchar(255) PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret text NOT NULL,
+    confirmed_at timestamp(0) with time zone,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    hash bytea PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- Issued after the password check of a login that still needs a second factor.
+CREATE TABLE IF NOT EXISTS two_factor_tokens (
+    hash bytea PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    attempts integer NOT NULL DEFAULT 0,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS remembered_devices (
+    hash bytea PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS stepped_up_at timestamp(0) with time zone;
\ No newline at end of file
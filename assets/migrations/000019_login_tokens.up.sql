@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_tokens (
+    hash bytea PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    passcode text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    expiry timestamp(0) with time zone NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE activation_tokens DROP COLUMN IF EXISTS attempts;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS auth_attempts;
\ No newline at end of file
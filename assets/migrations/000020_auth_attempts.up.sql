@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS auth_attempts (
+    scope varchar(64) NOT NULL,
+    key text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    window_start timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id bigserial PRIMARY KEY,
+    user_id varchar(255) REFERENCES users ON DELETE SET NULL,
+    event varchar(64) NOT NULL,
+    ip text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT '',
+    metadata jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, created_at);
+
+ALTER TABLE activation_tokens ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS email_change_tokens (
+    hash bytea PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    new_email varchar(255) NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
\ No newline at end of file
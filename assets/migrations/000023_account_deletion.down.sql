@@ -0,0 +1,18 @@
+DELETE FROM user_to_results WHERE user_id IS NULL;
+ALTER TABLE user_to_results DROP CONSTRAINT IF EXISTS user_to_results_user_id_fkey;
+ALTER TABLE user_to_results
+    ADD CONSTRAINT user_to_results_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE;
+ALTER TABLE user_to_results DROP CONSTRAINT IF EXISTS user_to_results_user_id_school_name_major_name_key;
+ALTER TABLE user_to_results ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE user_to_results ADD PRIMARY KEY (user_id, school_name, major_name);
+
+DELETE FROM posts WHERE user_id IS NULL;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_user_id_fkey;
+ALTER TABLE posts
+    ADD CONSTRAINT posts_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE;
+ALTER TABLE posts ALTER COLUMN user_id SET NOT NULL;
+
+DROP INDEX IF EXISTS users_deletion_scheduled_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
\ No newline at end of file
@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_deletion_scheduled_at_idx ON users (deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Posts and results outlive the account that wrote them, without saying whose they
+-- were.
+ALTER TABLE posts ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_user_id_fkey;
+ALTER TABLE posts
+    ADD CONSTRAINT posts_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE SET NULL;
+
+ALTER TABLE user_to_results DROP CONSTRAINT IF EXISTS user_to_results_pkey;
+ALTER TABLE user_to_results ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE user_to_results
+    ADD CONSTRAINT user_to_results_user_id_school_name_major_name_key
+    UNIQUE (user_id, school_name, major_name);
+ALTER TABLE user_to_results DROP CONSTRAINT IF EXISTS user_to_results_user_id_fkey;
+ALTER TABLE user_to_results
+    ADD CONSTRAINT user_to_results_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE SET NULL;
\ No newline at end of file
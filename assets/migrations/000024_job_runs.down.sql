@@ -0,0 +1 @@
+DROP TABLE IF EXISTS job_runs;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id bigserial PRIMARY KEY,
+    job varchar(64) NOT NULL,
+    scheduled_at timestamp(0) with time zone NOT NULL,
+    instance text NOT NULL DEFAULT '',
+    status varchar(16) NOT NULL DEFAULT 'running',
+    error text NOT NULL DEFAULT '',
+    started_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone,
+    UNIQUE (job, scheduled_at)
+);
+
+CREATE INDEX IF NOT EXISTS job_runs_started_at_idx ON job_runs (started_at);
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO permissions (code)
+SELECT 'admin'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'admin');
\ No newline at end of file
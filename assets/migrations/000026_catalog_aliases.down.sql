@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS user_to_results_major_id_idx;
+DROP INDEX IF EXISTS user_to_results_school_id_idx;
+ALTER TABLE user_to_results DROP COLUMN IF EXISTS major_id, DROP COLUMN IF EXISTS school_id;
+
+DROP INDEX IF EXISTS majors_school_id_lower_major_name_idx;
+DROP INDEX IF EXISTS schools_lower_school_name_idx;
+DROP INDEX IF EXISTS majors_major_name_trgm_idx;
+DROP INDEX IF EXISTS schools_school_name_trgm_idx;
+
+DROP TABLE IF EXISTS major_aliases;
+DROP TABLE IF EXISTS school_aliases;
\ No newline at end of file
@@ -0,0 +1,57 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Other names users know catalog entries by, like "UCB" for a school. normalized
+-- holds the key the API matches names by.
+CREATE TABLE IF NOT EXISTS school_aliases (
+    alias_id bigserial PRIMARY KEY,
+    school_id uuid NOT NULL REFERENCES schools (school_id) ON DELETE CASCADE,
+    alias varchar(255) NOT NULL,
+    normalized varchar(255) NOT NULL UNIQUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS major_aliases (
+    alias_id bigserial PRIMARY KEY,
+    major_id uuid NOT NULL REFERENCES majors (major_id) ON DELETE CASCADE,
+    alias varchar(255) NOT NULL,
+    normalized varchar(255) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (major_id, normalized)
+);
+
+CREATE INDEX IF NOT EXISTS school_aliases_school_id_idx ON school_aliases (school_id);
+CREATE INDEX IF NOT EXISTS major_aliases_normalized_idx ON major_aliases (normalized);
+
+CREATE INDEX IF NOT EXISTS schools_school_name_trgm_idx ON schools USING gin (school_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS majors_major_name_trgm_idx ON majors USING gin (major_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS school_aliases_alias_trgm_idx ON school_aliases USING gin (alias gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS major_aliases_alias_trgm_idx ON major_aliases USING gin (alias gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS schools_lower_school_name_idx ON schools (lower(school_name));
+CREATE INDEX IF NOT EXISTS majors_school_id_lower_major_name_idx ON majors (school_id, lower(major_name));
+
+-- Results point at the catalog entries they were resolved to, so that merging
+-- entries can move them along.
+ALTER TABLE user_to_results
+    ADD COLUMN IF NOT EXISTS school_id uuid REFERENCES schools (school_id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS major_id uuid REFERENCES majors (major_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS user_to_results_school_id_idx ON user_to_results (school_id);
+CREATE INDEX IF NOT EXISTS user_to_results_major_id_idx ON user_to_results (major_id);
+
+UPDATE user_to_results
+SET school_id = (
+    SELECT school_id FROM schools
+    WHERE lower(schools.school_name) = lower(user_to_results.school_name)
+    ORDER BY school_id LIMIT 1
+)
+WHERE school_id IS NULL;
+
+UPDATE user_to_results
+SET major_id = (
+    SELECT major_id FROM majors
+    WHERE majors.school_id = user_to_results.school_id
+    AND lower(majors.major_name) = lower(user_to_results.major_name)
+    ORDER BY major_id LIMIT 1
+)
+WHERE major_id IS NULL AND school_id IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS applicant_profiles;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- What an applicant brings to their applications. GPAs are kept on the scale the
+-- applicant reported them in.
+CREATE TABLE IF NOT EXISTS applicant_profiles (
+    user_id varchar(255) PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    gpa numeric(5,2) CHECK (gpa >= 0),
+    gpa_scale numeric(5,2) CHECK (gpa_scale > 0),
+    gre_verbal smallint CHECK (gre_verbal BETWEEN 130 AND 170),
+    gre_quant smallint CHECK (gre_quant BETWEEN 130 AND 170),
+    gre_writing numeric(2,1) CHECK (gre_writing BETWEEN 0 AND 6),
+    toefl smallint CHECK (toefl BETWEEN 0 AND 120),
+    ielts numeric(2,1) CHECK (ielts BETWEEN 0 AND 9),
+    undergrad_school_id uuid REFERENCES schools (school_id) ON DELETE SET NULL,
+    undergrad_school varchar(255),
+    undergrad_major varchar(255),
+    graduation_year smallint,
+    country char(2),
+    work_experience_months smallint CHECK (work_experience_months >= 0),
+    publications smallint CHECK (publications >= 0),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (gpa IS NULL OR (gpa_scale IS NOT NULL AND gpa <= gpa_scale))
+);
+
+CREATE INDEX IF NOT EXISTS applicant_profiles_undergrad_school_id_idx ON applicant_profiles (undergrad_school_id);
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code = 'results:export';
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO permissions (code)
+SELECT 'results:export'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'results:export');
\ No newline at end of file
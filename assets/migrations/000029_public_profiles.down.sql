@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS applicant_profiles_public_idx;
+ALTER TABLE applicant_profiles DROP COLUMN IF EXISTS public;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Applicants can list their profile publicly, next to their username, so that others
+-- with similar backgrounds can find them.
+ALTER TABLE applicant_profiles ADD COLUMN IF NOT EXISTS public bool NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS applicant_profiles_public_idx ON applicant_profiles (updated_at DESC) WHERE public;
\ No newline at end of file
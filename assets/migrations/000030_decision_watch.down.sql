@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS program_watches;
+DROP INDEX IF EXISTS user_to_results_reported_at_idx;
+ALTER TABLE user_to_results DROP COLUMN IF EXISTS reported_at;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- When a result was reported, as opposed to when its decision was announced. Results
+-- reported before this column existed count as reported on their announcement date.
+ALTER TABLE user_to_results ADD COLUMN IF NOT EXISTS reported_at timestamp(0) with time zone;
+UPDATE user_to_results SET reported_at = announce_date WHERE reported_at IS NULL;
+ALTER TABLE user_to_results ALTER COLUMN reported_at SET DEFAULT NOW();
+ALTER TABLE user_to_results ALTER COLUMN reported_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS user_to_results_reported_at_idx ON user_to_results (reported_at);
+
+-- Programs users want to hear about when the first decision of a cycle is reported.
+-- notified_cycle is the last cycle they were told about.
+CREATE TABLE IF NOT EXISTS program_watches (
+    watch_id bigserial PRIMARY KEY,
+    user_id varchar(255) NOT NULL REFERENCES users ON DELETE CASCADE,
+    school_id uuid REFERENCES schools (school_id) ON DELETE SET NULL,
+    school_name varchar(255) NOT NULL,
+    major_id uuid REFERENCES majors (major_id) ON DELETE SET NULL,
+    major_name varchar(255) NOT NULL,
+    notified_cycle integer,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, school_name, major_name)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at timestamp(0) with time zone;
\ No newline at end of file
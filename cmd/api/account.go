@@ -0,0 +1,270 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/password"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+// changePassword replaces the password of the user, who has to know the current one.
+// Every other session is signed out.
+func (app *application) changePassword(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		CurrentPassword string              `json:"current_password"`
+		Password        string              `json:"password"`
+		Validator       validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	if user.Password == "" {
+		app.passwordNotSet(c.Writer, c.Request)
+		return
+	}
+
+	input.Validator.CheckField(input.CurrentPassword != "", "current_password", "Current password is required")
+	input.Validator.CheckField(len(input.Password) >= 8, "password", "Password is too short, must be at least 8 characters")
+	input.Validator.CheckField(len(input.Password) <= 72, "password", "Password is too long, must be at most 72 characters")
+	input.Validator.CheckField(validator.NotIn(input.Password, password.CommonPasswords...), "password", "Password is too common")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	accountKey := stepUpAccountKey(user.ID)
+	if app.throttled(c, accountKey) {
+		return
+	}
+
+	matches, err := password.Matches(input.CurrentPassword, user.Password)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	if !matches {
+		app.recordFailure(c, user.ID, accountKey)
+		input.Validator.AddFieldError("current_password", "Current password is incorrect")
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+	app.resetAttempts(accountKey)
+
+	user.Password, err = password.Hash(input.Password)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflict(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	sessionID, ok := app.contextGetSession(c.Request)
+	if ok {
+		err = app.models.Sessions.DeleteOthersForUser(user.ID, sessionID)
+	} else {
+		err = app.models.Sessions.DeleteAllForUser(user.ID)
+	}
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteResetTokensForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.audit(c, user.ID, "password.changed", nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// deleteAccount schedules the account of the user for deletion once the grace period
+// has passed, and signs out all of its sessions. Signing in again before then cancels
+// the deletion. Posts and results are kept, but no longer belong to anyone.
+func (app *application) deleteAccount(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	deleteAt := time.Now().Add(app.deletionGracePeriod)
+
+	err := app.models.Users.ScheduleDeletion(user.ID, deleteAt)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.Sessions.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.audit(c, user.ID, "account.deletion_scheduled", map[string]any{"delete_at": deleteAt})
+
+	app.clearRefreshTokenCookie(c.Writer)
+
+	err = response.JSON(c.Writer, http.StatusAccepted, envelope{"deletion_scheduled_at": deleteAt})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// An accountExport holds everything we store about a user that they can take with
+// them.
+type accountExport struct {
+	Profile          accountProfile           `json:"profile"`
+	ApplicantProfile *models.ApplicantProfile `json:"applicant_profile"`
+	Identities       []*models.Identity       `json:"identities"`
+	Posts            []models.Post            `json:"posts"`
+	Results          []models.Result          `json:"results"`
+	Sessions         []*models.Session        `json:"sessions"`
+	Watches          []*models.Watch          `json:"watches"`
+}
+
+// accountProfile is the user record including the fields that are hidden from other
+// users.
+type accountProfile struct {
+	ID                  string     `json:"user_id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email"`
+	Activated           bool       `json:"activated"`
+	Locale              string     `json:"preferred_locale"`
+	HasPassword         bool       `json:"has_password"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// exportAccount lets the user download their data, as a ZIP archive with one JSON
+// file per kind of record, or as a single JSON document with ?format=json.
+func (app *application) exportAccount(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	export, err := app.collectAccountExport(user)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.audit(c, user.ID, "account.exported", nil)
+
+	if c.Query("format") == "json" {
+		err = response.JSON(c.Writer, http.StatusOK, envelope{"export": export})
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	filename := fmt.Sprintf("offerland-export-%s.zip", time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"applicant_profile.json", export.ApplicantProfile},
+		{"identities.json", export.Identities},
+		{"posts.json", export.Posts},
+		{"results.json", export.Results},
+		{"sessions.json", export.Sessions},
+		{"watches.json", export.Watches},
+	}
+
+	// The headers are already sent, so a failure from here on can only be logged.
+	archive := zip.NewWriter(c.Writer)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			app.logger.Error(err)
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(file.data)
+		if err != nil {
+			app.logger.Error(err)
+			return
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		app.logger.Error(err)
+	}
+}
+
+func (app *application) collectAccountExport(user *models.User) (*accountExport, error) {
+	export := &accountExport{
+		Profile: accountProfile{
+			ID:                  user.ID,
+			CreatedAt:           user.CreatedAt,
+			Username:            user.Username,
+			Email:               user.Email,
+			Activated:           user.Activated,
+			Locale:              user.Locale,
+			HasPassword:         user.Password != "",
+			DeletionScheduledAt: user.DeletionScheduledAt,
+		},
+	}
+
+	var err error
+
+	export.ApplicantProfile, err = app.models.Profiles.Get(user.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	export.Identities, err = app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Posts, err = app.models.Posts.GetAllPosts(map[string][]string{"user_id": {user.ID}})
+	if err != nil {
+		return nil, err
+	}
+
+	export.Results, err = app.models.Results.Get(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Sessions, err = app.models.Sessions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Watches, err = app.models.Watches.GetForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
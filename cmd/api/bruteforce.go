@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+)
+
+// Attempt policies. Per-account counters stop guessing against one account from many
+// addresses, per-IP counters stop one address from trying many accounts. Client IPs
+// are only taken from headers the router trusts, see SetupRouter.
+var (
+	loginAccountPolicy = models.AttemptPolicy{MaxFailures: 5, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour}
+	loginIPPolicy      = models.AttemptPolicy{MaxFailures: 20, Window: 15 * time.Minute, Lockout: 5 * time.Minute, MaxLockout: time.Hour}
+
+	passcodeIPPolicy      = models.AttemptPolicy{MaxFailures: 20, Window: 15 * time.Minute, Lockout: 5 * time.Minute, MaxLockout: time.Hour}
+	stepUpAccountPolicy   = models.AttemptPolicy{MaxFailures: 5, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour}
+	activationMaxAttempts = 5
+
+	// Password reset emails are counted on every request, not only on failures.
+	passwordResetAccountPolicy = models.AttemptPolicy{MaxFailures: 3, Window: time.Hour, Lockout: time.Hour, MaxLockout: 24 * time.Hour}
+	passwordResetIPPolicy      = models.AttemptPolicy{MaxFailures: 10, Window: time.Hour, Lockout: time.Hour, MaxLockout: 24 * time.Hour}
+
+	// So are login code emails, which are sent more often than password resets.
+	loginCodeAccountPolicy = models.AttemptPolicy{MaxFailures: 5, Window: time.Hour, Lockout: 15 * time.Minute, MaxLockout: 24 * time.Hour}
+	loginCodeIPPolicy      = models.AttemptPolicy{MaxFailures: 20, Window: time.Hour, Lockout: 15 * time.Minute, MaxLockout: 24 * time.Hour}
+
+	// And email change links, which go to an address the account does not own yet.
+	emailChangeAccountPolicy = models.AttemptPolicy{MaxFailures: 3, Window: time.Hour, Lockout: time.Hour, MaxLockout: 24 * time.Hour}
+	emailChangeIPPolicy      = models.AttemptPolicy{MaxFailures: 10, Window: time.Hour, Lockout: time.Hour, MaxLockout: 24 * time.Hour}
+)
+
+// An attemptKey identifies one attempt counter and the policy it is held to.
+type attemptKey struct {
+	scope  string
+	key    string
+	policy models.AttemptPolicy
+}
+
+func loginAccountKey(email string) attemptKey {
+	return attemptKey{scope: "login_account", key: strings.ToLower(email), policy: loginAccountPolicy}
+}
+
+func loginIPKey(c *gin.Context) attemptKey {
+	return attemptKey{scope: "login_ip", key: c.ClientIP(), policy: loginIPPolicy}
+}
+
+func passcodeIPKey(c *gin.Context) attemptKey {
+	return attemptKey{scope: "passcode_ip", key: c.ClientIP(), policy: passcodeIPPolicy}
+}
+
+func stepUpAccountKey(userID string) attemptKey {
+	return attemptKey{scope: "step_up_account", key: userID, policy: stepUpAccountPolicy}
+}
+
+func passwordResetAccountKey(email string) attemptKey {
+	return attemptKey{scope: "password_reset_account", key: strings.ToLower(email), policy: passwordResetAccountPolicy}
+}
+
+func passwordResetIPKey(c *gin.Context) attemptKey {
+	return attemptKey{scope: "password_reset_ip", key: c.ClientIP(), policy: passwordResetIPPolicy}
+}
+
+func loginCodeAccountKey(email string) attemptKey {
+	return attemptKey{scope: "login_code_account", key: strings.ToLower(email), policy: loginCodeAccountPolicy}
+}
+
+func loginCodeIPKey(c *gin.Context) attemptKey {
+	return attemptKey{scope: "login_code_ip", key: c.ClientIP(), policy: loginCodeIPPolicy}
+}
+
+func emailChangeAccountKey(userID string) attemptKey {
+	return attemptKey{scope: "email_change_account", key: userID, policy: emailChangeAccountPolicy}
+}
+
+func emailChangeIPKey(c *gin.Context) attemptKey {
+	return attemptKey{scope: "email_change_ip", key: c.ClientIP(), policy: emailChangeIPPolicy}
+}
+
+// throttled reports whether any of the counters is locked. If one is, it has written
+// a 429 response telling the client when to retry.
+func (app *application) throttled(c *gin.Context, keys ...attemptKey) bool {
+	var lockedUntil time.Time
+	for _, key := range keys {
+		until, err := app.models.Attempts.LockedUntil(key.scope, key.key)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return true
+		}
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+
+	if lockedUntil.IsZero() {
+		return false
+	}
+
+	app.tooManyAttempts(c.Writer, c.Request, time.Until(lockedUntil))
+	return true
+}
+
+// recordFailure counts a failed attempt against every counter, and audits the
+// counters that locked because of it. Errors are logged rather than returned, as the
+// caller is already responding with an error.
+func (app *application) recordFailure(c *gin.Context, userID string, keys ...attemptKey) {
+	for _, key := range keys {
+		lockedUntil, err := app.models.Attempts.Fail(key.scope, key.key, key.policy)
+		if err != nil {
+			app.logger.Error(err)
+			continue
+		}
+		if !lockedUntil.IsZero() {
+			app.audit(c, userID, "lockout", map[string]any{"scope": key.scope, "locked_until": lockedUntil})
+		}
+	}
+}
+
+func (app *application) resetAttempts(keys ...attemptKey) {
+	for _, key := range keys {
+		err := app.models.Attempts.Reset(key.scope, key.key)
+		if err != nil {
+			app.logger.Error(err)
+		}
+	}
+}
+
+// audit records a security event for the request. A failure to write the audit log
+// is logged but does not fail the request.
+func (app *application) audit(c *gin.Context, userID string, event string, metadata map[string]any) {
+	err := app.models.Audit.Insert(&models.AuditEntry{
+		UserID:    userID,
+		Event:     event,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  metadata,
+	})
+	if err != nil {
+		app.logger.Error(err)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"offerland.cc/internal/catalog"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	// maxCatalogUpload bounds the size of an uploaded catalog file.
+	maxCatalogUpload = 10 << 20
+
+	// catalogImportTimeout bounds an import, which runs in a single transaction.
+	catalogImportTimeout = time.Minute
+
+	// Bounds of an autocomplete query and of the number of suggestions.
+	minAutocompleteQuery     = 2
+	maxAutocompleteQuery     = 100
+	defaultAutocompleteLimit = 10
+	maxAutocompleteLimit     = 50
+)
+
+// parseCatalogKind accepts the kinds of catalog entries that can have aliases.
+func parseCatalogKind(value string) (catalog.Kind, bool) {
+	switch kind := catalog.Kind(value); kind {
+	case catalog.KindSchool, catalog.KindMajor:
+		return kind, true
+	default:
+		return "", false
+	}
+}
+
+// autocompleteCatalog suggests schools or majors for what a user has typed so far,
+// matching names and aliases. ?kind= is school (the default) or major, and majors can
+// be limited to one school with ?school_id=.
+func (app *application) autocompleteCatalog(c *gin.Context) {
+	var v validator.Validator
+
+	q := strings.TrimSpace(c.Query("q"))
+	v.CheckField(utf8.RuneCountInString(q) >= minAutocompleteQuery, "q", "Query must be at least 2 characters")
+	v.CheckField(utf8.RuneCountInString(q) <= maxAutocompleteQuery, "q", "Query must be at most 100 characters")
+
+	kind := catalog.KindSchool
+	if value := c.Query("kind"); value != "" {
+		var ok bool
+		kind, ok = parseCatalogKind(value)
+		v.CheckField(ok, "kind", "Kind must be school or major")
+	}
+
+	var schoolID *uuid.UUID
+	if value := c.Query("school_id"); value != "" {
+		id, err := uuid.Parse(value)
+		v.CheckField(err == nil, "school_id", "Must be a valid ID")
+		schoolID = &id
+	}
+
+	limit := defaultAutocompleteLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		v.CheckField(err == nil && limit >= 1 && limit <= maxAutocompleteLimit, "limit", "Limit must be between 1 and 50")
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	entries, err := app.models.Catalog.Autocomplete(kind, q, schoolID, limit)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"results": entries})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+}
+
+// listCatalogAliases lists the aliases of the school or major ?kind= and ?id=.
+func (app *application) listCatalogAliases(c *gin.Context) {
+	var v validator.Validator
+
+	kind, ok := parseCatalogKind(c.Query("kind"))
+	v.CheckField(ok, "kind", "Kind must be school or major")
+
+	id, err := uuid.Parse(c.Query("id"))
+	v.CheckField(err == nil, "id", "Must be a valid ID")
+
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	aliases, err := app.models.Catalog.GetAliases(kind, id)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"aliases": aliases})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+}
+
+// createCatalogAlias adds another name for a school or major, like "UCB" for
+// "University of California, Berkeley".
+func (app *application) createCatalogAlias(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		Kind      string              `json:"kind"`
+		ID        string              `json:"id"`
+		Alias     string              `json:"alias"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	kind, ok := parseCatalogKind(input.Kind)
+	input.Validator.CheckField(ok, "kind", "Kind must be school or major")
+
+	id, err := uuid.Parse(input.ID)
+	input.Validator.CheckField(err == nil, "id", "Must be a valid ID")
+
+	input.Validator.CheckField(catalog.Normalize(input.Alias) != "", "alias", "Alias is required")
+	input.Validator.CheckField(utf8.RuneCountInString(input.Alias) <= 200, "alias", "Alias must be at most 200 characters")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	alias, err := app.models.Catalog.AddAlias(kind, id, input.Alias)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		case errors.Is(err, models.ErrDuplicateAlias):
+			app.aliasInUse(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	app.audit(c, user.ID, "catalog.alias_added", map[string]any{
+		"kind":      kind,
+		"target_id": id,
+		"alias":     alias.Alias,
+	})
+
+	err = response.JSON(c.Writer, http.StatusCreated, envelope{"alias": alias})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+}
+
+// deleteCatalogAlias deletes an alias of a school or major.
+func (app *application) deleteCatalogAlias(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	kind, ok := parseCatalogKind(c.Param("kind"))
+	if !ok {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	err = app.models.Catalog.DeleteAlias(kind, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	app.audit(c, user.ID, "catalog.alias_deleted", map[string]any{
+		"kind":     kind,
+		"alias_id": id,
+	})
+
+	c.Status(http.StatusNoContent)
+}
+
+// mergeCatalogEntries folds a duplicate school or major into another one. The
+// results of the duplicate are re-pointed, and its name becomes an alias.
+func (app *application) mergeCatalogEntries(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		Kind      string              `json:"kind"`
+		From      string              `json:"from"`
+		Into      string              `json:"into"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	kind, ok := parseCatalogKind(input.Kind)
+	input.Validator.CheckField(ok, "kind", "Kind must be school or major")
+
+	from, err := uuid.Parse(input.From)
+	input.Validator.CheckField(err == nil, "from", "Must be a valid ID")
+
+	into, err := uuid.Parse(input.Into)
+	input.Validator.CheckField(err == nil, "into", "Must be a valid ID")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	merge, err := app.models.Catalog.Merge(kind, from, into)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		case errors.Is(err, models.ErrMergeMismatch):
+			app.catalogMergeMismatch(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	app.audit(c, user.ID, "catalog.merged", map[string]any{
+		"kind":    kind,
+		"from":    from,
+		"into":    into,
+		"results": merge.Results,
+	})
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"merge": merge})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+}
+
+// importCatalog imports a CSV or JSON catalog file, either as a "file" field of a
+// multipart form or as the request body. The format is taken from ?format=, the file
+// name or the Content-Type, in that order. With ?dry_run=true nothing is written and
+// the report shows what the import would do.
+func (app *application) importCatalog(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogUpload)
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			app.badRequest(c.Writer, c.Request, errors.New("dry_run must be true or false"))
+			return
+		}
+	}
+
+	format := c.Query("format")
+	var body io.Reader = c.Request.Body
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	switch mediaType {
+	case "multipart/form-data":
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			app.badRequest(c.Writer, c.Request, errors.New("the form must have a file field"))
+			return
+		}
+		defer file.Close()
+
+		if format == "" {
+			format, err = catalog.FormatFromName(header.Filename)
+			if err != nil {
+				app.badRequest(c.Writer, c.Request, err)
+				return
+			}
+		}
+		body = file
+	case "text/csv":
+		if format == "" {
+			format = catalog.FormatCSV
+		}
+	case "application/json":
+		if format == "" {
+			format = catalog.FormatJSON
+		}
+	}
+	if format == "" {
+		app.badRequest(c.Writer, c.Request, errors.New("cannot tell the format of the file, set ?format=csv or ?format=json"))
+		return
+	}
+
+	records, err := catalog.Parse(body, format)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), catalogImportTimeout)
+	defer cancel()
+
+	report, err := catalog.NewImporter(app.db).Import(ctx, records, dryRun)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	if !dryRun {
+		app.audit(c, user.ID, "catalog.imported", map[string]any{
+			"rows":      report.Rows,
+			"created":   report.Created,
+			"conflicts": len(report.Conflicts),
+		})
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"report": report})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+}
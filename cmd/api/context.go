@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"offerland.cc/internal/models"
 )
 
@@ -16,6 +17,10 @@ type contextKey string
 // in the request context.
 const userContextKey = contextKey("user")
 
+// sessionContextKey holds the ID of the first-party session the access token of the
+// request belongs to.
+const sessionContextKey = contextKey("session")
+
 // The contextSetUser() method returns a new copy of the request with the provided
 // User struct added to the context. Note that we use our userContextKey constant as the
 // key.
@@ -35,3 +40,15 @@ func (app *application) contextGetUser(r *http.Request) *models.User {
 	}
 	return user
 }
+
+func (app *application) contextSetSession(c *gin.Context, sessionID uuid.UUID) {
+	ctx := context.WithValue(c.Request.Context(), sessionContextKey, sessionID)
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// contextGetSession returns the session of the request, if it was authenticated
+// with a first-party access token.
+func (app *application) contextGetSession(r *http.Request) (uuid.UUID, bool) {
+	sessionID, ok := r.Context().Value(sessionContextKey).(uuid.UUID)
+	return sessionID, ok
+}
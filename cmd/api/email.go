@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/identity"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+const emailChangeTokenTTL = 24 * time.Hour
+
+// requestEmailChange starts changing the email address of the user. A confirmation
+// link goes to the new address and a notice to the current one; the address only
+// changes once the link is followed.
+func (app *application) requestEmailChange(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		Email     string              `json:"email"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.Validator.CheckField(validator.Matches(input.Email, validator.RgxEmail), "email", "Must be a valid email address")
+	input.Validator.CheckField(input.Email != user.Email, "email", "This is already your email address")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	// Emails are counted on every request, as for password resets, so that the
+	// endpoint cannot be used to flood someone's inbox.
+	accountKey, ipKey := emailChangeAccountKey(user.ID), emailChangeIPKey(c)
+	if app.throttled(c, accountKey, ipKey) {
+		return
+	}
+	app.recordFailure(c, user.ID, accountKey, ipKey)
+
+	// Only a verified address is taken. An account that was never activated does not
+	// hold on to its address.
+	existing, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	if existing != nil && existing.Activated {
+		input.Validator.AddFieldError("email", "This email address is already in use")
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	token, err := app.models.Tokens.NewEmailChangeToken(user.ID, input.Email, emailChangeTokenTTL)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.audit(c, user.ID, "email.change_requested", map[string]any{"new_email": input.Email})
+
+	app.background(func() {
+		data := map[string]any{
+			"username":    user.Username,
+			"newEmail":    input.Email,
+			"confirmLink": fmt.Sprintf("%s/confirm-email/%s", app.config.FRONTEND_URL, token.Plaintext),
+			"hours":       int(emailChangeTokenTTL.Hours()),
+		}
+
+		err := app.mailer.SendLocalized(input.Email, user.Locale, data, "user_email_change.tmpl")
+		if err != nil {
+			app.logger.Error(err)
+		}
+
+		err = app.mailer.SendLocalized(user.Email, user.Locale, data, "user_email_change_notice.tmpl")
+		if err != nil {
+			app.logger.Error(err)
+		}
+	})
+
+	err = response.JSON(c.Writer, http.StatusAccepted, envelope{"expiry": token.Expiry})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// confirmEmailChange switches the user to the address the token was sent to, first
+// in the identity provider and then in our database.
+func (app *application) confirmEmailChange(c *gin.Context) {
+	ipKey := passcodeIPKey(c)
+	if app.throttled(c, ipKey) {
+		return
+	}
+
+	userID, newEmail, err := app.models.Tokens.ConsumeEmailChangeToken(c.Param("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailure(c, "", ipKey)
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	oldEmail := user.Email
+
+	// Accounts that only sign in with a linked login provider are not known to the
+	// identity provider, so there is nothing to update for them.
+	err = app.identity.UpdateEmail(c, user.ID, newEmail)
+	if err != nil && !errors.Is(err, identity.ErrUserNotFound) {
+		switch {
+		case errors.Is(err, identity.ErrEmailExists):
+			app.emailInUse(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = app.models.Users.ChangeEmail(user, newEmail)
+	if err != nil {
+		// Put the identity provider back in line with our database.
+		rollbackErr := app.identity.UpdateEmail(c, user.ID, oldEmail)
+		if rollbackErr != nil && !errors.Is(rollbackErr, identity.ErrUserNotFound) {
+			app.logger.Error(rollbackErr)
+		}
+
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			app.emailInUse(c.Writer, c.Request)
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflict(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	// Reset links sent to the old address must not work any more.
+	err = app.models.Tokens.DeleteResetTokensForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.audit(c, user.ID, "email.changed", map[string]any{"old_email": oldEmail, "new_email": newEmail})
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"user": user})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"offerland.cc/internal/i18n"
 	"offerland.cc/internal/response"
 	"offerland.cc/internal/validator"
 )
 
 func (app *application) errorMessage(w http.ResponseWriter, r *http.Request, status int, message string, headers http.Header) {
-	message = strings.ToUpper(message[:1]) + message[1:]
+	message = i18n.Translate(app.requestLocale(r), message)
+
+	if message != "" {
+		first, size := utf8.DecodeRuneInString(message)
+		message = string(unicode.ToUpper(first)) + message[size:]
+	}
 
 	err := response.JSONWithHeaders(w, status, map[string]string{"Error": message}, headers)
 	if err != nil {
@@ -41,12 +51,26 @@ func (app *application) editConflict(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, v validator.Validator) {
-	err := response.JSON(w, http.StatusUnprocessableEntity, v)
+	err := response.JSON(w, http.StatusUnprocessableEntity, app.translateValidation(r, v))
 	if err != nil {
 		app.serverError(w, r, err)
 	}
 }
 
+// translateValidation translates the messages of v into the locale of the request.
+func (app *application) translateValidation(r *http.Request, v validator.Validator) validator.Validator {
+	locale := app.requestLocale(r)
+
+	var translated validator.Validator
+	for _, message := range v.Errors {
+		translated.AddError(i18n.Translate(locale, message))
+	}
+	for key, message := range v.FieldErrors {
+		translated.AddFieldError(key, i18n.Translate(locale, message))
+	}
+	return translated
+}
+
 func (app *application) invalidCredentials(w http.ResponseWriter, r *http.Request) {
 	message := "invalid email address or password"
 	app.errorMessage(w, r, http.StatusUnauthorized, message, nil)
@@ -60,3 +84,114 @@ func (app *application) inactiveAccount(w http.ResponseWriter, r *http.Request)
 func (app *application) invalidAuthenticationToken(w http.ResponseWriter, r *http.Request) {
 	app.errorMessage(w, r, http.StatusUnauthorized, "Invalid or missing authentication token", nil)
 }
+
+func (app *application) invalidLoginState(w http.ResponseWriter, r *http.Request) {
+	message := "the login request is invalid or has expired, please try again"
+	app.errorMessage(w, r, http.StatusBadRequest, message, nil)
+}
+
+func (app *application) unverifiedProviderEmail(w http.ResponseWriter, r *http.Request) {
+	message := "the login provider did not return a verified email address"
+	app.errorMessage(w, r, http.StatusForbidden, message, nil)
+}
+
+func (app *application) identityEmailConflict(w http.ResponseWriter, r *http.Request) {
+	message := "an account with this email address already exists, sign in to it to link this login provider"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) identityAlreadyLinked(w http.ResponseWriter, r *http.Request) {
+	message := "this login provider account is already linked to your account"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) identityLinkedToOtherAccount(w http.ResponseWriter, r *http.Request) {
+	message := "this login provider account is linked to another account"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) lastLoginMethod(w http.ResponseWriter, r *http.Request) {
+	message := "you cannot remove your only way to sign in, set a password or link another login provider first"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) passwordAlreadySet(w http.ResponseWriter, r *http.Request) {
+	message := "your account already has a password"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) emailInUse(w http.ResponseWriter, r *http.Request) {
+	message := "this email address is already in use"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) passwordNotSet(w http.ResponseWriter, r *http.Request) {
+	message := "your account has no password yet, set one first"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) accountPendingDeletion(w http.ResponseWriter, r *http.Request) {
+	message := "your account is scheduled for deletion, sign in again to cancel it"
+	app.errorMessage(w, r, http.StatusUnauthorized, message, nil)
+}
+
+func (app *application) accountDisabled(w http.ResponseWriter, r *http.Request) {
+	message := "your account has been disabled"
+	app.errorMessage(w, r, http.StatusForbidden, message, nil)
+}
+
+func (app *application) stepUpRequired(w http.ResponseWriter, r *http.Request) {
+	message := "please confirm your identity again to perform this action"
+	app.errorMessage(w, r, http.StatusForbidden, message, nil)
+}
+
+func (app *application) notPermitted(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorMessage(w, r, http.StatusForbidden, message, nil)
+}
+
+func (app *application) aliasInUse(w http.ResponseWriter, r *http.Request) {
+	message := "this alias already names another catalog entry"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) catalogMergeMismatch(w http.ResponseWriter, r *http.Request) {
+	message := "these catalog entries cannot be merged, majors must belong to the same school and degree"
+	app.errorMessage(w, r, http.StatusUnprocessableEntity, message, nil)
+}
+
+func (app *application) watchExists(w http.ResponseWriter, r *http.Request) {
+	message := "you are already watching this program"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) notEnoughPredictionData(w http.ResponseWriter, r *http.Request) {
+	message := "there are not enough reported results with applicant profiles for this program to make a prediction"
+	app.errorMessage(w, r, http.StatusUnprocessableEntity, message, nil)
+}
+
+func (app *application) invalidTwoFactorCode(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired two-factor authentication code"
+	app.errorMessage(w, r, http.StatusUnauthorized, message, nil)
+}
+
+func (app *application) twoFactorAlreadyEnabled(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is already enabled"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
+func (app *application) tooManyAttempts(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	headers := make(http.Header)
+	headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "too many attempts, please try again later"
+	app.errorMessage(w, r, http.StatusTooManyRequests, message, headers)
+}
+
+func (app *application) rateLimitExceeded(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	headers := make(http.Header)
+	headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "rate limit exceeded, please slow down"
+	app.errorMessage(w, r, http.StatusTooManyRequests, message, headers)
+}
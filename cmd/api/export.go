@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/parquet"
+	"offerland.cc/internal/validator"
+)
+
+// exportTimeout bounds a bulk export, which holds a database connection while the
+// client downloads it.
+const exportTimeout = 10 * time.Minute
+
+// exportColumn is a column of the CSV and Parquet exports.
+type exportColumn struct {
+	parquet.Column
+	// value returns the value of the column in r, nil for a null.
+	value func(r *models.AnonymizedResult) any
+}
+
+// exportColumns lists the columns of CSV and Parquet exports, in the order and with
+// the names of the JSON fields of models.AnonymizedResult.
+var exportColumns = []exportColumn{
+	{parquet.Column{Name: "school_id", Type: parquet.String, Optional: true}, func(r *models.AnonymizedResult) any { return uuidValue(r.SchoolID) }},
+	{parquet.Column{Name: "school", Type: parquet.String}, func(r *models.AnonymizedResult) any { return r.School }},
+	{parquet.Column{Name: "major_id", Type: parquet.String, Optional: true}, func(r *models.AnonymizedResult) any { return uuidValue(r.MajorID) }},
+	{parquet.Column{Name: "major", Type: parquet.String}, func(r *models.AnonymizedResult) any { return r.Major }},
+	{parquet.Column{Name: "degree", Type: parquet.String, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.Degree) }},
+	{parquet.Column{Name: "cycle", Type: parquet.Int32}, func(r *models.AnonymizedResult) any { return r.Cycle }},
+	{parquet.Column{Name: "decision_month", Type: parquet.String}, func(r *models.AnonymizedResult) any { return r.DecisionMonth }},
+	{parquet.Column{Name: "status", Type: parquet.String}, func(r *models.AnonymizedResult) any { return r.Status }},
+	{parquet.Column{Name: "gpa", Type: parquet.Double, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.GPA) }},
+	{parquet.Column{Name: "gre_verbal", Type: parquet.Int32, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.GREVerbal) }},
+	{parquet.Column{Name: "gre_quant", Type: parquet.Int32, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.GREQuant) }},
+	{parquet.Column{Name: "gre_writing", Type: parquet.Double, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.GREWriting) }},
+	{parquet.Column{Name: "toefl", Type: parquet.Int32, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.TOEFL) }},
+	{parquet.Column{Name: "ielts", Type: parquet.Double, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.IELTS) }},
+	{parquet.Column{Name: "undergrad_school", Type: parquet.String, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.UndergradSchool) }},
+	{parquet.Column{Name: "undergrad_major", Type: parquet.String, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.UndergradMajor) }},
+	{parquet.Column{Name: "graduation_year", Type: parquet.Int32, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.GraduationYear) }},
+	{parquet.Column{Name: "country", Type: parquet.String, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.Country) }},
+	{parquet.Column{Name: "work_experience_years", Type: parquet.Int32, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.WorkExperienceYears) }},
+	{parquet.Column{Name: "publications", Type: parquet.Int32, Optional: true}, func(r *models.AnonymizedResult) any { return optional(r.Publications) }},
+	{parquet.Column{Name: "suppression", Type: parquet.String}, func(r *models.AnonymizedResult) any { return r.Suppression }},
+}
+
+// optional returns the value p points to, or an untyped nil for a nil pointer.
+func optional[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func uuidValue(id *uuid.UUID) any {
+	if id == nil {
+		return nil
+	}
+	return id.String()
+}
+
+// resultEncoder writes exported results in one of the export formats.
+type resultEncoder interface {
+	Encode(r *models.AnonymizedResult) error
+	Close() error
+}
+
+// exportFormats maps the export formats onto their content type, file extension and
+// encoder.
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+	encoder     func(w io.Writer) (resultEncoder, error)
+}{
+	"csv":     {"text/csv; charset=utf-8", "csv", newCSVResultEncoder},
+	"ndjson":  {"application/x-ndjson", "ndjson", newNDJSONResultEncoder},
+	"parquet": {"application/vnd.apache.parquet", "parquet", newParquetResultEncoder},
+}
+
+type csvResultEncoder struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVResultEncoder(w io.Writer) (resultEncoder, error) {
+	e := &csvResultEncoder{w: csv.NewWriter(w), record: make([]string, len(exportColumns))}
+	for i, column := range exportColumns {
+		e.record[i] = column.Name
+	}
+	return e, e.w.Write(e.record)
+}
+
+func (e *csvResultEncoder) Encode(r *models.AnonymizedResult) error {
+	for i, column := range exportColumns {
+		switch v := column.value(r).(type) {
+		case nil:
+			e.record[i] = ""
+		case string:
+			e.record[i] = v
+		case int:
+			e.record[i] = strconv.Itoa(v)
+		case float64:
+			e.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("export: unexpected %T in column %s", v, column.Name)
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvResultEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonResultEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONResultEncoder(w io.Writer) (resultEncoder, error) {
+	return &ndjsonResultEncoder{enc: json.NewEncoder(w)}, nil
+}
+
+func (e *ndjsonResultEncoder) Encode(r *models.AnonymizedResult) error {
+	return e.enc.Encode(r)
+}
+
+func (e *ndjsonResultEncoder) Close() error {
+	return nil
+}
+
+type parquetResultEncoder struct {
+	w      *parquet.Writer
+	values []any
+}
+
+func newParquetResultEncoder(w io.Writer) (resultEncoder, error) {
+	columns := make([]parquet.Column, len(exportColumns))
+	for i, column := range exportColumns {
+		columns[i] = column.Column
+	}
+	return &parquetResultEncoder{w: parquet.NewWriter(w, columns), values: make([]any, len(columns))}, nil
+}
+
+func (e *parquetResultEncoder) Encode(r *models.AnonymizedResult) error {
+	for i, column := range exportColumns {
+		e.values[i] = column.value(r)
+	}
+	return e.w.Write(e.values...)
+}
+
+func (e *parquetResultEncoder) Close() error {
+	return e.w.Close()
+}
+
+// exportResults streams every result with the background of its applicant, stripped
+// of anything identifying and with small groups suppressed, as CSV (the default),
+// NDJSON or Parquet. Results can be limited to one ?cycle= and one ?school_id=, and
+// ?k= raises the minimum group size above EXPORT_MIN_GROUP_SIZE.
+func (app *application) exportResults(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var v validator.Validator
+
+	name := c.DefaultQuery("format", "csv")
+	format, ok := exportFormats[name]
+	v.CheckField(ok, "format", "Format must be csv, ndjson or parquet")
+
+	filter := models.ExportFilter{MinGroupSize: app.config.EXPORT_MIN_GROUP_SIZE}
+	if value := c.Query("cycle"); value != "" {
+		cycle, err := strconv.Atoi(value)
+		v.CheckField(err == nil && cycle >= 2000 && cycle <= 2100, "cycle", "Cycle must be a year")
+		filter.Cycle = cycle
+	}
+	if value := c.Query("school_id"); value != "" {
+		id, err := uuid.Parse(value)
+		v.CheckField(err == nil, "school_id", "Must be a valid ID")
+		filter.SchoolID = &id
+	}
+	if value := c.Query("k"); value != "" {
+		k, err := strconv.Atoi(value)
+		v.CheckField(err == nil && k >= app.config.EXPORT_MIN_GROUP_SIZE, "k", "k must not be below the minimum group size")
+		filter.MinGroupSize = k
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), exportTimeout)
+	defer cancel()
+
+	filename := fmt.Sprintf("offerland-results-%s.%s", time.Now().Format("20060102"), format.extension)
+	c.Header("Content-Type", format.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// The headers are already sent, so a failure from here on can only be logged, and
+	// shows to the client as a truncated file.
+	encoder, err := format.encoder(c.Writer)
+	if err != nil {
+		app.logger.Error(err)
+		return
+	}
+
+	rows := 0
+	err = app.models.Results.Export(ctx, filter, func(r *models.AnonymizedResult) error {
+		rows++
+		return encoder.Encode(r)
+	})
+	if err != nil {
+		app.logger.Error(err)
+		return
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		app.logger.Error(err)
+		return
+	}
+
+	app.audit(c, user.ID, "results.exported", map[string]any{
+		"format": name,
+		"cycle":  filter.Cycle,
+		"k":      filter.MinGroupSize,
+		"rows":   rows,
+	})
+}
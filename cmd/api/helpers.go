@@ -3,9 +3,12 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/i18n"
 	"offerland.cc/internal/models"
+	"offerland.cc/internal/password"
 	"offerland.cc/internal/request"
 	"offerland.cc/internal/validator"
 )
@@ -16,13 +19,14 @@ func (app *application) pong(c *gin.Context) {
 	c.String(200, "pong")
 }
 
-func (app *application) checkUsernameHelper(username string) (bool, error) {
-	_, err := app.models.Users.GetByUsername(username)
-	if err != nil {
-		return false, err
-	}
+// requestLocale returns the supported locale that best matches the request's
+// Accept-Language header.
+func (app *application) requestLocale(r *http.Request) string {
+	return i18n.Match(r.Header.Get("Accept-Language"))
+}
 
-	return true, nil
+func (app *application) checkUsernameHelper(username string) (bool, error) {
+	return app.models.Users.UsernameTaken(username)
 }
 
 func (app *application) checkEmailHelper(email string) (bool, error) {
@@ -61,6 +65,11 @@ func (app *application) userVerification(c *gin.Context) *models.User {
 		return nil
 	}
 
+	ipKey := passcodeIPKey(c)
+	if app.throttled(c, ipKey) {
+		return nil
+	}
+
 	// Retrieve the details of the user associated with the token using the
 	// GetForToken() method. If no matching record
 	// is found, then we let the client know that the token they provided is not valid.
@@ -68,6 +77,7 @@ func (app *application) userVerification(c *gin.Context) *models.User {
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailure(c, "", ipKey)
 			app.notFound(c.Writer, c.Request)
 		default:
 			app.serverError(c.Writer, c.Request, err)
@@ -75,20 +85,20 @@ func (app *application) userVerification(c *gin.Context) *models.User {
 		return nil
 	}
 
-	// Validate the passcode provided by the client.
-	valid, err := app.models.Tokens.Validate(input.Passcode, input.TokenPlaintext)
-	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			input.Validator.AddFieldError("passcode", "invalid or expired passcode")
-			app.failedValidation(c.Writer, c.Request, input.Validator)
-		default:
-			app.serverError(c.Writer, c.Request, err)
-		}
+	// Validate the passcode provided by the client. The token is deleted after too
+	// many wrong passcodes.
+	valid, err := app.models.Tokens.Validate(input.Passcode, input.TokenPlaintext, activationMaxAttempts)
+	if err != nil && !errors.Is(err, models.ErrTokenExhausted) {
+		app.serverError(c.Writer, c.Request, err)
 		return nil
 	}
 
 	if !valid {
+		app.recordFailure(c, user.ID, ipKey)
+		app.audit(c, user.ID, "activation.failure", nil)
+		if errors.Is(err, models.ErrTokenExhausted) {
+			app.audit(c, user.ID, "activation.token_invalidated", nil)
+		}
 		input.Validator.AddFieldError("passcode", "invalid or expired passcode")
 		app.failedValidation(c.Writer, c.Request, input.Validator)
 		return nil
@@ -103,6 +113,18 @@ func (app *application) userVerification(c *gin.Context) *models.User {
 	return user
 }
 
+// rehashPassword stores a fresh hash of plaintextPassword for the user, using the
+// currently configured hashing algorithm and cost.
+func (app *application) rehashPassword(user *models.User, plaintextPassword string) error {
+	passwordHash, err := password.Hash(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	user.Password = passwordHash
+	return app.models.Users.Update(user)
+}
+
 // The background() helper accepts an arbitrary function as a parameter.
 func (app *application) background(fn func()) { // Launch a background goroutine.
 	app.wg.Add(1)
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/password"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+// listIdentities returns the login providers linked to the authenticated user, and
+// whether they can also sign in with a password.
+func (app *application) listIdentities(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	identities, err := app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"identities": identities, "has_password": user.Password != ""})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// linkIdentityStart begins linking a provider account to the authenticated user.
+// The flow is the same as for signing in, but the state is bound to the user.
+func (app *application) linkIdentityStart(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	provider, err := app.oidc.Get(c.Param("provider"))
+	if err != nil {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	app.authorizeWithProvider(c, provider, user.ID)
+}
+
+// linkIdentityCallback links the provider account the user consented with to the
+// authenticated user. An account that is already linked to another user is never
+// moved over.
+func (app *application) linkIdentityCallback(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	provider, err := app.oidc.Get(c.Param("provider"))
+	if err != nil {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	claims, ok := app.providerClaims(c, provider, user.ID)
+	if !ok {
+		return
+	}
+
+	linkedUserID, err := app.models.Identities.GetUserID(provider.Name(), claims.Subject)
+	switch {
+	case err == nil && linkedUserID == user.ID:
+		app.identityAlreadyLinked(c.Writer, c.Request)
+		return
+	case err == nil:
+		app.identityLinkedToOtherAccount(c.Writer, c.Request)
+		return
+	case !errors.Is(err, models.ErrRecordNotFound):
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	identity := &models.Identity{
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	}
+
+	err = app.models.Identities.Insert(identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateIdentity):
+			app.identityLinkedToOtherAccount(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusCreated, envelope{"identity": identity})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// unlinkIdentity removes a provider from the authenticated user. The last way to
+// sign in cannot be removed, so that nobody locks themselves out of their account.
+func (app *application) unlinkIdentity(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+	providerName := c.Param("provider")
+
+	identities, err := app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	linked := false
+	otherMethods := 0
+	for _, identity := range identities {
+		if identity.Provider == providerName {
+			linked = true
+		} else {
+			otherMethods++
+		}
+	}
+	if user.Password != "" {
+		otherMethods++
+	}
+
+	if !linked {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+	if otherMethods == 0 {
+		app.lastLoginMethod(c.Writer, c.Request)
+		return
+	}
+
+	err = app.models.Identities.Delete(user.ID, providerName)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// setPassword adds a password to an account that so far could only sign in through
+// a login provider.
+func (app *application) setPassword(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		Password  string              `json:"password"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	if user.Password != "" {
+		app.passwordAlreadySet(c.Writer, c.Request)
+		return
+	}
+
+	input.Validator.CheckField(len(input.Password) >= 8, "password", "Password is too short, must be at least 8 characters")
+	input.Validator.CheckField(len(input.Password) <= 72, "password", "Password is too long, must be at most 72 characters")
+	input.Validator.CheckField(validator.NotIn(input.Password, password.CommonPasswords...), "password", "Password is too common")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	user.Password, err = password.Hash(input.Password)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflict(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
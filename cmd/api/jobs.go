@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"offerland.cc/internal/identity"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/scheduler"
+)
+
+const (
+	// purgeBatchSize bounds how many accounts one run deletes.
+	purgeBatchSize = 100
+
+	// jobRunRetention is how long the history of job runs is kept.
+	jobRunRetention = 30 * 24 * time.Hour
+
+	// watchBatchSize bounds how many watch notifications one run sends.
+	watchBatchSize = 500
+)
+
+// registerJobs adds the periodic maintenance jobs to the scheduler. A failing run is
+// logged and recorded, and tried again at the next scheduled time.
+func (app *application) registerJobs() error {
+	jobs := []scheduler.Job{
+		{Name: "purge-deleted-accounts", Spec: "@hourly", Timeout: 10 * time.Minute, Run: app.purgeDeletedAccounts},
+		{Name: "cleanup", Spec: "30 * * * *", Timeout: 10 * time.Minute, Run: app.reap},
+		{Name: "notify-watchers", Spec: "*/15 * * * *", Timeout: 10 * time.Minute, Run: app.notifyWatchers},
+	}
+
+	for _, job := range jobs {
+		err := app.scheduler.Add(job)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeDeletedAccounts deletes the accounts whose deletion grace period has passed,
+// from the identity provider and from our database. Their posts and results stay,
+// detached from the account and with their free text cleared, see UserModel.Purge.
+func (app *application) purgeDeletedAccounts(ctx context.Context) error {
+	userIDs, err := app.models.Users.GetDueForDeletion(purgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		err = app.identity.DeleteUser(ctx, userID)
+		if err != nil && !errors.Is(err, identity.ErrUserNotFound) {
+			return err
+		}
+
+		err = app.models.Users.Purge(userID)
+		if err != nil {
+			return err
+		}
+
+		// The account is gone, so the entry cannot reference it any more.
+		err = app.models.Audit.Insert(&models.AuditEntry{
+			Event:    "account.deleted",
+			Metadata: map[string]any{"user_id": userID},
+		})
+		if err != nil {
+			app.logger.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// reap deletes accounts that were never activated within cleanup.unactivatedTTL, and
+// tokens, sessions and counters that have been expired for cleanup.expiredTTL. Read
+// paths never delete anything themselves.
+func (app *application) reap(ctx context.Context) error {
+	now := time.Now()
+
+	users, err := app.models.Users.DeleteUnactivated(now.Add(-app.cleanup.unactivatedTTL))
+	if err != nil {
+		return err
+	}
+
+	expiredBefore := now.Add(-app.cleanup.expiredTTL)
+
+	tokens, err := app.models.Tokens.DeleteExpired(expiredBefore)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := app.models.Sessions.DeleteExpired(expiredBefore)
+	if err != nil {
+		return err
+	}
+
+	attempts, err := app.models.Attempts.DeleteStale(expiredBefore)
+	if err != nil {
+		return err
+	}
+
+	buckets, err := app.limiter.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	jobRuns, err := app.scheduler.Prune(ctx, now.Add(-jobRunRetention))
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("Cleanup deleted %d unactivated users, %d sessions, %d attempt counters, %d rate limit buckets, %d job runs and tokens %v",
+		users, sessions, attempts, buckets, jobRuns, tokens)
+	return nil
+}
+
+// notifyWatchers emails the users watching a program once the first decision of the
+// current cycle is reported for it. A watch is only marked as notified once the email
+// is sent, so one that fails is tried again at the next run.
+func (app *application) notifyWatchers(ctx context.Context) error {
+	cycle := currentCycle()
+
+	notices, err := app.models.Watches.GetDue(cycle, watchBatchSize)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, notice := range notices {
+		if ctx.Err() != nil {
+			break
+		}
+
+		data := map[string]any{
+			"username":     notice.Username,
+			"school":       notice.Program.School,
+			"major":        notice.Program.Major,
+			"admitted":     notice.Status == "admitted",
+			"announceDate": notice.AnnounceDate.Format("2006-01-02"),
+			"cycle":        cycle,
+		}
+		err := app.mailer.SendLocalized(notice.Email, notice.Locale, data, "program_first_decision.tmpl")
+		if err != nil {
+			app.logger.Error(err)
+			continue
+		}
+
+		err = app.models.Watches.MarkNotified(notice.WatchID, cycle)
+		if err != nil {
+			return err
+		}
+		sent++
+	}
+
+	if len(notices) > 0 {
+		app.logger.Info("Sent %d of %d first decision notifications for cycle %d", sent, len(notices), cycle)
+	}
+	return nil
+}
@@ -57,19 +57,27 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
-	"firebase.google.com/go/v4/auth"
 	_ "github.com/lib/pq"
 	"google.golang.org/api/option"
 	"offerland.cc/configs"
 	"offerland.cc/internal/database"
+	"offerland.cc/internal/identity"
+	"offerland.cc/internal/jwtauth"
 	"offerland.cc/internal/leveledlog"
 	"offerland.cc/internal/models"
+	"offerland.cc/internal/oidc"
+	"offerland.cc/internal/password"
+	"offerland.cc/internal/ratelimit"
+	"offerland.cc/internal/scheduler"
 	"offerland.cc/internal/smtp"
 )
 
@@ -83,13 +91,31 @@ import (
 // and middleware. At the moment this only contains a copy of the config struct and a
 // logger, but it will grow to include a lot more as our build progresses.
 type application struct {
-	config         *configs.Config
-	logger         *leveledlog.Logger
-	models         *models.Models
-	firebaseClient *auth.Client
-	db             *sql.DB
-	mailer         *smtp.Mailer
-	wg             sync.WaitGroup
+	config        *configs.Config
+	logger        *leveledlog.Logger
+	models        *models.Models
+	identity      identity.Provider
+	oidc          oidc.Registry
+	limiter       *ratelimit.Limiter
+	scheduler     *scheduler.Scheduler
+	accessTokens  *jwtauth.Issuer
+	refreshTokens *jwtauth.Issuer
+	db            *sql.DB
+	mailer        *smtp.Mailer
+	wg            sync.WaitGroup
+
+	// deletionGracePeriod is how long a deleted account can still be restored by
+	// signing in again.
+	deletionGracePeriod time.Duration
+	cleanup             cleanupConfig
+}
+
+// cleanupConfig holds how long the cleanup job keeps records around.
+type cleanupConfig struct {
+	// unactivatedTTL is how long an account can wait to be activated.
+	unactivatedTTL time.Duration
+	// expiredTTL is how long expired tokens and sessions are kept.
+	expiredTTL time.Duration
 }
 
 func main() {
@@ -98,6 +124,15 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// "api migrate ..." manages the schema instead of starting the server.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(cfg, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	// Read the value of the port and env command-line flags into the config struct. We
 	// default to using the port number 8080 and the environment "development" if no
 	// corresponding flags are provided.
@@ -125,25 +160,82 @@ func main() {
 	// main() function exits.
 	defer db.Close()
 
-	mailer := smtp.NewMailer(cfg.SMTP_HOST, cfg.SMTP_PORT, cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD, cfg.SMTP_FROM)
+	err = password.Configure(password.Params{
+		Algorithm:     cfg.PASSWORD_HASH_ALGORITHM,
+		BcryptCost:    cfg.PASSWORD_BCRYPT_COST,
+		Argon2Memory:  cfg.PASSWORD_ARGON2_MEMORY,
+		Argon2Time:    cfg.PASSWORD_ARGON2_TIME,
+		Argon2Threads: cfg.PASSWORD_ARGON2_THREADS,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	mailTransport, err := newMailTransport(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	mailer := smtp.NewMailer(mailTransport, cfg.SMTP_FROM)
+
+	accessTokens, refreshTokens, err := newTokenIssuers(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	identityProvider, err := newIdentityProvider(cfg, accessTokens)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	oidcProviders, err := newOIDCRegistry(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
-	opt := option.WithCredentialsFile(cfg.FIREBASE_CONFIG)
-	firebase, err := firebase.NewApp(context.Background(), nil, opt)
+	limiter, err := newRateLimiter(cfg, db)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	firebaseClient, err := firebase.Auth(context.Background())
+
+	deletionGracePeriod, err := time.ParseDuration(cfg.ACCOUNT_DELETION_GRACE_PERIOD)
 	if err != nil {
-		log.Fatalf("error getting Auth client: %v\n", err)
+		logger.Fatal(err)
+	}
+
+	cleanup, err := newCleanupConfig(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if cfg.EXPORT_MIN_GROUP_SIZE < 2 {
+		logger.Fatal(fmt.Errorf("EXPORT_MIN_GROUP_SIZE must be at least 2, got %d", cfg.EXPORT_MIN_GROUP_SIZE))
+	}
+
+	jobScheduler, err := newScheduler(cfg, db, logger)
+	if err != nil {
+		logger.Fatal(err)
 	}
 
 	app := &application{
-		config:         cfg,
-		logger:         logger,
-		models:         models.NewModels(db),
-		firebaseClient: firebaseClient,
-		db:             db,
-		mailer:         mailer,
+		config:        cfg,
+		logger:        logger,
+		models:        models.NewModels(db),
+		identity:      identityProvider,
+		oidc:          oidcProviders,
+		limiter:       limiter,
+		scheduler:     jobScheduler,
+		accessTokens:  accessTokens,
+		refreshTokens: refreshTokens,
+		db:            db,
+		mailer:        mailer,
+
+		deletionGracePeriod: deletionGracePeriod,
+		cleanup:             cleanup,
+	}
+
+	err = app.registerJobs()
+	if err != nil {
+		logger.Fatal(err)
 	}
 
 	// Start the HTTP server
@@ -152,3 +244,180 @@ func main() {
 		logger.Fatal(err)
 	}
 }
+
+// newMailTransport returns the mail transport selected by MAIL_TRANSPORT. "smtp"
+// delivers through the configured SMTP server, "file" writes messages into a maildir
+// at MAIL_DIR and "capture" keeps them in memory.
+func newMailTransport(cfg *configs.Config) (smtp.Transport, error) {
+	switch cfg.MAIL_TRANSPORT {
+	case "smtp", "":
+		return smtp.NewSMTPTransport(cfg.SMTP_HOST, cfg.SMTP_PORT, cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD), nil
+	case "file":
+		return smtp.NewFileTransport(cfg.MAIL_DIR)
+	case "capture":
+		return smtp.NewCaptureTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", cfg.MAIL_TRANSPORT)
+	}
+}
+
+// newTokenIssuers returns the issuers for access and refresh tokens. With HS256 each
+// token type has its own secret, which must be strong outside development; with EdDSA
+// both are signed with the key derived from JWT_ED25519_SEED and told apart by their
+// "typ" claim.
+func newTokenIssuers(cfg *configs.Config) (*jwtauth.Issuer, *jwtauth.Issuer, error) {
+	accessTTL, err := time.ParseDuration(cfg.ACCESS_TOKEN_TTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshTTL, err := time.ParseDuration(cfg.REFRESH_TOKEN_TTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch cfg.JWT_ALGORITHM {
+	case jwtauth.AlgorithmHS256, "":
+		if cfg.ENV != "dev" {
+			if err := jwtauth.CheckHMACSecret(cfg.ACCESS_TOKEN_SECRET); err != nil {
+				return nil, nil, fmt.Errorf("ACCESS_TOKEN_SECRET: %w", err)
+			}
+			if err := jwtauth.CheckHMACSecret(cfg.REFRESH_TOKEN_SECRET); err != nil {
+				return nil, nil, fmt.Errorf("REFRESH_TOKEN_SECRET: %w", err)
+			}
+		}
+		accessTokens, err := jwtauth.NewHMACIssuer(jwtauth.TypeAccess, accessTTL, cfg.ACCESS_TOKEN_SECRET)
+		if err != nil {
+			return nil, nil, err
+		}
+		refreshTokens, err := jwtauth.NewHMACIssuer(jwtauth.TypeRefresh, refreshTTL, cfg.REFRESH_TOKEN_SECRET)
+		if err != nil {
+			return nil, nil, err
+		}
+		return accessTokens, refreshTokens, nil
+	case jwtauth.AlgorithmEdDSA:
+		accessTokens, err := jwtauth.NewEdDSAIssuer(jwtauth.TypeAccess, accessTTL, cfg.JWT_ED25519_SEED)
+		if err != nil {
+			return nil, nil, err
+		}
+		refreshTokens, err := jwtauth.NewEdDSAIssuer(jwtauth.TypeRefresh, refreshTTL, cfg.JWT_ED25519_SEED)
+		if err != nil {
+			return nil, nil, err
+		}
+		return accessTokens, refreshTokens, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown JWT_ALGORITHM %q", cfg.JWT_ALGORITHM)
+	}
+}
+
+// newIdentityProvider returns the identity provider selected by IDENTITY_PROVIDER.
+// "jwt" only accepts the access tokens we issue, "firebase" additionally accepts
+// Firebase ID tokens and creates users in Firebase, and "fake" keeps users and tokens
+// in memory so the API can run fully offline.
+func newIdentityProvider(cfg *configs.Config, accessTokens *jwtauth.Issuer) (identity.Provider, error) {
+	firstParty := identity.NewJWT(accessTokens)
+
+	switch cfg.IDENTITY_PROVIDER {
+	case "jwt":
+		return firstParty, nil
+	case "firebase":
+		opt := option.WithCredentialsFile(cfg.FIREBASE_CONFIG)
+		firebaseApp, err := firebase.NewApp(context.Background(), nil, opt)
+		if err != nil {
+			return nil, err
+		}
+		firebaseClient, err := firebaseApp.Auth(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("error getting Auth client: %w", err)
+		}
+		return identity.Chain(identity.NewFirebase(firebaseClient), firstParty), nil
+	case "fake":
+		return identity.Chain(identity.NewFake(), firstParty), nil
+	default:
+		return nil, fmt.Errorf("unknown IDENTITY_PROVIDER %q", cfg.IDENTITY_PROVIDER)
+	}
+}
+
+// newOIDCRegistry returns the login providers listed in OIDC_PROVIDERS. Providers
+// with a preset (google, microsoft, apple, github) only need their client credentials;
+// any other name is treated as a generic OpenID Connect issuer.
+func newOIDCRegistry(cfg *configs.Config) (oidc.Registry, error) {
+	registry := oidc.Registry{}
+	for _, provider := range cfg.OIDCProviders {
+		config := oidc.WithPreset(oidc.ProviderConfig{
+			Name:         provider.Name,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+			Issuer:       provider.Issuer,
+		})
+
+		// Providers that POST the result of the login cannot be sent to the
+		// frontend directly, only to the API, which hands the result on.
+		if config.ResponseMode == oidc.ResponseModeFormPost && config.RedirectURL == cfg.OIDCCallbackURL(provider.Name) {
+			return nil, fmt.Errorf("OIDC_%s_REDIRECT_URL must be the URL of the API's /auth/oidc/%s/form_post", strings.ToUpper(provider.Name), provider.Name)
+		}
+
+		registry[provider.Name] = oidc.NewProvider(config, nil)
+	}
+	return registry, nil
+}
+
+// newRateLimiter returns the limiter for the RATE_LIMIT_* policies. "memory" keeps
+// the buckets in this process, "postgres" shares them between all instances.
+func newRateLimiter(cfg *configs.Config, db *sql.DB) (*ratelimit.Limiter, error) {
+	limits := map[string]ratelimit.Limit{}
+	if cfg.RATE_LIMIT_ENABLED {
+		for name, value := range map[string]string{
+			rateLimitGlobal: cfg.RATE_LIMIT_GLOBAL,
+			rateLimitAuth:   cfg.RATE_LIMIT_AUTH,
+			rateLimitLookup: cfg.RATE_LIMIT_LOOKUP,
+			rateLimitWrite:  cfg.RATE_LIMIT_WRITE,
+		} {
+			limit, err := ratelimit.ParseLimit(value)
+			if err != nil {
+				return nil, err
+			}
+			limits[name] = limit
+		}
+	}
+
+	switch cfg.RATE_LIMIT_BACKEND {
+	case "memory", "":
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limits), nil
+	case "postgres":
+		return ratelimit.NewLimiter(ratelimit.NewPostgresStore(db), limits), nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_BACKEND %q", cfg.RATE_LIMIT_BACKEND)
+	}
+}
+
+func newCleanupConfig(cfg *configs.Config) (cleanupConfig, error) {
+	unactivatedTTL, err := time.ParseDuration(cfg.CLEANUP_UNACTIVATED_TTL)
+	if err != nil {
+		return cleanupConfig{}, err
+	}
+	expiredTTL, err := time.ParseDuration(cfg.CLEANUP_EXPIRED_TTL)
+	if err != nil {
+		return cleanupConfig{}, err
+	}
+	return cleanupConfig{unactivatedTTL: unactivatedTTL, expiredTTL: expiredTTL}, nil
+}
+
+// newScheduler returns the job scheduler selected by SCHEDULER_BACKEND. "postgres"
+// lets instances sharing the database take turns through advisory locks, "memory"
+// is for a single instance.
+func newScheduler(cfg *configs.Config, db *sql.DB, logger *leveledlog.Logger) (*scheduler.Scheduler, error) {
+	switch cfg.SCHEDULER_BACKEND {
+	case "postgres", "":
+		instance, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		return scheduler.New(scheduler.NewPostgresStore(db, instance), logger), nil
+	case "memory":
+		return scheduler.New(scheduler.NewMemoryStore(), logger), nil
+	default:
+		return nil, fmt.Errorf("unknown SCHEDULER_BACKEND %q", cfg.SCHEDULER_BACKEND)
+	}
+}
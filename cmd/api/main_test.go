@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/configs"
+	"offerland.cc/internal/leveledlog"
+	"offerland.cc/internal/ratelimit"
+)
+
+// newTestRouter returns the router of app after filling in what every test needs
+// the same way: a config unless the test set one, a silent logger and a rate
+// limiter without limits.
+func newTestRouter(t *testing.T, app *application) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	if app.config == nil {
+		app.config = &configs.Config{FRONTEND_URL: "http://localhost:3000"}
+	}
+	app.logger = leveledlog.NewLogger(io.Discard, leveledlog.LevelAll, false)
+	app.limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil)
+
+	router, err := app.SetupRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
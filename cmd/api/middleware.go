@@ -2,10 +2,14 @@ package main
 
 import (
 	"errors"
-	"log"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"offerland.cc/internal/identity"
 	"offerland.cc/internal/models"
 )
 
@@ -21,13 +25,38 @@ func (app *application) authenticate(c *gin.Context) {
 		return
 	}
 	accessToken := headerParts[1]
-	token, err := app.firebaseClient.VerifyIDToken(c, accessToken)
+
+	verified, err := app.identity.VerifyToken(c, accessToken)
 	if err != nil {
-		log.Fatalf("error verifying ID token: %v\n", err)
+		switch {
+		case errors.Is(err, identity.ErrInvalidToken):
+			app.invalidAuthenticationToken(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		c.Abort()
+		return
+	}
+
+	// First-party access tokens die with their session, so that revoking a session
+	// logs the device out immediately instead of when the access token expires.
+	if verified.SessionID != "" {
+		sessionID, active, err := app.sessionActive(verified)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			c.Abort()
+			return
+		}
+		if !active {
+			app.invalidAuthenticationToken(c.Writer, c.Request)
+			c.Abort()
+			return
+		}
+		app.contextSetSession(c, sessionID)
 	}
 
 	// Lookup the user record from the database.
-	user, err := app.models.Users.Get(token.UID)
+	user, err := app.models.Users.Get(verified.UID)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
@@ -35,9 +64,141 @@ func (app *application) authenticate(c *gin.Context) {
 		default:
 			app.serverError(c.Writer, c.Request, err)
 		}
+		c.Abort()
+		return
+	}
+	// Disabled accounts are refused even with a token issued before they were disabled,
+	// such as a Firebase ID token.
+	if user.DisabledAt != nil {
+		app.accountDisabled(c.Writer, c.Request)
+		c.Abort()
+		return
+	}
+	// Accounts waiting to be deleted are signed out until the user signs in again.
+	if user.DeletionScheduledAt != nil {
+		app.accountPendingDeletion(c.Writer, c.Request)
+		c.Abort()
 		return
 	}
 	// Add the user record to the request context and continue as normal
 	app.contextSetUser(c, user)
 	c.Next()
 }
+
+// sessionActive reports whether the session an access token was issued for still
+// exists.
+func (app *application) sessionActive(verified *identity.Identity) (uuid.UUID, bool, error) {
+	sessionID, err := uuid.Parse(verified.SessionID)
+	if err != nil {
+		return uuid.Nil, false, nil
+	}
+
+	active, err := app.models.Sessions.Exists(sessionID, verified.UID)
+	return sessionID, active, err
+}
+
+// requireAuthenticatedUser rejects requests that authenticate did not attach a user
+// to. It must run after authenticate.
+func (app *application) requireAuthenticatedUser(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+	if user == nil || user.IsAnonymous() {
+		app.invalidAuthenticationToken(c.Writer, c.Request)
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// requireStepUp guards sensitive actions: the user must have logged in or confirmed
+// their identity through /me/step-up within the last stepUpWindow. It must run after
+// requireAuthenticatedUser.
+func (app *application) requireStepUp(c *gin.Context) {
+	sessionID, ok := app.contextGetSession(c.Request)
+	if !ok {
+		app.stepUpRequired(c.Writer, c.Request)
+		c.Abort()
+		return
+	}
+
+	authenticated, err := app.models.Sessions.AuthenticatedSince(sessionID, time.Now().Add(-stepUpWindow))
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		c.Abort()
+		return
+	}
+	if !authenticated {
+		app.stepUpRequired(c.Writer, c.Request)
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// requirePermission returns a middleware that only lets users with the permission
+// code through. It must run after requireAuthenticatedUser.
+func (app *application) requirePermission(code string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := app.contextGetUser(c.Request)
+
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			c.Abort()
+			return
+		}
+		if !permissions.Include(code) {
+			app.notPermitted(c.Writer, c.Request)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Names of the rate limits configured by RATE_LIMIT_*.
+const (
+	rateLimitGlobal = "global"
+	rateLimitAuth   = "auth"
+	rateLimitLookup = "lookup"
+	rateLimitWrite  = "write"
+)
+
+// rateLimit returns a middleware that counts every request against the named limit.
+// Requests are keyed by the authenticated user when there is one, so it should run
+// after authenticate on routes that authenticate, and by client address otherwise.
+// If the limiter fails the request is let through, as an outage of the store must
+// not take the API down with it.
+func (app *application) rateLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if user := app.contextGetUser(c.Request); user != nil && !user.IsAnonymous() {
+			key = "user:" + user.ID
+		}
+
+		result, ok, err := app.limiter.Allow(c.Request.Context(), name, key)
+		if err != nil {
+			app.logger.Error(err)
+			c.Next()
+			return
+		}
+		if !ok {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+		if !result.Allowed {
+			app.rateLimitExceeded(c.Writer, c.Request, result.RetryAfter)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/identity"
+	"offerland.cc/internal/leveledlog"
+	"offerland.cc/internal/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Now()
+	users := map[string]*models.User{
+		"active":   {ID: "active", Username: "ada", Email: "ada@example.com", Activated: true, Locale: "en"},
+		"disabled": {ID: "disabled", Username: "bob", Email: "bob@example.com", Activated: true, Locale: "en", DisabledAt: &now},
+		"leaving":  {ID: "leaving", Username: "cy", Email: "cy@example.com", Activated: true, Locale: "en", DeletionScheduledAt: &now},
+		"blocked":  {ID: "blocked", Username: "di", Email: "di@example.com", Activated: true, Locale: "en"},
+	}
+
+	tdb, db := newTestDB(t)
+	tdb.handle("FROM users WHERE user_id = $1", func(args []driver.Value) (*testRows, error) {
+		return userRows(users[args[0].(string)]), nil
+	})
+
+	fake := identity.NewFake()
+	_, err := fake.CreateUser(context.Background(), &identity.UserToCreate{UID: "blocked", Email: "di@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fake.DisableUser(context.Background(), "blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		identity: fake,
+		models:   models.NewModels(db),
+		logger:   leveledlog.NewLogger(io.Discard, leveledlog.LevelAll, false),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", app.authenticate, func(c *gin.Context) {
+		user := app.contextGetUser(c.Request)
+		if user.IsAnonymous() {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, user.ID)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantBody      string
+	}{
+		{"no token", "", http.StatusOK, "anonymous"},
+		{"not a bearer token", "Basic " + fake.IssueToken("active"), http.StatusOK, "anonymous"},
+		{"unknown token", "Bearer not-a-token", http.StatusUnauthorized, ""},
+		{"active user", "Bearer " + fake.IssueToken("active"), http.StatusOK, "active"},
+		{"user not in the database", "Bearer " + fake.IssueToken("unknown"), http.StatusUnauthorized, ""},
+		{"disabled account", "Bearer " + fake.IssueToken("disabled"), http.StatusForbidden, ""},
+		{"account waiting to be deleted", "Bearer " + fake.IssueToken("leaving"), http.StatusUnauthorized, ""},
+		{"disabled at the identity provider", "Bearer " + fake.IssueToken("blocked"), http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rr.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"offerland.cc/configs"
+	"offerland.cc/internal/database"
+)
+
+const migrateUsage = `usage: api migrate <command> [-json]
+
+commands:
+  up        apply all pending migrations
+  down N    roll back the N most recently applied migrations
+  status    list migrations and whether they are applied`
+
+// runMigrate implements the migrate subcommand, which manages the schema with the
+// migrations embedded in the binary instead of starting the server.
+func runMigrate(cfg *configs.Config, args []string) error {
+	command, args, err := database.ParseMigrateCommand(args)
+	if err != nil {
+		return fmt.Errorf("%s\n\n%s", err, migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate "+command.Name, flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON instead of text")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Never migrate implicitly here, or "down" would first apply everything.
+	db, err := database.New(cfg.DB_DSN, false, cfg.DB_MAX_OPEN_CONNS, cfg.DB_MAX_IDLE_CONNS, cfg.DB_MAX_IDLE_TIME)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := database.RunMigrateCommand(db, command)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(result.JSON())
+	}
+	return result.WriteText(os.Stdout)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/oidc"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+// oidcStateTTL is how long a user has to complete the login at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStart begins a login with an external provider. The state, nonce and PKCE
+// verifier are kept on the server; the client only gets the URL to send the user to.
+func (app *application) oidcStart(c *gin.Context) {
+	provider, err := app.oidc.Get(c.Param("provider"))
+	if err != nil {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	app.authorizeWithProvider(c, provider, "")
+}
+
+// authorizeWithProvider records a new authorization request for provider and
+// responds with the provider's consent URL. userID is set when the resulting
+// account is to be linked to a logged-in user rather than signed in with.
+func (app *application) authorizeWithProvider(c *gin.Context, provider *oidc.Provider, userID string) {
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	codeVerifier, codeChallenge, err := oidc.NewPKCE()
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.Identities.InsertState(&models.OIDCState{
+		Plaintext:    state,
+		Provider:     provider.Name(),
+		UserID:       userID,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		Expiry:       time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(c, state, nonce, codeChallenge)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"authorization_url": authorizationURL})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// oidcCallback completes a login with an external provider. The user linked to the
+// provider account is signed in; if there is none, a new account is created, unless
+// the email address already belongs to another account.
+func (app *application) oidcCallback(c *gin.Context) {
+	provider, err := app.oidc.Get(c.Param("provider"))
+	if err != nil {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	claims, ok := app.providerClaims(c, provider, "")
+	if !ok {
+		return
+	}
+
+	userID, err := app.models.Identities.GetUserID(provider.Name(), claims.Subject)
+	switch {
+	case err == nil:
+		user, err := app.models.Users.Get(userID)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+		app.completeLogin(c, user, http.StatusOK)
+		return
+	case !errors.Is(err, models.ErrRecordNotFound):
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	// Only sign up with addresses the provider has verified, otherwise anyone could
+	// claim someone else's email address at a lax provider.
+	if claims.Email == "" || !claims.EmailVerified {
+		app.unverifiedProviderEmail(c.Writer, c.Request)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		app.identityEmailConflict(c.Writer, c.Request)
+		return
+	case !errors.Is(err, models.ErrRecordNotFound):
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	username := claims.Name
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Email:     claims.Email,
+		Activated: true,
+		Locale:    app.requestLocale(c.Request),
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			app.identityEmailConflict(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = app.models.Identities.Insert(&models.Identity{
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	// Add the "posts:read" permission for the new user.
+	err = app.models.Permissions.AddForUser(user.ID, "posts:read")
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	app.startSession(c, user, http.StatusCreated)
+}
+
+// oidcFormPost receives the result of a login from providers that POST it to their
+// redirect URL (response_mode=form_post), such as Apple, and sends the browser on to
+// the frontend's callback page with it in the query. The login then completes at
+// oidcCallback as with any other provider.
+func (app *application) oidcFormPost(c *gin.Context) {
+	provider, err := app.oidc.Get(c.Param("provider"))
+	if err != nil || provider.ResponseMode() != oidc.ResponseModeFormPost {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 1_048_576)
+	err = c.Request.ParseForm()
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	query := url.Values{}
+	for _, name := range []string{"code", "state", "error"} {
+		if value := c.Request.PostForm.Get(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	callbackURL := app.config.OIDCCallbackURL(provider.Name()) + "?" + query.Encode()
+	http.Redirect(c.Writer, c.Request, callbackURL, http.StatusSeeOther)
+}
+
+// providerClaims redeems the code and state the provider redirected back with and
+// returns the verified claims. On failure it writes the error response and returns
+// false.
+func (app *application) providerClaims(c *gin.Context, provider *oidc.Provider, userID string) (*oidc.Claims, bool) {
+	var input struct {
+		Code      string              `json:"code"`
+		State     string              `json:"state"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return nil, false
+	}
+
+	input.Validator.CheckField(input.Code != "", "code", "Code is required")
+	input.Validator.CheckField(input.State != "", "state", "State is required")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return nil, false
+	}
+
+	state, err := app.models.Identities.ConsumeState(provider.Name(), input.State, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.invalidLoginState(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return nil, false
+	}
+
+	claims, err := provider.Exchange(c, input.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrNoEmail):
+			app.unverifiedProviderEmail(c.Writer, c.Request)
+		default:
+			app.logger.Warning("oidc: %s login failed: %v", provider.Name(), err)
+			app.invalidAuthenticationToken(c.Writer, c.Request)
+		}
+		return nil, false
+	}
+
+	return claims, true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"offerland.cc/internal/oidc"
+	"offerland.cc/internal/oidc/oidctest"
+)
+
+// TestOIDCFormPost plays a login with Apple's settings: the issuer posts the code
+// and state to the API, which must send the browser on to the frontend with them.
+func TestOIDCFormPost(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("offerland-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+	issuer.RequireFormPost = true
+
+	provider := oidc.NewProvider(oidc.WithPreset(oidc.ProviderConfig{
+		Name:        "apple",
+		ClientID:    "offerland-test",
+		RedirectURL: "https://api.offerland.cc/auth/oidc/apple/form_post",
+		Issuer:      issuer.URL,
+	}), nil)
+	router := newTestRouter(t, &application{oidc: oidc.Registry{"apple": provider}})
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	action, form, err := issuer.FormPost(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionURL, err := url.Parse(action)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, actionURL.Path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusSeeOther)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := location.Scheme+"://"+location.Host+location.Path, "http://localhost:3000/auth/callback/apple"; got != want {
+		t.Errorf("redirected to %s, want %s", got, want)
+	}
+	if location.Query().Get("code") != form.Get("code") || location.Query().Get("state") != "the-state" {
+		t.Errorf("redirect query = %v, want the code and state of %v", location.Query(), form)
+	}
+}
+
+func TestOIDCFormPostRejectsRedirectProviders(t *testing.T) {
+	provider := oidc.NewProvider(oidc.WithPreset(oidc.ProviderConfig{Name: "google"}), nil)
+	router := newTestRouter(t, &application{oidc: oidc.Registry{"google": provider}})
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/oidc/google/form_post", strings.NewReader("code=c&state=s"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	loginTokenTTL         = 10 * time.Minute
+	loginTokenMaxAttempts = 5
+)
+
+// requestLoginCode emails a one-time passcode and a magic link for signing in
+// without a password. The response looks the same whether or not the email address
+// belongs to an account, so it cannot be used to find out who has one.
+func (app *application) requestLoginCode(c *gin.Context) {
+	var input struct {
+		Email     string              `json:"email"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.Validator.CheckField(validator.Matches(input.Email, validator.RgxEmail), "email", "Must be a valid email address")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	accountKey, ipKey := loginCodeAccountKey(input.Email), loginCodeIPKey(c)
+	if app.throttled(c, accountKey, ipKey) {
+		return
+	}
+	app.recordFailure(c, "", accountKey, ipKey)
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	if user == nil || !user.Activated {
+		decoy, err := decoyToken()
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+
+		err = response.JSON(c.Writer, http.StatusAccepted, envelope{"login_token": decoy, "expiry": time.Now().Add(loginTokenTTL)})
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	token, err := app.models.Tokens.NewLoginToken(user.ID, loginTokenTTL)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"username":  user.Username,
+			"passcode":  token.Passcode,
+			"loginLink": fmt.Sprintf("%s/login/magic/%s?passcode=%s", app.config.FRONTEND_URL, token.Plaintext, token.Passcode),
+			"minutes":   int(loginTokenTTL.Minutes()),
+		}
+
+		err := app.mailer.SendLocalized(user.Email, user.Locale, data, "user_login.tmpl")
+		if err != nil {
+			app.logger.Error(err)
+		}
+	})
+
+	err = response.JSON(c.Writer, http.StatusAccepted, envelope{"login_token": token.Plaintext, "expiry": token.Expiry})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// verifyLoginCode exchanges a login token and its passcode, typed in by the user or
+// taken from the magic link, for a session.
+func (app *application) verifyLoginCode(c *gin.Context) {
+	var input struct {
+		TokenPlaintext string              `json:"login_token"`
+		Passcode       string              `json:"passcode"`
+		Validator      validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.Validator.CheckField(input.TokenPlaintext != "", "login_token", "Token is required")
+	input.Validator.CheckField(len(input.TokenPlaintext) == 26, "login_token", "must be 26 bytes long")
+	input.Validator.CheckField(len(input.Passcode) == 6, "passcode", "must be 6 bytes long")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	ipKey := passcodeIPKey(c)
+	if app.throttled(c, ipKey) {
+		return
+	}
+
+	userID, err := app.models.Tokens.ConsumeLoginToken(input.TokenPlaintext, input.Passcode, loginTokenMaxAttempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailure(c, "", ipKey)
+			input.Validator.AddFieldError("passcode", "invalid or expired passcode")
+			app.failedValidation(c.Writer, c.Request, input.Validator)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.audit(c, user.ID, "login.success", map[string]any{"method": "passwordless"})
+
+	app.completeLogin(c, user, http.StatusOK)
+}
+
+// decoyToken returns a random value shaped like a login token.
+func decoyToken() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
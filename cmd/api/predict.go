@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/catalog"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/predict"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/similarity"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	// maxPredictionCases bounds the past decisions a prediction is made from, the most
+	// recent ones, since calibrating it compares every pair of them.
+	maxPredictionCases = 2000
+
+	// maxComparables is the number of comparable cases shown with a prediction.
+	maxComparables = 10
+)
+
+// A comparableCase is a past decision of the program on an applicant similar to the
+// one a prediction is for, with the background generalized like in exports.
+type comparableCase struct {
+	Similarity          float64  `json:"similarity"`
+	Status              string   `json:"status"`
+	GPA                 *float64 `json:"gpa"`
+	GREVerbal           *int     `json:"gre_verbal"`
+	GREQuant            *int     `json:"gre_quant"`
+	TOEFL               *int     `json:"toefl"`
+	IELTS               *float64 `json:"ielts"`
+	WorkExperienceYears *int     `json:"work_experience_years"`
+	Publications        *int     `json:"publications"`
+	Suppression         string   `json:"suppression"`
+}
+
+type predictionInterval struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Level float64 `json:"level"`
+}
+
+type predictionResponse struct {
+	Program        *models.Program    `json:"program"`
+	Probability    float64            `json:"probability"`
+	Interval       predictionInterval `json:"interval"`
+	BaseRate       float64            `json:"base_rate"`
+	Cases          int                `json:"cases"`
+	EffectiveCases float64            `json:"effective_cases"`
+	Calibrated     bool               `json:"calibrated"`
+	BrierScore     float64            `json:"brier_score"`
+	Comparables    []comparableCase   `json:"comparables"`
+}
+
+// predictAdmission estimates the chance of admission to a program of an applicant,
+// from the decisions the program gave to past applicants with similar backgrounds.
+// The applicant is described by the profile in the request, or else by the saved
+// profile of the user.
+//
+// Comparable cases are only shown for decisions the program gave to at least
+// EXPORT_MIN_GROUP_SIZE applicants with a profile, so that they cannot be matched to
+// the public results of the one applicant the program admitted or rejected, and their
+// backgrounds are suppressed like in exports, see suppressComparables.
+func (app *application) predictAdmission(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		programInput
+		Profile   *applicantProfileInput `json:"profile"`
+		Validator validator.Validator    `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	v := &input.Validator
+	input.programInput.validate(v)
+	if input.Profile != nil {
+		input.Profile.validate(v, "profile.")
+	}
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, *v)
+		return
+	}
+
+	var profile *models.ApplicantProfile
+	if input.Profile != nil {
+		profile = input.Profile.profile(user.ID)
+		err = app.resolveUndergradSchool(profile)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+	} else {
+		profile, err = app.models.Profiles.Get(user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddFieldError("profile", "Profile is required")
+				app.failedValidation(c.Writer, c.Request, *v)
+			default:
+				app.serverError(c.Writer, c.Request, err)
+			}
+			return
+		}
+	}
+
+	query := similarityProfile(profile)
+	if query == (similarity.Profile{}) {
+		v.AddFieldError("profile", "Profile must have at least one score or background field")
+		app.failedValidation(c.Writer, c.Request, *v)
+		return
+	}
+
+	program, err := app.resolveProgram(input.programInput)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	programCases, err := app.models.Results.GetProgramCases(*program, user.ID, maxPredictionCases)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	cases := make([]predict.Case, len(programCases))
+	statusCounts := map[string]int{}
+	for i, pc := range programCases {
+		cases[i] = predict.Case{Profile: similarityProfile(&pc.Profile), Admitted: pc.Status == "admitted"}
+		statusCounts[pc.Status]++
+	}
+
+	prediction, err := predict.Predict(query, cases)
+	if err != nil {
+		switch {
+		case errors.Is(err, predict.ErrNotEnoughCases):
+			app.notEnoughPredictionData(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	generalized := make([]comparableCase, len(programCases))
+	for i, pc := range programCases {
+		generalized[i] = newComparableCase(pc)
+	}
+	suppressComparables(generalized, app.config.EXPORT_MIN_GROUP_SIZE)
+
+	comparables := []comparableCase{}
+	for _, n := range prediction.Neighbors {
+		if len(comparables) == maxComparables {
+			break
+		}
+		if statusCounts[programCases[n.Index].Status] < app.config.EXPORT_MIN_GROUP_SIZE {
+			continue
+		}
+		comparable := generalized[n.Index]
+		comparable.Similarity = round3(similarity.Score(n.Distance))
+		comparables = append(comparables, comparable)
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"prediction": predictionResponse{
+		Program:     program,
+		Probability: round3(prediction.Probability),
+		Interval: predictionInterval{
+			Low:   round3(prediction.Low),
+			High:  round3(prediction.High),
+			Level: 0.95,
+		},
+		BaseRate:       round3(prediction.BaseRate),
+		Cases:          prediction.Cases,
+		EffectiveCases: round3(prediction.EffectiveCases),
+		Calibrated:     prediction.Calibrated,
+		BrierScore:     round3(prediction.BrierScore),
+		Comparables:    comparables,
+	}})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// similarityProfile returns the features applicants are compared on from a profile.
+func similarityProfile(p *models.ApplicantProfile) similarity.Profile {
+	profile := similarity.Profile{
+		GPA:                  p.GPA4(),
+		GREVerbal:            floatValue(p.GREVerbal),
+		GREQuant:             floatValue(p.GREQuant),
+		GREWriting:           p.GREWriting,
+		TOEFL:                floatValue(p.TOEFL),
+		IELTS:                p.IELTS,
+		WorkExperienceMonths: floatValue(p.WorkExperienceMonths),
+		Publications:         floatValue(p.Publications),
+	}
+	switch {
+	case p.UndergradSchoolID != nil:
+		profile.UndergradSchool = p.UndergradSchoolID.String()
+	case p.UndergradSchool != nil:
+		profile.UndergradSchool = catalog.Normalize(*p.UndergradSchool)
+	}
+	if p.UndergradMajor != nil {
+		profile.UndergradMajor = catalog.Normalize(*p.UndergradMajor)
+	}
+	if p.Country != nil {
+		profile.Country = strings.ToUpper(*p.Country)
+	}
+	return profile
+}
+
+func floatValue(n *int) *float64 {
+	if n == nil {
+		return nil
+	}
+	f := float64(*n)
+	return &f
+}
+
+// newComparableCase generalizes the background of a case like exports do: the GPA to
+// bands of 0.2 on a 4.0 scale, GRE and TOEFL scores to bands of 5, IELTS to whole
+// bands, work experience to whole years and publications capped at 5.
+func newComparableCase(pc *models.ProgramCase) comparableCase {
+	c := comparableCase{
+		Status:      pc.Status,
+		GREVerbal:   band(pc.Profile.GREVerbal, 5),
+		GREQuant:    band(pc.Profile.GREQuant, 5),
+		TOEFL:       band(pc.Profile.TOEFL, 5),
+		Suppression: models.SuppressionNone,
+	}
+	if gpa := pc.Profile.GPA4(); gpa != nil {
+		banded := math.Floor(*gpa*5+1e-9) / 5
+		c.GPA = &banded
+	}
+	if ielts := pc.Profile.IELTS; ielts != nil {
+		banded := math.Floor(*ielts)
+		c.IELTS = &banded
+	}
+	if months := pc.Profile.WorkExperienceMonths; months != nil {
+		years := *months / 12
+		c.WorkExperienceYears = &years
+	}
+	if n := pc.Profile.Publications; n != nil {
+		capped := *n
+		if capped > 5 {
+			capped = 5
+		}
+		c.Publications = &capped
+	}
+	return c
+}
+
+// suppressComparables applies the k-anonymity of ResultModel.Export to generalized
+// cases of one program. A case whose status and background are shared by fewer than k
+// cases keeps only its GPA, GRE verbal and quantitative and TOEFL bands, if those are
+// shared by enough cases, and otherwise loses its background entirely.
+func suppressComparables(cases []comparableCase, k int) {
+	fullKey := func(c *comparableCase) string {
+		return fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s", c.Status,
+			optionalKey(c.GPA), optionalKey(c.GREVerbal), optionalKey(c.GREQuant), optionalKey(c.TOEFL),
+			optionalKey(c.IELTS), optionalKey(c.WorkExperienceYears), optionalKey(c.Publications))
+	}
+	coarseKey := func(c *comparableCase) string {
+		return fmt.Sprintf("%s|%s|%s|%s|%s", c.Status,
+			optionalKey(c.GPA), optionalKey(c.GREVerbal), optionalKey(c.GREQuant), optionalKey(c.TOEFL))
+	}
+
+	fullGroups, coarseGroups := map[string]int{}, map[string]int{}
+	for i := range cases {
+		fullGroups[fullKey(&cases[i])]++
+		coarseGroups[coarseKey(&cases[i])]++
+	}
+
+	for i := range cases {
+		c := &cases[i]
+		full, coarse := fullGroups[fullKey(c)], coarseGroups[coarseKey(c)]
+		if full < k {
+			c.Suppression = models.SuppressionBackground
+			c.IELTS, c.WorkExperienceYears, c.Publications = nil, nil, nil
+		}
+		if coarse < k {
+			c.Suppression = models.SuppressionProfile
+			c.GPA, c.GREVerbal, c.GREQuant, c.TOEFL = nil, nil, nil, nil
+		}
+	}
+}
+
+func optionalKey[T int | float64](v *T) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(*v)
+}
+
+// band rounds a score down to a multiple of width.
+func band(score *int, width int) *int {
+	if score == nil {
+		return nil
+	}
+	banded := *score / width * width
+	return &banded
+}
+
+func round3(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/validator"
+)
+
+// getApplicantProfile returns the academic background of the user.
+func (app *application) getApplicantProfile(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	profile, err := app.models.Profiles.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"profile": profile})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// applicantProfileInput is an academic background as clients send it, to save as
+// their profile or to predict with.
+type applicantProfileInput struct {
+	GPA                  *float64 `json:"gpa"`
+	GPAScale             *float64 `json:"gpa_scale"`
+	GREVerbal            *int     `json:"gre_verbal"`
+	GREQuant             *int     `json:"gre_quant"`
+	GREWriting           *float64 `json:"gre_writing"`
+	TOEFL                *int     `json:"toefl"`
+	IELTS                *float64 `json:"ielts"`
+	UndergradSchool      *string  `json:"undergrad_school"`
+	UndergradMajor       *string  `json:"undergrad_major"`
+	GraduationYear       *int     `json:"graduation_year"`
+	Country              *string  `json:"country"`
+	WorkExperienceMonths *int     `json:"work_experience_months"`
+	Publications         *int     `json:"publications"`
+}
+
+// validate checks the input and normalizes its text fields. Errors are reported under
+// the JSON field names, after prefix.
+func (input *applicantProfileInput) validate(v *validator.Validator, prefix string) {
+	if input.GPA != nil || input.GPAScale != nil {
+		v.CheckField(input.GPA != nil && input.GPAScale != nil, prefix+"gpa", "GPA and GPA scale must be given together")
+	}
+	if input.GPAScale != nil {
+		v.CheckField(*input.GPAScale > 0 && *input.GPAScale <= 100, prefix+"gpa_scale", "GPA scale must be between 0 and 100")
+		if input.GPA != nil {
+			v.CheckField(validator.Between(*input.GPA, 0, *input.GPAScale), prefix+"gpa", "GPA must be between 0 and the GPA scale")
+		}
+	}
+	checkOptionalRange(v, input.GREVerbal, 130, 170, prefix+"gre_verbal", "GRE scores must be between 130 and 170")
+	checkOptionalRange(v, input.GREQuant, 130, 170, prefix+"gre_quant", "GRE scores must be between 130 and 170")
+	if input.GREWriting != nil {
+		v.CheckField(isHalfStep(*input.GREWriting, 6), prefix+"gre_writing", "Must be between 0 and 6 in steps of 0.5")
+	}
+	checkOptionalRange(v, input.TOEFL, 0, 120, prefix+"toefl", "TOEFL scores must be between 0 and 120")
+	if input.IELTS != nil {
+		v.CheckField(isHalfStep(*input.IELTS, 9), prefix+"ielts", "Must be between 0 and 9 in steps of 0.5")
+	}
+	input.UndergradSchool = trimOptional(input.UndergradSchool)
+	input.UndergradMajor = trimOptional(input.UndergradMajor)
+	if input.UndergradSchool != nil {
+		v.CheckField(validator.MaxRunes(*input.UndergradSchool, 255), prefix+"undergrad_school", "Must be at most 255 characters")
+	}
+	if input.UndergradMajor != nil {
+		v.CheckField(validator.MaxRunes(*input.UndergradMajor, 255), prefix+"undergrad_major", "Must be at most 255 characters")
+	}
+	checkOptionalRange(v, input.GraduationYear, 1950, time.Now().Year()+10, prefix+"graduation_year", "Graduation year is out of range")
+	input.Country = trimOptional(input.Country)
+	if input.Country != nil {
+		country := strings.ToUpper(*input.Country)
+		v.CheckField(validator.Matches(country, validator.RgxCountryCode), prefix+"country", "Country must be a two-letter ISO 3166 code")
+		input.Country = &country
+	}
+	checkOptionalRange(v, input.WorkExperienceMonths, 0, 600, prefix+"work_experience_months", "Work experience must be between 0 and 600 months")
+	checkOptionalRange(v, input.Publications, 0, 1000, prefix+"publications", "Publications must be between 0 and 1000")
+}
+
+func (input *applicantProfileInput) profile(userID string) *models.ApplicantProfile {
+	return &models.ApplicantProfile{
+		UserID:               userID,
+		GPA:                  input.GPA,
+		GPAScale:             input.GPAScale,
+		GREVerbal:            input.GREVerbal,
+		GREQuant:             input.GREQuant,
+		GREWriting:           input.GREWriting,
+		TOEFL:                input.TOEFL,
+		IELTS:                input.IELTS,
+		UndergradSchool:      input.UndergradSchool,
+		UndergradMajor:       input.UndergradMajor,
+		GraduationYear:       input.GraduationYear,
+		Country:              input.Country,
+		WorkExperienceMonths: input.WorkExperienceMonths,
+		Publications:         input.Publications,
+	}
+}
+
+// resolveUndergradSchool looks the undergraduate school of a profile up in the
+// catalog like the schools of results, leaving it as typed when it is not there.
+func (app *application) resolveUndergradSchool(profile *models.ApplicantProfile) error {
+	if profile.UndergradSchool == nil {
+		return nil
+	}
+	school, err := app.models.Catalog.ResolveSchool(*profile.UndergradSchool)
+	switch {
+	case err == nil:
+		profile.UndergradSchoolID = &school.ID
+		profile.UndergradSchool = &school.Name
+	case !errors.Is(err, models.ErrRecordNotFound):
+		return err
+	}
+	return nil
+}
+
+// putApplicantProfile replaces the academic background of the user. Fields left out
+// are cleared, and the profile is private unless public is true.
+func (app *application) putApplicantProfile(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		applicantProfileInput
+		Public    bool                `json:"public"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.validate(&input.Validator, "")
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	profile := input.profile(user.ID)
+	profile.Public = input.Public
+	err = app.resolveUndergradSchool(profile)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.Profiles.Put(profile)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"profile": profile})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// deleteApplicantProfile clears the academic background of the user.
+func (app *application) deleteApplicantProfile(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	err := app.models.Profiles.Delete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func checkOptionalRange(v *validator.Validator, value *int, min, max int, key, message string) {
+	if value != nil {
+		v.CheckField(validator.Between(*value, min, max), key, message)
+	}
+}
+
+// isHalfStep reports whether score is between 0 and max in steps of 0.5, like GRE
+// writing and IELTS band scores.
+func isHalfStep(score, max float64) bool {
+	return score >= 0 && score <= max && math.Mod(score*2, 1) == 0
+}
+
+// trimOptional trims a string field, and treats a blank one as not given.
+func trimOptional(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/timeline"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	// timelineCycles is the number of past cycles a timeline goes back.
+	timelineCycles = 10
+
+	defaultRecentDays     = 7
+	maxRecentDays         = 30
+	defaultRecentPrograms = 20
+	maxRecentPrograms     = 100
+)
+
+// programInput names a program, by the ID of its major in the catalog, or by its
+// school, as an ID or a name, and the name of its major.
+type programInput struct {
+	SchoolID *uuid.UUID `json:"school_id"`
+	School   string     `json:"school"`
+	MajorID  *uuid.UUID `json:"major_id"`
+	Major    string     `json:"major"`
+}
+
+func (input *programInput) validate(v *validator.Validator) {
+	input.School = strings.TrimSpace(input.School)
+	input.Major = strings.TrimSpace(input.Major)
+	if input.MajorID != nil {
+		return
+	}
+	v.CheckField(input.SchoolID != nil || validator.NotBlank(input.School), "school", "School is required")
+	v.CheckField(validator.NotBlank(input.Major), "major", "Major is required")
+	v.CheckField(validator.MaxRunes(input.School, 255), "school", "Must be at most 255 characters")
+	v.CheckField(validator.MaxRunes(input.Major, 255), "major", "Must be at most 255 characters")
+}
+
+// resolveProgram looks the program up in the catalog like the programs of results,
+// so that it matches the results stored under the canonical entries. Names that are
+// not in the catalog are kept as typed. It returns models.ErrRecordNotFound when an
+// ID is not in the catalog.
+func (app *application) resolveProgram(input programInput) (*models.Program, error) {
+	if input.MajorID != nil {
+		major, err := app.models.Catalog.GetMajor(*input.MajorID)
+		if err != nil {
+			return nil, err
+		}
+		return &models.Program{
+			SchoolID: major.SchoolID,
+			School:   major.SchoolName,
+			MajorID:  &major.ID,
+			Major:    major.Name,
+			Degree:   major.DegreeName,
+		}, nil
+	}
+
+	program := &models.Program{School: input.School, Major: input.Major}
+
+	var school *models.CatalogEntry
+	var err error
+	if input.SchoolID != nil {
+		school, err = app.models.Catalog.GetSchool(*input.SchoolID)
+	} else {
+		school, err = app.models.Catalog.ResolveSchool(input.School)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) && input.SchoolID == nil {
+			return program, nil
+		}
+		return nil, err
+	}
+	program.SchoolID = &school.ID
+	program.School = school.Name
+
+	major, err := app.models.Catalog.ResolveMajor(school.ID, input.Major)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return program, nil
+		}
+		return nil, err
+	}
+	program.MajorID = &major.ID
+	program.Major = major.Name
+	program.Degree = major.DegreeName
+	return program, nil
+}
+
+// readProgramQuery reads a programInput from the ?school_id=, ?school=, ?major_id=
+// and ?major= query parameters.
+func readProgramQuery(c *gin.Context, v *validator.Validator) programInput {
+	input := programInput{School: c.Query("school"), Major: c.Query("major")}
+	if value := c.Query("school_id"); value != "" {
+		id, err := uuid.Parse(value)
+		v.CheckField(err == nil, "school_id", "Must be a valid ID")
+		input.SchoolID = &id
+	}
+	if value := c.Query("major_id"); value != "" {
+		id, err := uuid.Parse(value)
+		v.CheckField(err == nil, "major_id", "Must be a valid ID")
+		input.MajorID = &id
+	}
+	input.validate(v)
+	return input
+}
+
+// currentCycle returns the admission cycle under way.
+func currentCycle() int {
+	return timeline.CycleOf(time.Now())
+}
+
+type decisionCounts struct {
+	Admitted int `json:"admitted"`
+	Rejected int `json:"rejected"`
+}
+
+func (d *decisionCounts) add(status string) {
+	switch status {
+	case "admitted":
+		d.Admitted++
+	case "rejected":
+		d.Rejected++
+	}
+}
+
+type currentCycleTimeline struct {
+	Cycle int `json:"cycle"`
+	decisionCounts
+	FirstReportedAt  *time.Time     `json:"first_reported_at"`
+	ReportedThisWeek decisionCounts `json:"reported_this_week"`
+}
+
+// programTimeline shows when the program given in the query announced its decisions
+// in the last cycles, week by week, what has been reported so far in the current
+// cycle, and when the rest of its decisions are expected, from the 5 cycles before.
+func (app *application) programTimeline(c *gin.Context) {
+	var v validator.Validator
+
+	input := readProgramQuery(c, &v)
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	program, err := app.resolveProgram(input)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	cycle := currentCycle()
+	decisions, err := app.models.Results.GetProgramDecisions(*program, cycle-timelineCycles)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	weekAgo := time.Now().AddDate(0, 0, -7)
+	current := currentCycleTimeline{Cycle: cycle}
+	past := make([]timeline.Decision, len(decisions))
+	for i, d := range decisions {
+		past[i] = timeline.Decision{Date: d.AnnounceDate, Admitted: d.Status == "admitted"}
+
+		if timeline.CycleOf(d.AnnounceDate) != cycle {
+			continue
+		}
+		current.add(d.Status)
+		if current.FirstReportedAt == nil || d.ReportedAt.Before(*current.FirstReportedAt) {
+			reportedAt := d.ReportedAt
+			current.FirstReportedAt = &reportedAt
+		}
+		if d.ReportedAt.After(weekAgo) {
+			current.ReportedThisWeek.add(d.Status)
+		}
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"timeline": map[string]any{
+		"program":  program,
+		"cycles":   timeline.Build(past),
+		"current":  current,
+		"forecast": timeline.Predict(past, cycle),
+	}})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// recentDecisions lists the programs with the most decisions of the current cycle
+// reported in the last ?days= (7 by default), up to ?limit= programs.
+func (app *application) recentDecisions(c *gin.Context) {
+	var v validator.Validator
+
+	days := defaultRecentDays
+	if value := c.Query("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		v.CheckField(err == nil && days >= 1 && days <= maxRecentDays, "days", "Days must be between 1 and 30")
+	}
+
+	limit := defaultRecentPrograms
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		v.CheckField(err == nil && limit >= 1 && limit <= maxRecentPrograms, "limit", "Limit must be between 1 and 100")
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	cycle := currentCycle()
+	since := time.Now().AddDate(0, 0, -days)
+	programs, err := app.models.Results.GetRecentActivity(since, cycle, limit)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"cycle": cycle, "since": since, "programs": programs})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// listWatches returns the programs the user watches.
+func (app *application) listWatches(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	watches, err := app.models.Watches.GetForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"watches": watches})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// createWatch watches a program for the user, who is then emailed when the first
+// decision of a cycle is reported for it. When one was already reported this cycle,
+// the first email comes next cycle.
+func (app *application) createWatch(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		programInput
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.programInput.validate(&input.Validator)
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	program, err := app.resolveProgram(input.programInput)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	watch, err := app.models.Watches.Insert(user.ID, *program, currentCycle())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateWatch):
+			app.watchExists(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusCreated, envelope{"watch": watch})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// deleteWatch stops watching a program.
+func (app *application) deleteWatch(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	err = app.models.Watches.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
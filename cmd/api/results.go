@@ -38,7 +38,14 @@ func (app *application) createResult(c *gin.Context) {
 
 	// Insert all results for this user
 	for _, admittedSchool := range input.AdmittedSchools {
-		err = app.models.Results.Insert(user.ID, admittedSchool.SchoolName, admittedSchool.MajorName, admittedSchool.AnnounceDate, "admitted", admittedSchool.Others)
+		admittedSchool.Status = "admitted"
+		err = app.resolveResult(&admittedSchool)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+
+		err = app.models.Results.Insert(user.ID, admittedSchool)
 		if err, ok := err.(*pq.Error); ok {
 			if err.Code.Name() == "unique_violation" {
 				app.badRequest(c.Writer, c.Request, fmt.Errorf("duplicate record"))
@@ -56,7 +63,14 @@ func (app *application) createResult(c *gin.Context) {
 	}
 
 	for _, rejectedSchool := range input.RejectedSchools {
-		err = app.models.Results.Insert(user.ID, rejectedSchool.SchoolName, rejectedSchool.MajorName, rejectedSchool.AnnounceDate, "rejected", rejectedSchool.Others)
+		rejectedSchool.Status = "rejected"
+		err = app.resolveResult(&rejectedSchool)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+
+		err = app.models.Results.Insert(user.ID, rejectedSchool)
 		if err, ok := err.(*pq.Error); ok {
 			if err.Code.Name() == "unique_violation" {
 				app.badRequest(c.Writer, c.Request, fmt.Errorf("duplicate record"))
@@ -80,6 +94,35 @@ func (app *application) createResult(c *gin.Context) {
 	}
 }
 
+// resolveResult looks up the school and major of a result in the catalog, so that
+// aliases like "UCB" are stored under the canonical entry. Names that are not in the
+// catalog are kept as typed.
+func (app *application) resolveResult(result *models.Result) error {
+	result.SchoolID = nil
+	result.MajorID = nil
+
+	school, err := app.models.Catalog.ResolveSchool(result.SchoolName)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	result.SchoolID = &school.ID
+	result.SchoolName = school.Name
+
+	major, err := app.models.Catalog.ResolveMajor(school.ID, result.MajorName)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	result.MajorID = &major.ID
+	result.MajorName = major.Name
+	return nil
+}
+
 func (app *application) getUserResults(c *gin.Context) {
 	username := c.Param("username")
 
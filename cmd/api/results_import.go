@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/spreadsheet"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	// maxResultsUpload bounds the size of an uploaded spreadsheet.
+	maxResultsUpload = 5 << 20
+
+	// maxImportedResults bounds the number of results in a spreadsheet.
+	maxImportedResults = 1000
+
+	// resultImportTimeout bounds saving the results of a spreadsheet.
+	resultImportTimeout = 30 * time.Second
+)
+
+// resultImportFields are the fields of a result that columns are mapped to, along
+// with the headers that are mapped to them when the request has no mapping.
+var resultImportFields = []struct {
+	name     string
+	required bool
+	headers  []string
+}{
+	{"school_name", true, []string{"school", "school name", "university", "institution", "college", "學校", "校名"}},
+	{"major_name", true, []string{"major", "major name", "program", "programme", "department", "科系", "系所"}},
+	{"announce_date", true, []string{"announce date", "date", "decision date", "result date", "notification date", "notified", "日期", "放榜日期"}},
+	{"status", true, []string{"status", "result", "decision", "outcome", "結果", "狀態"}},
+	{"others", false, []string{"others", "notes", "note", "comments", "comment", "remarks", "備註"}},
+}
+
+// importStatuses maps the ways people write down a decision onto result statuses.
+var importStatuses = map[string]string{
+	"admitted": "admitted",
+	"admit":    "admitted",
+	"accepted": "admitted",
+	"accept":   "admitted",
+	"offer":    "admitted",
+	"ad":       "admitted",
+	"錄取":       "admitted",
+	"正取":       "admitted",
+	"rejected": "rejected",
+	"reject":   "rejected",
+	"rej":      "rejected",
+	"denied":   "rejected",
+	"拒絕":       "rejected",
+	"被拒":       "rejected",
+	"落榜":       "rejected",
+}
+
+// importDateLayouts are the date formats accepted in spreadsheets. Dates with slashes
+// and the year last are read the American way, month first, and dates with dots and
+// the year last day first.
+var importDateLayouts = []string{
+	"2006-01-02",
+	"2006/1/2",
+	"2006.1.2",
+	"1/2/2006",
+	"2.1.2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// resultImport is the outcome of reading a spreadsheet of results: the columns it
+// has, how they map onto result fields, and each row as a result or with the errors
+// that keep it from being one.
+type resultImport struct {
+	Columns       []string             `json:"columns"`
+	Sheet         string               `json:"sheet,omitempty"`
+	Sheets        []string             `json:"sheets,omitempty"`
+	Mapping       map[string]string    `json:"mapping"`
+	MappingErrors *validator.Validator `json:"mapping_errors,omitempty"`
+	Rows          []resultImportRow    `json:"rows"`
+	Valid         int                  `json:"valid"`
+	Invalid       int                  `json:"invalid"`
+	Imported      bool                 `json:"imported"`
+}
+
+type resultImportRow struct {
+	Row    int                  `json:"row"`
+	Result models.Result        `json:"result"`
+	Errors *validator.Validator `json:"errors,omitempty"`
+}
+
+// previewResultImport reads a spreadsheet of results without saving anything, so
+// that the user can check the columns were understood and fix the mapping or the
+// rows with errors. The form has the spreadsheet as "file", and optionally the
+// "sheet" of a workbook to read and a "mapping" of result fields to column headers,
+// as a JSON object; without one, columns are mapped by their headers.
+func (app *application) previewResultImport(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	imported, _, ok := app.readResultImport(c, user)
+	if !ok {
+		return
+	}
+
+	err := response.JSON(c.Writer, http.StatusOK, envelope{"import": imported})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// importResults saves the results of a spreadsheet, read like previewResultImport
+// does, in a single transaction. Nothing is saved unless every row is valid. With
+// the form field "mode" set to "replace", the results the user had before are
+// deleted; by default they are kept, and rows for the same school and major replace
+// them.
+func (app *application) importResults(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	imported, results, ok := app.readResultImport(c, user)
+	if !ok {
+		return
+	}
+
+	mode := c.Request.FormValue("mode")
+	if mode != "" && mode != "merge" && mode != "replace" {
+		var v validator.Validator
+		v.AddFieldError("mode", "Mode must be merge or replace")
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	if imported.MappingErrors != nil || imported.Invalid > 0 || len(results) == 0 {
+		err := response.JSON(c.Writer, http.StatusUnprocessableEntity, envelope{"import": imported})
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), resultImportTimeout)
+	defer cancel()
+
+	err := app.models.Results.Import(ctx, user.ID, results, mode == "replace")
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	imported.Imported = true
+
+	app.audit(c, user.ID, "results.imported", map[string]any{
+		"rows": len(results),
+		"mode": mode,
+	})
+
+	err = response.JSON(c.Writer, http.StatusCreated, envelope{"import": imported})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// readResultImport reads the spreadsheet of the request and validates its rows. It
+// returns the results of the valid rows, and false after sending an error response
+// when the request cannot be read at all.
+func (app *application) readResultImport(c *gin.Context, user *models.User) (*resultImport, []models.Result, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxResultsUpload)
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, errors.New("the form must have a file field"))
+		return nil, nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return nil, nil, false
+	}
+
+	table, err := spreadsheet.Read(data, c.Request.FormValue("sheet"))
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return nil, nil, false
+	}
+	if len(table.Rows) > maxImportedResults {
+		app.badRequest(c.Writer, c.Request, fmt.Errorf("the file has more than %d results", maxImportedResults))
+		return nil, nil, false
+	}
+
+	imported := &resultImport{
+		Columns: table.Header,
+		Sheet:   table.Sheet,
+		Sheets:  table.Sheets,
+		Rows:    []resultImportRow{},
+	}
+
+	if value := c.Request.FormValue("mapping"); value != "" {
+		err = json.Unmarshal([]byte(value), &imported.Mapping)
+		if err != nil {
+			app.badRequest(c.Writer, c.Request, errors.New("mapping must be a JSON object of field names to column headers"))
+			return nil, nil, false
+		}
+	} else {
+		imported.Mapping = guessResultMapping(table.Header)
+	}
+
+	columns, v := resolveResultMapping(imported.Mapping, table.Header)
+	if v.HasErrors() {
+		translated := app.translateValidation(c.Request, v)
+		imported.MappingErrors = &translated
+		return imported, nil, true
+	}
+
+	var results []models.Result
+	seen := map[string]bool{}
+	resolved := map[string]models.Result{}
+	for _, row := range table.Rows {
+		cell := func(field string) string {
+			if index, ok := columns[field]; ok {
+				return row.Cells[index]
+			}
+			return ""
+		}
+
+		result, v := parseImportedResult(cell)
+		result.UserID = user.ID
+
+		if !v.HasErrors() {
+			// Rows often repeat a school, so look each school and major up once.
+			key := result.SchoolName + "\x00" + result.MajorName
+			canonical, ok := resolved[key]
+			if !ok {
+				canonical = result
+				err := app.resolveResult(&canonical)
+				if err != nil {
+					app.serverError(c.Writer, c.Request, err)
+					return nil, nil, false
+				}
+				resolved[key] = canonical
+			}
+			result.SchoolID, result.SchoolName = canonical.SchoolID, canonical.SchoolName
+			result.MajorID, result.MajorName = canonical.MajorID, canonical.MajorName
+
+			key = strings.ToLower(result.SchoolName) + "\x00" + strings.ToLower(result.MajorName)
+			v.Check(!seen[key], "The file has another result for this school and major")
+			seen[key] = true
+		}
+
+		importedRow := resultImportRow{Row: row.Number, Result: result}
+		if v.HasErrors() {
+			translated := app.translateValidation(c.Request, v)
+			importedRow.Errors = &translated
+			imported.Invalid++
+		} else {
+			results = append(results, result)
+			imported.Valid++
+		}
+		imported.Rows = append(imported.Rows, importedRow)
+	}
+
+	return imported, results, true
+}
+
+// guessResultMapping maps columns onto result fields by their headers.
+func guessResultMapping(header []string) map[string]string {
+	mapping := map[string]string{}
+	used := map[int]bool{}
+	for _, field := range resultImportFields {
+		for _, name := range field.headers {
+			index := findColumn(header, name)
+			if index >= 0 && !used[index] {
+				mapping[field.name] = header[index]
+				used[index] = true
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+// resolveResultMapping checks a mapping against the header and returns the index of
+// the column of each mapped field.
+func resolveResultMapping(mapping map[string]string, header []string) (map[string]int, validator.Validator) {
+	var v validator.Validator
+
+	known := map[string]bool{}
+	for _, field := range resultImportFields {
+		known[field.name] = true
+	}
+	for name := range mapping {
+		v.CheckField(known[name], "mapping."+name, "Unknown result field")
+	}
+
+	columns := map[string]int{}
+	mappedTo := map[int]string{}
+	for _, field := range resultImportFields {
+		column := mapping[field.name]
+		if column == "" {
+			v.CheckField(!field.required, "mapping."+field.name, "No column is mapped to this field")
+			continue
+		}
+
+		index := findColumn(header, column)
+		if index < 0 {
+			v.AddFieldError("mapping."+field.name, "The file has no such column")
+			continue
+		}
+		if _, ok := mappedTo[index]; ok {
+			v.AddFieldError("mapping."+field.name, "This column is already mapped to another field")
+			continue
+		}
+		mappedTo[index] = field.name
+		columns[field.name] = index
+	}
+	return columns, v
+}
+
+// findColumn returns the index of the column called name, ignoring case, spacing
+// and underscores, or -1.
+func findColumn(header []string, name string) int {
+	name = normalizeHeader(name)
+	for i, column := range header {
+		if normalizeHeader(column) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeHeader(s string) string {
+	s = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(s))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseImportedResult builds a result from the cells of a row and validates it.
+func parseImportedResult(cell func(field string) string) (models.Result, validator.Validator) {
+	var v validator.Validator
+	result := models.Result{
+		SchoolName: cell("school_name"),
+		MajorName:  cell("major_name"),
+		Others:     cell("others"),
+	}
+
+	v.CheckField(validator.NotBlank(result.SchoolName), "school_name", "School is required")
+	v.CheckField(validator.MaxRunes(result.SchoolName, 255), "school_name", "Must be at most 255 characters")
+	v.CheckField(validator.NotBlank(result.MajorName), "major_name", "Major is required")
+	v.CheckField(validator.MaxRunes(result.MajorName, 255), "major_name", "Must be at most 255 characters")
+	v.CheckField(validator.MaxRunes(result.Others, 255), "others", "Must be at most 255 characters")
+
+	status := cell("status")
+	result.Status = importStatuses[strings.ToLower(status)]
+	switch {
+	case status == "":
+		v.AddFieldError("status", "Status is required")
+	case result.Status == "":
+		result.Status = status
+		v.AddFieldError("status", "Status must be admitted or rejected")
+	}
+
+	date := cell("announce_date")
+	if date == "" {
+		v.AddFieldError("announce_date", "Date is required")
+	} else if parsed, ok := parseImportDate(date); ok {
+		result.AnnounceDate = parsed.Format("2006-01-02")
+		v.CheckField(parsed.Year() >= 2000 && parsed.Before(time.Now().AddDate(1, 0, 0)), "announce_date", "Date is out of range")
+	} else {
+		result.AnnounceDate = date
+		v.AddFieldError("announce_date", "Date is not in a known format, use YYYY-MM-DD")
+	}
+
+	return result, v
+}
+
+func parseImportDate(s string) (time.Time, bool) {
+	// Timestamps like 2024-03-15T00:00:00Z, and dates with a time.
+	if len(s) > 10 && (s[10] == 'T' || s[10] == ' ') {
+		s = s[:10]
+	}
+	for _, layout := range importDateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, true
+		}
+	}
+
+	// Spreadsheets exported to CSV without a date format leave the serial number of
+	// the day, counted from the end of 1899.
+	if serial, err := strconv.Atoi(s); err == nil && serial > 30000 && serial < 100000 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, serial), true
+	}
+	return time.Time{}, false
+}
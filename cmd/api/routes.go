@@ -1,46 +1,110 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func (app *application) SetupRouter() *gin.Engine {
+func (app *application) SetupRouter() (*gin.Engine, error) {
 	router := gin.Default()
+
+	// Client IPs key rate limits and brute-force lockouts, so they are only read from
+	// headers set by the platform or by proxies we run; otherwise anyone could send a
+	// new X-Forwarded-For with every request.
+	router.TrustedPlatform = app.config.TRUSTED_PLATFORM
+	var proxies []string
+	for _, proxy := range strings.Split(app.config.TRUSTED_PROXIES, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	err := router.SetTrustedProxies(proxies)
+	if err != nil {
+		return nil, err
+	}
+
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "https://offerland.cc"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept-Language"},
+		ExposeHeaders:    []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 	}))
+	router.Use(app.rateLimit(rateLimitGlobal))
 
 	router.GET("/ping", app.pong)
 
 	router.GET("/whoami", app.authenticate, app.whoAmI)
 
-	auth := router.Group("/auth")
+	me := router.Group("/me", app.authenticate, app.requireAuthenticatedUser)
+	{
+		me.PUT("/locale", app.updateLocale)
+		me.GET("/profile", app.getApplicantProfile)
+		me.PUT("/profile", app.rateLimit(rateLimitWrite), app.putApplicantProfile)
+		me.DELETE("/profile", app.deleteApplicantProfile)
+		me.GET("/watches", app.listWatches)
+		me.POST("/watches", app.rateLimit(rateLimitWrite), app.createWatch)
+		me.DELETE("/watches/:id", app.deleteWatch)
+		me.DELETE("", app.requireStepUp, app.deleteAccount)
+		me.GET("/export", app.requireStepUp, app.exportAccount)
+
+		me.GET("/sessions", app.listSessions)
+		me.DELETE("/sessions", app.deleteAllSessions)
+		me.DELETE("/sessions/:id", app.deleteSession)
+
+		me.POST("/step-up", app.stepUp)
+
+		me.POST("/password", app.requireStepUp, app.setPassword)
+		me.PUT("/password", app.changePassword)
+		me.POST("/email", app.requireStepUp, app.requestEmailChange)
+
+		me.GET("/identities", app.listIdentities)
+		me.POST("/identities/:provider/start", app.requireStepUp, app.linkIdentityStart)
+		me.POST("/identities/:provider/callback", app.linkIdentityCallback)
+		me.DELETE("/identities/:provider", app.requireStepUp, app.unlinkIdentity)
+
+		me.GET("/2fa", app.twoFactorStatus)
+		me.POST("/2fa/totp", app.requireStepUp, app.enrollTOTP)
+		me.POST("/2fa/totp/confirm", app.confirmTOTP)
+		me.DELETE("/2fa/totp", app.requireStepUp, app.disableTOTP)
+		me.POST("/2fa/recovery-codes", app.requireStepUp, app.regenerateRecoveryCodes)
+	}
+
+	auth := router.Group("/auth", app.rateLimit(rateLimitAuth))
 	{
 		auth.POST("/signup", app.Signup)
 		auth.POST("/activate/:token", app.ActivateUser)
+		auth.POST("/confirm-email/:token", app.confirmEmailChange)
 
-		auth.GET("/check_username", app.checkUsername)
-		auth.GET("/check_email", app.checkEmail)
-		auth.GET("/check_author/:authorname", app.checkAuthor)
+		auth.GET("/check_username", app.rateLimit(rateLimitLookup), app.checkUsername)
+		auth.GET("/check_email", app.rateLimit(rateLimitLookup), app.checkEmail)
+		auth.GET("/check_author/:authorname", app.rateLimit(rateLimitLookup), app.checkAuthor)
 
 		auth.POST("/login", app.Login)
+		auth.POST("/2fa", app.loginTwoFactor)
+		auth.POST("/passwordless", app.requestLoginCode)
+		auth.POST("/passwordless/verify", app.verifyLoginCode)
 		auth.POST("/googlelogin", app.GoogleLogin)
 
+		auth.POST("/oidc/:provider/start", app.oidcStart)
+		auth.POST("/oidc/:provider/callback", app.oidcCallback)
+		auth.POST("/oidc/:provider/form_post", app.oidcFormPost)
+
 		auth.POST("/logout", app.Logout)
 
 		auth.POST("/refresh_token", app.refreshToken)
 	}
 
-	router.POST("/forgot-password", app.userForgotPassword)
-	router.POST("/reset-forgot-password/:token", app.userForgotPasswordReset)
+	router.POST("/forgot-password", app.rateLimit(rateLimitAuth), app.userForgotPassword)
+	router.POST("/reset-forgot-password/:token", app.rateLimit(rateLimitAuth), app.userForgotPasswordReset)
 
 	result := router.Group("/results")
 	{
-		result.POST("", app.authenticate, app.createResult)
+		result.POST("", app.authenticate, app.rateLimit(rateLimitWrite), app.createResult)
+		result.POST("/import/preview", app.authenticate, app.requireAuthenticatedUser, app.rateLimit(rateLimitWrite), app.previewResultImport)
+		result.POST("/import", app.authenticate, app.requireAuthenticatedUser, app.rateLimit(rateLimitWrite), app.importResults)
 		result.GET("/:username", app.authenticate, app.getUserResults)
 		result.GET("", app.authenticate, app.getAllResults)
 	}
@@ -49,9 +113,32 @@ func (app *application) SetupRouter() *gin.Engine {
 	{
 		post.GET("/:id", app.GetPost)
 		post.GET("", app.GetAllPosts)
-		post.POST("", app.authenticate, app.CreatePost)
-		post.PUT("/:id", app.authenticate, app.UpdatePost)
-		post.DELETE("/:id", app.authenticate, app.DeletePost)
+		post.POST("", app.authenticate, app.rateLimit(rateLimitWrite), app.CreatePost)
+		post.PUT("/:id", app.authenticate, app.rateLimit(rateLimitWrite), app.UpdatePost)
+		post.DELETE("/:id", app.authenticate, app.rateLimit(rateLimitWrite), app.DeletePost)
+	}
+
+	export := router.Group("/export", app.authenticate, app.requireAuthenticatedUser, app.requirePermission("results:export"))
+	{
+		export.GET("/results", app.rateLimit(rateLimitLookup), app.exportResults)
+	}
+
+	router.GET("/users/:username/similar", app.authenticate, app.rateLimit(rateLimitLookup), app.similarApplicants)
+
+	router.GET("/programs/timeline", app.rateLimit(rateLimitLookup), app.programTimeline)
+	router.GET("/decisions/recent", app.rateLimit(rateLimitLookup), app.recentDecisions)
+
+	router.POST("/predict", app.authenticate, app.requireAuthenticatedUser, app.rateLimit(rateLimitLookup), app.predictAdmission)
+
+	router.GET("/catalog/autocomplete", app.rateLimit(rateLimitLookup), app.autocompleteCatalog)
+
+	admin := router.Group("/admin", app.authenticate, app.requireAuthenticatedUser, app.requirePermission("admin"))
+	{
+		admin.POST("/catalog/import", app.importCatalog)
+		admin.GET("/catalog/aliases", app.listCatalogAliases)
+		admin.POST("/catalog/aliases", app.createCatalogAlias)
+		admin.DELETE("/catalog/aliases/:kind/:id", app.deleteCatalogAlias)
+		admin.POST("/catalog/merge", app.mergeCatalogEntries)
 	}
 
 	// _api := router.Group("/_api")
@@ -61,5 +148,5 @@ func (app *application) SetupRouter() *gin.Engine {
 	// 	_api.GET("/majors/:school", app.getMajorsBySchool)
 	// }
 
-	return router
+	return router, nil
 }
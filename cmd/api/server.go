@@ -12,10 +12,15 @@ import (
 )
 
 func (app *application) serve() error {
+	router, err := app.SetupRouter()
+	if err != nil {
+		return err
+	}
+
 	// Declare a HTTP server using the same settings as in our main() function.
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("0.0.0.0:%d", app.config.PORT),
-		Handler:      app.SetupRouter(),
+		Handler:      router,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -25,6 +30,9 @@ func (app *application) serve() error {
 	// by the graceful Shutdown() function.
 	shutdownError := make(chan error)
 
+	// Run the scheduled jobs until the server shuts down.
+	app.scheduler.Start()
+
 	// Start a background goroutine.
 	go func() {
 		// Create a quit channel which carries os.Signal values.
@@ -58,6 +66,7 @@ func (app *application) serve() error {
 		// Log a message to say that we're waiting for any background goroutines to
 		// complete their tasks.
 		app.logger.Info("Completing background tasks on %s", srv.Addr)
+		app.scheduler.Stop()
 
 		// Call Wait() to block until our WaitGroup counter is zero --- essentially
 		// blocking until the background goroutines have finished. Then we return nil on
@@ -73,7 +82,7 @@ func (app *application) serve() error {
 	// return a http.ErrServerClosed error. So if we see this error, it is actually a
 	// good thing and an indication that the graceful shutdown has started. So we check
 	// specifically for this, only returning the error if it is NOT http.ErrServerClosed
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/response"
+)
+
+// listSessions returns the active sessions of the authenticated user. The session
+// of the device making the request is flagged as current.
+func (app *application) listSessions(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	sessions, err := app.models.Sessions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	currentID, _, ok := app.refreshTokenSession(c.Request)
+	if ok {
+		for _, session := range sessions {
+			session.Current = session.ID == currentID
+		}
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"sessions": sessions})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// deleteSession revokes one session of the authenticated user, logging that device
+// out immediately: authenticate rejects access tokens of revoked sessions, and the
+// refresh token cannot be exchanged any more.
+func (app *application) deleteSession(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	err = app.models.Sessions.Delete(sessionID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	currentID, _, ok := app.refreshTokenSession(c.Request)
+	if ok && currentID == sessionID {
+		app.clearRefreshTokenCookie(c.Writer)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// deleteAllSessions revokes every session of the authenticated user, including the
+// current one.
+func (app *application) deleteAllSessions(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	err := app.models.Sessions.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	app.clearRefreshTokenCookie(c.Writer)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/similarity"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	// maxSimilarCandidates bounds the public profiles compared against, the most
+	// recently updated ones.
+	maxSimilarCandidates = 5000
+
+	defaultSimilarLimit = 20
+	maxSimilarLimit     = 50
+)
+
+// A resultSummary sums up the results an applicant reported.
+type resultSummary struct {
+	Admitted int             `json:"admitted"`
+	Rejected int             `json:"rejected"`
+	Results  []models.Result `json:"results"`
+}
+
+type similarApplicant struct {
+	Username             string                   `json:"username"`
+	Similarity           float64                  `json:"similarity"`
+	BackgroundSimilarity *float64                 `json:"background_similarity"`
+	ProgramSimilarity    *float64                 `json:"program_similarity"`
+	SharedPrograms       int                      `json:"shared_programs"`
+	Profile              *models.ApplicantProfile `json:"profile"`
+	Results              resultSummary            `json:"results"`
+}
+
+// similarApplicants lists the users with public profiles most similar to the user
+// :username, by background and by the programs they applied to, with their profiles
+// and results. The background of the user only counts when their profile is public,
+// or when they are the one asking; otherwise only their results, which are public,
+// do. ?limit= caps the list, at 20 by default.
+func (app *application) similarApplicants(c *gin.Context) {
+	viewer := app.contextGetUser(c.Request)
+
+	var v validator.Validator
+
+	limit := defaultSimilarLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		v.CheckField(err == nil && limit >= 1 && limit <= maxSimilarLimit, "limit", "Limit must be between 1 and 50")
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, v)
+		return
+	}
+
+	user, err := app.models.Users.GetByUsername(c.Param("username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	var target similarity.Applicant
+
+	profile, err := app.models.Profiles.Get(user.ID)
+	switch {
+	case err == nil:
+		if profile.Public || viewer.ID == user.ID {
+			p := similarityProfile(profile)
+			target.Profile = &p
+		}
+	case !errors.Is(err, models.ErrRecordNotFound):
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	target.Programs, err = app.models.Results.GetProgramKeys(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	candidates, err := app.models.Profiles.GetPublic(user.ID, maxSimilarCandidates)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	type match struct {
+		applicant *models.PublicApplicant
+		similarity.Match
+	}
+	var matches []match
+	for _, candidate := range candidates {
+		p := similarityProfile(&candidate.Profile)
+		m := similarity.Compare(&target, &similarity.Applicant{Profile: &p, Programs: candidate.Programs})
+		if m.Score > 0 {
+			matches = append(matches, match{candidate, m})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	userIDs := make([]string, len(matches))
+	for i, m := range matches {
+		userIDs[i] = m.applicant.UserID
+	}
+	results, err := app.models.Results.GetForUsers(userIDs)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	similar := []similarApplicant{}
+	for _, m := range matches {
+		summary := resultSummary{Results: []models.Result{}}
+		for _, result := range results[m.applicant.UserID] {
+			switch result.Status {
+			case "admitted":
+				summary.Admitted++
+			case "rejected":
+				summary.Rejected++
+			}
+			summary.Results = append(summary.Results, result)
+		}
+
+		similar = append(similar, similarApplicant{
+			Username:             m.applicant.Username,
+			Similarity:           round3(m.Score),
+			BackgroundSimilarity: round3Optional(m.Background),
+			ProgramSimilarity:    round3Optional(m.Programs),
+			SharedPrograms:       m.SharedPrograms,
+			Profile:              &m.applicant.Profile,
+			Results:              summary,
+		})
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"similar": similar})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+func round3Optional(x *float64) *float64 {
+	if x == nil {
+		return nil
+	}
+	rounded := round3(*x)
+	return &rounded
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"offerland.cc/internal/models"
+)
+
+// testDB is a database/sql driver for handler tests. It answers each query with the
+// first handler whose SQL fragment the query contains, so the models run unchanged
+// without a database. Queries without a handler fail, so that a test notices when
+// a handler touches more than it expects.
+type testDB struct {
+	mu       sync.Mutex
+	handlers []testQuery
+}
+
+type testQuery struct {
+	fragment string
+	answer   func(args []driver.Value) (*testRows, error)
+}
+
+// newTestDB returns a testDB and a *sql.DB connected to it.
+func newTestDB(t *testing.T) (*testDB, *sql.DB) {
+	t.Helper()
+
+	tdb := &testDB{}
+	db := sql.OpenDB(testConnector{tdb})
+	t.Cleanup(func() { db.Close() })
+	return tdb, db
+}
+
+// handle answers the queries containing fragment, which is compared with runs of
+// whitespace collapsed.
+func (d *testDB) handle(fragment string, answer func(args []driver.Value) (*testRows, error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, testQuery{fragment: collapseSpace(fragment), answer: answer})
+}
+
+func (d *testDB) answer(query string, named []driver.NamedValue) (*testRows, error) {
+	query = collapseSpace(query)
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	d.mu.Lock()
+	var answer func(args []driver.Value) (*testRows, error)
+	for _, handler := range d.handlers {
+		if strings.Contains(query, handler.fragment) {
+			answer = handler.answer
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	if answer == nil {
+		return nil, fmt.Errorf("testdb: unexpected query %q", query)
+	}
+	rows, err := answer(args)
+	if rows == nil && err == nil {
+		rows = &testRows{}
+	}
+	return rows, err
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// testRows are the rows a handler answers with. Exec reports them as the number of
+// rows affected.
+type testRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.columns }
+
+func (r *testRows) Close() error { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type testConnector struct {
+	db *testDB
+}
+
+func (c testConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return testConn{c.db}, nil
+}
+
+func (c testConnector) Driver() driver.Driver {
+	return testDriver{}
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("testdb: open with sql.OpenDB")
+}
+
+type testConn struct {
+	db *testDB
+}
+
+func (c testConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("testdb: prepared statements are not supported")
+}
+
+func (c testConn) Close() error { return nil }
+
+func (c testConn) Begin() (driver.Tx, error) { return testTx{}, nil }
+
+func (c testConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.answer(query, args)
+}
+
+func (c testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows.values)), nil
+}
+
+type testTx struct{}
+
+func (testTx) Commit() error { return nil }
+
+func (testTx) Rollback() error { return nil }
+
+// userRows answers a query for a user with the columns UserModel.Get scans, or with
+// no rows when user is nil.
+func userRows(user *models.User) *testRows {
+	rows := &testRows{columns: []string{
+		"user_id", "created_at", "username", "email", "password", "activated",
+		"preferred_locale", "deletion_scheduled_at", "disabled_at", "version",
+	}}
+	if user == nil {
+		return rows
+	}
+
+	var deletionScheduledAt, disabledAt driver.Value
+	if user.DeletionScheduledAt != nil {
+		deletionScheduledAt = *user.DeletionScheduledAt
+	}
+	if user.DisabledAt != nil {
+		disabledAt = *user.DisabledAt
+	}
+	rows.values = [][]driver.Value{{
+		user.ID, user.CreatedAt, user.Username, user.Email, user.Password, user.Activated,
+		user.Locale, deletionScheduledAt, disabledAt, int64(user.Version),
+	}}
+	return rows
+}
@@ -1,79 +1,159 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/pascaldekloe/jwt"
+	"github.com/google/uuid"
+	"offerland.cc/internal/models"
 	"offerland.cc/internal/response"
 )
 
-func (app *application) refreshToken(c *gin.Context) {
-	// get refresh token from cookie
-	refreshTokenCookie, err := c.Cookie("REFRESH_TOKEN")
-	if err != nil {
-		app.invalidAuthenticationToken(c.Writer, c.Request)
-		return
-	}
+const refreshTokenCookie = "REFRESH_TOKEN"
 
-	// check if refresh token is valid and match database
-	claims, err := jwt.HMACCheck([]byte(refreshTokenCookie), []byte(app.config.REFRESH_TOKEN_SECRET))
-	if err != nil {
-		app.invalidAuthenticationToken(c.Writer, c.Request)
+// startSession creates a new session for the device making the request and issues
+// the first access/refresh token pair of it. The refresh token is set as an HttpOnly
+// cookie and the access token is returned in the response body together with the
+// user.
+func (app *application) startSession(c *gin.Context, user *models.User, status int) {
+	if user.DisabledAt != nil {
+		app.accountDisabled(c.Writer, c.Request)
 		return
 	}
 
-	// Check if the JWT is still valid at this moment in time.
-	// If not delete the token from the database and log out the user
-	if !claims.Valid(time.Now()) {
-		err := app.models.Tokens.DeleteRefreshToken(refreshTokenCookie)
+	// Signing in restores an account that is waiting to be deleted.
+	if user.DeletionScheduledAt != nil {
+		cancelled, err := app.models.Users.CancelDeletion(user.ID)
 		if err != nil {
 			app.serverError(c.Writer, c.Request, err)
 			return
 		}
-		// delete REFRESH_TOKEN cookie
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:    "REFRESH_TOKEN",
-			Value:   "",
-			Path:    "/",
-			Domain:  "",
-			MaxAge:  -1,
-			Expires: time.Unix(0, 0),
-		})
+		if cancelled {
+			app.audit(c, user.ID, "account.deletion_cancelled", nil)
+		}
+		user.DeletionScheduledAt = nil
+	}
 
-		app.invalidAuthenticationToken(c.Writer, c.Request)
-		return
+	session := &models.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
 	}
 
-	foundUserID, err := app.models.Tokens.GetUserIDByRefreshToken(refreshTokenCookie)
+	err := app.models.Sessions.Insert(session)
 	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
 
-		app.invalidAuthenticationToken(c.Writer, c.Request)
+	accessToken, refreshToken, err := app.models.Tokens.NewTokenPair(user.ID, session.ID, app.accessTokens, app.refreshTokens)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
 		return
 	}
 
-	accessToken, refreshToken, err := app.models.Tokens.NewTokenPair(
-		foundUserID,
-		app.config.ACCESS_TOKEN_SECRET, app.config.ACCESS_TOKEN_TTL,
-		app.config.REFRESH_TOKEN_SECRET, app.config.REFRESH_TOKEN_TTL,
-	)
+	app.setRefreshTokenCookie(c.Writer, refreshToken)
 
+	err = response.JSON(c.Writer, status, envelope{"access_token": accessToken.Token, "user": user})
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
-		return
 	}
+}
 
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "REFRESH_TOKEN",
+func (app *application) setRefreshTokenCookie(w http.ResponseWriter, refreshToken *models.JWTToken) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
 		Value:    refreshToken.Token,
 		Path:     "/",
 		Domain:   "",
-		MaxAge:   int(refreshToken.TTL),
+		MaxAge:   int(refreshToken.TTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+func (app *application) clearRefreshTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    "",
+		Path:     "/",
+		Domain:   "",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
 		Secure:   true,
 		HttpOnly: true,
 		SameSite: http.SameSiteNoneMode,
 	})
+}
+
+// refreshTokenSession returns the session and user ID carried by the refresh token
+// cookie of the request, if there is a valid one.
+func (app *application) refreshTokenSession(r *http.Request) (uuid.UUID, string, bool) {
+	cookie, err := r.Cookie(refreshTokenCookie)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+
+	claims, err := app.refreshTokens.Verify(cookie.Value)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+
+	family, _ := claims.String("fam")
+	sessionID, err := uuid.Parse(family)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+
+	return sessionID, claims.Subject, true
+}
+
+func (app *application) refreshToken(c *gin.Context) {
+	// get refresh token from cookie
+	cookie, err := c.Cookie(refreshTokenCookie)
+	if err != nil {
+		app.invalidAuthenticationToken(c.Writer, c.Request)
+		return
+	}
+
+	// Check the signature and expiry of the refresh token before touching the
+	// database. If the token is invalid or expired the user is logged out.
+	sessionID, _, ok := app.refreshTokenSession(c.Request)
+	if !ok {
+		app.clearRefreshTokenCookie(c.Writer)
+		app.invalidAuthenticationToken(c.Writer, c.Request)
+		return
+	}
+
+	// Exchange the refresh token for a new pair. A token that has already been used
+	// revokes its whole family, logging out whoever holds the newer tokens as well.
+	accessToken, refreshToken, err := app.models.Tokens.RotateRefreshToken(cookie, app.accessTokens, app.refreshTokens)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRefreshTokenReused):
+			app.logger.Warning("refresh token reuse detected, token family revoked")
+			app.clearRefreshTokenCookie(c.Writer)
+			app.invalidAuthenticationToken(c.Writer, c.Request)
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.clearRefreshTokenCookie(c.Writer)
+			app.invalidAuthenticationToken(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = app.models.Sessions.Touch(sessionID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	app.setRefreshTokenCookie(c.Writer, refreshToken)
 
 	err = response.JSON(c.Writer, http.StatusOK, envelope{"access_token": accessToken.Token})
 	if err != nil {
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/password"
+	"offerland.cc/internal/request"
+	"offerland.cc/internal/response"
+	"offerland.cc/internal/totp"
+	"offerland.cc/internal/validator"
+)
+
+const (
+	totpIssuer = "Offerland"
+
+	twoFactorTokenTTL    = 5 * time.Minute
+	twoFactorMaxAttempts = 5
+	recoveryCodeCount    = 10
+
+	rememberDeviceCookie = "REMEMBER_DEVICE"
+	rememberDeviceTTL    = 30 * 24 * time.Hour
+
+	// stepUpWindow is how long a login or step-up keeps sensitive actions unlocked.
+	stepUpWindow = 10 * time.Minute
+)
+
+// completeLogin is called once the user has proven their first factor. Users with
+// two-factor authentication get a short-lived two-factor token to present to
+// /auth/2fa together with a code, unless the device was remembered; everybody else
+// gets a session right away.
+func (app *application) completeLogin(c *gin.Context, user *models.User, status int) {
+	enabled, err := app.models.TwoFactor.IsEnabled(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	if !enabled {
+		app.startSession(c, user, status)
+		return
+	}
+
+	cookie, err := c.Request.Cookie(rememberDeviceCookie)
+	if err == nil {
+		remembered, err := app.models.Tokens.IsRememberedDevice(user.ID, cookie.Value)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+		if remembered {
+			app.startSession(c, user, status)
+			return
+		}
+	}
+
+	token, err := app.models.Tokens.NewTwoFactorToken(user.ID, twoFactorTokenTTL)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{
+		"two_factor_required": true,
+		"two_factor_token":    token.Plaintext,
+		"expiry":              token.Expiry,
+	})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// verifySecondFactor checks an authenticator code, or else a recovery code, of the
+// user. Both can only be used once.
+func (app *application) verifySecondFactor(user *models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		secret, err := app.models.TwoFactor.GetTOTP(user.ID)
+		if err != nil {
+			if errors.Is(err, models.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		step, ok := totp.Validate(secret.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return app.models.TwoFactor.UseStep(user.ID, step)
+	}
+
+	if recoveryCode != "" {
+		return app.models.TwoFactor.UseRecoveryCode(user.ID, recoveryCode)
+	}
+
+	return false, nil
+}
+
+// loginTwoFactor finishes a login that needs a second factor.
+func (app *application) loginTwoFactor(c *gin.Context) {
+	var input struct {
+		TwoFactorToken string              `json:"two_factor_token"`
+		Code           string              `json:"code"`
+		RecoveryCode   string              `json:"recovery_code"`
+		RememberDevice bool                `json:"remember_device"`
+		Validator      validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.Validator.CheckField(input.TwoFactorToken != "", "two_factor_token", "Token is required")
+	input.Validator.Check(input.Code != "" || input.RecoveryCode != "", "A code or a recovery code is required")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	ipKey := passcodeIPKey(c)
+	if app.throttled(c, ipKey) {
+		return
+	}
+
+	userID, err := app.models.Tokens.GetTwoFactorToken(input.TwoFactorToken, twoFactorMaxAttempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailure(c, "", ipKey)
+			app.invalidTwoFactorCode(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(user, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	if !ok {
+		app.recordFailure(c, user.ID, ipKey)
+		app.audit(c, user.ID, "two_factor.failure", nil)
+		app.invalidTwoFactorCode(c.Writer, c.Request)
+		return
+	}
+	if input.RecoveryCode != "" && input.Code == "" {
+		app.audit(c, user.ID, "two_factor.recovery_code_used", nil)
+	}
+
+	err = app.models.Tokens.DeleteTwoFactorToken(input.TwoFactorToken)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	if input.RememberDevice {
+		device, err := app.models.Tokens.NewRememberedDevice(user.ID, rememberDeviceTTL)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     rememberDeviceCookie,
+			Value:    device.Plaintext,
+			Path:     "/auth",
+			MaxAge:   int(rememberDeviceTTL.Seconds()),
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteNoneMode,
+		})
+	}
+
+	app.startSession(c, user, http.StatusOK)
+}
+
+func (app *application) twoFactorStatus(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	enabled, err := app.models.TwoFactor.IsEnabled(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"enabled": enabled})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// enrollTOTP creates a new authenticator secret for the user. It only takes effect
+// once confirmed with a code from the app.
+func (app *application) enrollTOTP(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = app.models.TwoFactor.SetPendingTOTP(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTwoFactorEnabled):
+			app.twoFactorAlreadyEnabled(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusCreated, envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.Email, secret),
+	})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// confirmTOTP enables two-factor authentication and returns the recovery codes. This
+// is the only time the codes are shown.
+func (app *application) confirmTOTP(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		Code      string              `json:"code"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.Validator.CheckField(input.Code != "", "code", "Code is required")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	secret, err := app.models.TwoFactor.GetTOTP(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFound(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+	if secret.Enabled() {
+		app.twoFactorAlreadyEnabled(c.Writer, c.Request)
+		return
+	}
+
+	step, ok := totp.Validate(secret.Secret, input.Code, time.Now())
+	if ok {
+		ok, err = app.models.TwoFactor.UseStep(user.ID, step)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+	}
+	if !ok {
+		app.invalidTwoFactorCode(c.Writer, c.Request)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.NewRecoveryCodes(user.ID, recoveryCodeCount)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"recovery_codes": codes})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+func (app *application) disableTOTP(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	err := app.models.TwoFactor.Disable(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// regenerateRecoveryCodes replaces all recovery codes of the user, used or not.
+func (app *application) regenerateRecoveryCodes(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	enabled, err := app.models.TwoFactor.IsEnabled(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	if !enabled {
+		app.notFound(c.Writer, c.Request)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.NewRecoveryCodes(user.ID, recoveryCodeCount)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"recovery_codes": codes})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
+// stepUp unlocks sensitive actions for the current session for stepUpWindow. Users
+// with two-factor authentication confirm with a code, others with their password.
+// Users with neither have to log in again.
+func (app *application) stepUp(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	sessionID, ok := app.contextGetSession(c.Request)
+	if !ok {
+		app.stepUpRequired(c.Writer, c.Request)
+		return
+	}
+
+	var input struct {
+		Code         string              `json:"code"`
+		RecoveryCode string              `json:"recovery_code"`
+		Password     string              `json:"password"`
+		Validator    validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	accountKey := stepUpAccountKey(user.ID)
+	if app.throttled(c, accountKey) {
+		return
+	}
+
+	enabled, err := app.models.TwoFactor.IsEnabled(user.ID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	switch {
+	case enabled:
+		ok, err = app.verifySecondFactor(user, input.Code, input.RecoveryCode)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+		if !ok {
+			app.recordFailure(c, user.ID, accountKey)
+			app.invalidTwoFactorCode(c.Writer, c.Request)
+			return
+		}
+
+	case user.Password != "":
+		ok, err = password.Matches(input.Password, user.Password)
+		if err != nil {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+		if !ok {
+			app.recordFailure(c, user.ID, accountKey)
+			app.invalidCredentials(c.Writer, c.Request)
+			return
+		}
+
+	default:
+		app.stepUpRequired(c.Writer, c.Request)
+		return
+	}
+
+	err = app.models.Sessions.StepUp(sessionID)
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	app.resetAttempts(accountKey)
+	app.audit(c, user.ID, "step_up", nil)
+
+	c.Status(http.StatusNoContent)
+}
@@ -7,12 +7,13 @@ import (
 	"net/http"
 	"time"
 
-	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
+	"offerland.cc/internal/i18n"
+	"offerland.cc/internal/identity"
 	"offerland.cc/internal/models"
 	"offerland.cc/internal/password"
 	"offerland.cc/internal/request"
@@ -33,6 +34,47 @@ func (app *application) whoAmI(c *gin.Context) {
 	}
 }
 
+// updateLocale changes the preferred locale of the authenticated user. The locale is
+// used to pick the language of the emails we send them.
+func (app *application) updateLocale(c *gin.Context) {
+	user := app.contextGetUser(c.Request)
+
+	var input struct {
+		Locale    string              `json:"preferred_locale"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(c.Writer, c.Request, &input)
+	if err != nil {
+		app.badRequest(c.Writer, c.Request, err)
+		return
+	}
+
+	input.Validator.CheckField(i18n.IsSupported(input.Locale), "preferred_locale", "Locale is not supported")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(c.Writer, c.Request, input.Validator)
+		return
+	}
+
+	user.Locale = input.Locale
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflict(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
+		return
+	}
+
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"user": user})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+	}
+}
+
 func (app *application) Signup(c *gin.Context) {
 	var input struct {
 		Username  string              `json:"username"`
@@ -54,23 +96,19 @@ func (app *application) Signup(c *gin.Context) {
 		return
 	}
 
-	// If the user exists
+	// An existing account is never replaced, not even one that was never activated:
+	// it may have been created by someone else who is about to activate it.
 	if user != nil && user.Activated {
 		input.Validator.AddFieldError("email", "This email address is already in use")
 	}
-
-	// If the user exists but is not activated, delete the existing user record
 	if user != nil && !user.Activated {
-		err = app.models.Users.Delete(user.ID)
-		if err != nil {
-			app.serverError(c.Writer, c.Request, err)
-			return
-		}
+		input.Validator.AddFieldError("email", "This email address is awaiting activation, check your inbox for the activation code")
 	}
 
 	exists, err := app.checkUsernameHelper(input.Username)
-	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
+		return
 	}
 
 	if exists {
@@ -93,6 +131,7 @@ func (app *application) Signup(c *gin.Context) {
 		Username:  input.Username,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    app.requestLocale(c.Request),
 	}
 
 	passwordHash, err := password.Hash(input.Password)
@@ -131,7 +170,7 @@ func (app *application) Signup(c *gin.Context) {
 			"passcode": activationToken.Passcode,
 		}
 
-		err = app.mailer.Send(user.Email, data, "user_activation.tmpl")
+		err = app.mailer.SendLocalized(user.Email, user.Locale, data, "user_activation.tmpl")
 		if err != nil {
 
 			app.serverError(c.Writer, c.Request, err)
@@ -150,37 +189,35 @@ func (app *application) ActivateUser(c *gin.Context) {
 		return
 	}
 
-	params := (&auth.UserToCreate{}).
-		Email(user.Email).
-		EmailVerified(true).
-		Password(user.Password).
-		DisplayName(user.Username).
-		PhotoURL("https://cdn2.iconfinder.com/data/icons/random-outline-3/48/random_14-512.png").
-		Disabled(false)
-
-	newUserRecord, err := app.firebaseClient.CreateUser(context.Background(), params)
+	// Register the user with the identity provider under the ID we already gave
+	// them, then activate the account in place.
+	_, err := app.identity.CreateUser(c, &identity.UserToCreate{
+		UID:           user.ID,
+		Email:         user.Email,
+		EmailVerified: true,
+		DisplayName:   user.Username,
+		PhotoURL:      "https://cdn2.iconfinder.com/data/icons/random-outline-3/48/random_14-512.png",
+	})
 	if err != nil {
-		if err.Error() == "user with the provided email already exists" {
-			app.badRequest(c.Writer, c.Request, err)
-		} else {
+		switch {
+		case errors.Is(err, identity.ErrEmailExists):
+			app.badRequest(c.Writer, c.Request, errors.New("user with the provided email already exists"))
+		default:
 			app.serverError(c.Writer, c.Request, err)
 		}
 		return
 	}
 
-	// Delete old user record and add new user record to database
-	err = app.models.Users.Delete(user.ID)
-	if err != nil {
-		app.serverError(c.Writer, c.Request, err)
-		return
-	}
-
-	user.ID = newUserRecord.UID
 	user.Activated = true
 
-	err = app.models.Users.Insert(user)
+	err = app.models.Users.Update(user)
 	if err != nil {
-		app.serverError(c.Writer, c.Request, err)
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflict(c.Writer, c.Request)
+		default:
+			app.serverError(c.Writer, c.Request, err)
+		}
 		return
 	}
 
@@ -202,10 +239,17 @@ func (app *application) Login(c *gin.Context) {
 		return
 	}
 
+	accountKey, ipKey := loginAccountKey(input.Email), loginIPKey(c)
+	if app.throttled(c, accountKey, ipKey) {
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailure(c, "", accountKey, ipKey)
+			app.audit(c, "", "login.failure", map[string]any{"reason": "unknown_email"})
 			app.invalidCredentials(c.Writer, c.Request)
 		default:
 			app.serverError(c.Writer, c.Request, err)
@@ -213,11 +257,6 @@ func (app *application) Login(c *gin.Context) {
 		return
 	}
 
-	if !user.Activated {
-		app.inactiveAccount(c.Writer, c.Request)
-		return
-	}
-
 	matches, err := password.Matches(input.Password, user.Password)
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
@@ -225,15 +264,33 @@ func (app *application) Login(c *gin.Context) {
 	}
 
 	if !matches {
-
+		app.recordFailure(c, user.ID, accountKey, ipKey)
+		app.audit(c, user.ID, "login.failure", map[string]any{"reason": "wrong_password"})
 		app.invalidCredentials(c.Writer, c.Request)
 		return
 	}
 
-	err = response.JSON(c.Writer, http.StatusOK, nil)
-	if err != nil {
-		app.serverError(c.Writer, c.Request, err)
+	// Only tell the client that the account is inactive once they have proven they
+	// know its password.
+	if !user.Activated {
+		app.inactiveAccount(c.Writer, c.Request)
+		return
 	}
+
+	app.resetAttempts(accountKey)
+	app.audit(c, user.ID, "login.success", nil)
+
+	// Upgrade legacy SHA-256 hashes, and hashes made with weaker settings than the
+	// current ones, now that we have the plaintext password at hand. A failure here
+	// must not prevent the user from logging in.
+	if password.NeedsRehash(user.Password) {
+		err = app.rehashPassword(user, input.Password)
+		if err != nil {
+			app.logger.Error(err)
+		}
+	}
+
+	app.completeLogin(c, user, http.StatusOK)
 }
 
 func (app *application) GoogleLogin(c *gin.Context) {
@@ -248,66 +305,106 @@ func (app *application) GoogleLogin(c *gin.Context) {
 		app.badRequest(c.Writer, c.Request, err)
 		return
 	}
-	if err != nil {
-		app.serverError(c.Writer, c.Request, err)
-	}
 	oauth2Service, err := oauth2.NewService(context.Background(), option.WithoutAuthentication())
 
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
+		return
 	}
 	userInfoService := oauth2.NewUserinfoV2MeService(oauth2Service)
 	userInfo, err := userInfoService.Get().Do(googleapi.QueryParameter("access_token", input.IDToken))
 	if err != nil {
-		// e, _ := err.(*googleapi.Error)
-		// fmt.Println(e.Message)
-		app.serverError(c.Writer, c.Request, err)
-	}
-
-	var user *models.User
-	user, err = app.models.Users.GetByEmail(userInfo.Email)
-	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
-		app.serverError(c.Writer, c.Request, err)
+		app.invalidAuthenticationToken(c.Writer, c.Request)
 		return
 	}
-	if user == nil {
-		user = &models.User{
-			ID:        input.FirebaseID,
-			Username:  userInfo.Name,
-			Email:     userInfo.Email,
-			ISS:       "google",
-			SUB:       userInfo.Id,
-			Activated: true,
-		}
 
-		err = app.models.Users.Insert(user)
+	// Sign in the user the Google account is linked to. Users are never matched by
+	// email address: an existing account has to link Google explicitly first.
+	userID, err := app.models.Identities.GetUserID("google", userInfo.Id)
+	switch {
+	case err == nil:
+		user, err := app.models.Users.Get(userID)
 		if err != nil {
 			app.serverError(c.Writer, c.Request, err)
 			return
 		}
-		// Add the "posts:read" permission for the new user.
-		err = app.models.Permissions.AddForUser(user.ID, "posts:read")
-		if err != nil {
+		app.completeLogin(c, user, http.StatusOK)
+		return
+	case !errors.Is(err, models.ErrRecordNotFound):
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(userInfo.Email)
+	switch {
+	case err == nil:
+		app.identityEmailConflict(c.Writer, c.Request)
+		return
+	case !errors.Is(err, models.ErrRecordNotFound):
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+
+	// Accounts created without a Firebase ID get an ID of our own.
+	userID = input.FirebaseID
+	if userID == "" {
+		userID = uuid.New().String()
+	}
+
+	user := &models.User{
+		ID:        userID,
+		Username:  userInfo.Name,
+		Email:     userInfo.Email,
+		ISS:       "google",
+		SUB:       userInfo.Id,
+		Activated: true,
+		Locale:    app.requestLocale(c.Request),
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			app.identityEmailConflict(c.Writer, c.Request)
+		default:
 			app.serverError(c.Writer, c.Request, err)
-			return
 		}
+		return
 	}
-
-	err = response.JSON(c.Writer, http.StatusOK, nil)
+	err = app.models.Identities.Insert(&models.Identity{
+		Provider: "google",
+		Subject:  userInfo.Id,
+		UserID:   user.ID,
+		Email:    userInfo.Email,
+	})
+	if err != nil {
+		app.serverError(c.Writer, c.Request, err)
+		return
+	}
+	// Add the "posts:read" permission for the new user.
+	err = app.models.Permissions.AddForUser(user.ID, "posts:read")
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
+		return
 	}
+
+	app.startSession(c, user, http.StatusCreated)
 }
 
 func (app *application) Logout(c *gin.Context) {
+	// Delete the session the refresh token belongs to, so that the token cannot be
+	// used again even if it was copied from the browser.
+	sessionID, userID, ok := app.refreshTokenSession(c.Request)
+	if ok {
+		err := app.models.Sessions.Delete(sessionID, userID)
+		if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			app.serverError(c.Writer, c.Request, err)
+			return
+		}
+	}
+
 	// Remove the refresh token cookie from the user's browser.
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:    "REFRESH_TOKEN",
-		Value:   "",
-		Path:    "/",
-		MaxAge:  -1,
-		Expires: time.Now().Add(-time.Hour),
-	})
+	app.clearRefreshTokenCookie(c.Writer)
 
 	// Send a 204 No Content response.
 	c.Status(http.StatusNoContent)
@@ -325,6 +422,12 @@ func (app *application) userForgotPassword(c *gin.Context) {
 		return
 	}
 
+	accountKey, ipKey := passwordResetAccountKey(input.Email), passwordResetIPKey(c)
+	if app.throttled(c, accountKey, ipKey) {
+		return
+	}
+	app.recordFailure(c, "", accountKey, ipKey)
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
@@ -341,6 +444,8 @@ func (app *application) userForgotPassword(c *gin.Context) {
 		return
 	}
 
+	app.audit(c, user.ID, "password_reset.requested", nil)
+
 	token, err := app.models.Tokens.NewResetToken(user.ID, 1*24*time.Hour)
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
@@ -354,7 +459,7 @@ func (app *application) userForgotPassword(c *gin.Context) {
 			"resetLink": fmt.Sprintf("%s/reset-forgot-password/%s", app.config.FRONTEND_URL, token.Plaintext),
 		}
 
-		err = app.mailer.Send(user.Email, data, "user_forgot_password.tmpl")
+		err = app.mailer.SendLocalized(user.Email, user.Locale, data, "user_forgot_password.tmpl")
 		if err != nil {
 			app.serverError(c.Writer, c.Request, err)
 		}
@@ -398,10 +503,16 @@ func (app *application) userForgotPasswordReset(c *gin.Context) { // Parse the p
 	// Retrieve the details of the user associated with the token using the
 	// GetForToken() method (which we will create in a minute). If no matching record
 	// is found, then we let the client know that the token they provided is not valid.
+	ipKey := passcodeIPKey(c)
+	if app.throttled(c, ipKey) {
+		return
+	}
+
 	user, err := app.models.Users.GetForResetToken(input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
+			app.recordFailure(c, "", ipKey)
 			app.invalidAuthenticationToken(c.Writer, c.Request)
 		default:
 			app.serverError(c.Writer, c.Request, err)
@@ -435,6 +546,8 @@ func (app *application) userForgotPasswordReset(c *gin.Context) { // Parse the p
 		app.serverError(c.Writer, c.Request, err)
 		return
 	}
+	app.audit(c, user.ID, "password_reset.completed", nil)
+
 	err = response.JSON(c.Writer, http.StatusOK, envelope{"message": "Password updated successfully"})
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
@@ -467,21 +580,13 @@ func (app *application) checkEmail(c *gin.Context) {
 func (app *application) checkUsername(c *gin.Context) {
 	q := c.Request.URL.Query()
 
-	_, err := app.checkUsernameHelper(q.Get("username"))
+	exists, err := app.checkUsernameHelper(q.Get("username"))
 	if err != nil {
-		switch {
-		case errors.Is(err, models.ErrRecordNotFound):
-			err = response.JSON(c.Writer, http.StatusOK, envelope{"exists": false})
-			if err != nil {
-				app.serverError(c.Writer, c.Request, err)
-			}
-		default:
-			app.serverError(c.Writer, c.Request, err)
-		}
+		app.serverError(c.Writer, c.Request, err)
 		return
 	}
 
-	err = response.JSON(c.Writer, http.StatusOK, envelope{"exists": true})
+	err = response.JSON(c.Writer, http.StatusOK, envelope{"exists": exists})
 	if err != nil {
 		app.serverError(c.Writer, c.Request, err)
 	}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"offerland.cc/internal/identity"
+	"offerland.cc/internal/models"
+)
+
+const (
+	testActivationToken = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	testPasscode        = "123456"
+)
+
+// activationTestApp returns an application whose database holds the unactivated
+// user with an activation token, and the identity provider it registers users with.
+func activationTestApp(t *testing.T, user *models.User) (*application, *identity.Fake, *sync.Mutex) {
+	t.Helper()
+
+	var mu sync.Mutex
+	tdb, db := newTestDB(t)
+	tokenHash := sha256.Sum256([]byte(testActivationToken))
+
+	tdb.handle("FROM auth_attempts", func(args []driver.Value) (*testRows, error) {
+		return &testRows{columns: []string{"locked_until"}}, nil
+	})
+	tdb.handle("INNER JOIN activation_tokens", func(args []driver.Value) (*testRows, error) {
+		if !bytes.Equal(args[0].([]byte), tokenHash[:]) {
+			return userRows(nil), nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return userRows(user), nil
+	})
+	tdb.handle("UPDATE activation_tokens", func(args []driver.Value) (*testRows, error) {
+		return &testRows{
+			columns: []string{"passcode", "attempts"},
+			values:  [][]driver.Value{{testPasscode, int64(1)}},
+		}, nil
+	})
+	tdb.handle("DELETE FROM activation_tokens", func(args []driver.Value) (*testRows, error) {
+		return nil, nil
+	})
+	tdb.handle("FROM users WHERE user_id = $1", func(args []driver.Value) (*testRows, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if args[0] != user.ID {
+			return userRows(nil), nil
+		}
+		return userRows(user), nil
+	})
+	tdb.handle("UPDATE users", func(args []driver.Value) (*testRows, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if args[5] != user.ID || args[6] != int64(user.Version) {
+			return &testRows{columns: []string{"version"}}, nil
+		}
+		user.Activated = args[3].(bool)
+		user.Version++
+		return &testRows{columns: []string{"version"}, values: [][]driver.Value{{int64(user.Version)}}}, nil
+	})
+
+	fake := identity.NewFake()
+	app := &application{identity: fake, models: models.NewModels(db)}
+	return app, fake, &mu
+}
+
+func TestActivateUser(t *testing.T) {
+	user := &models.User{
+		ID:        "3d3bb0ae-7a2e-4f0c-9d1c-9c1b6a0f0f01",
+		CreatedAt: time.Now(),
+		Username:  "ada",
+		Email:     "ada@example.com",
+		Locale:    "en",
+		Version:   1,
+	}
+	app, fake, mu := activationTestApp(t, user)
+	router := newTestRouter(t, app)
+
+	body := `{"passcode": "` + testPasscode + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/activate/"+testActivationToken, bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	mu.Lock()
+	activated := user.Activated
+	mu.Unlock()
+	if !activated {
+		t.Error("user was not activated")
+	}
+
+	registered, ok := fake.User(user.ID)
+	if !ok {
+		t.Fatal("user was not registered with the identity provider")
+	}
+	if registered.Email != user.Email || !registered.EmailVerified || registered.DisplayName != user.Username {
+		t.Errorf("registered user = %+v", registered)
+	}
+
+	// The identity provider now vouches for the account.
+	req = httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+fake.IssueToken(user.ID))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("whoami status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var response struct {
+		User struct {
+			ID        string `json:"user_id"`
+			Activated bool   `json:"activated"`
+		} `json:"user"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.User.ID != user.ID || !response.User.Activated {
+		t.Errorf("whoami user = %+v", response.User)
+	}
+}
+
+func TestActivateUserWithTakenEmail(t *testing.T) {
+	user := &models.User{
+		ID:        "3d3bb0ae-7a2e-4f0c-9d1c-9c1b6a0f0f02",
+		CreatedAt: time.Now(),
+		Username:  "ada",
+		Email:     "ada@example.com",
+		Locale:    "en",
+		Version:   1,
+	}
+	app, fake, mu := activationTestApp(t, user)
+	router := newTestRouter(t, app)
+
+	_, err := fake.CreateUser(context.Background(), &identity.UserToCreate{Email: user.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"passcode": "` + testPasscode + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/activate/"+testActivationToken, bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusBadRequest, rr.Body)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if user.Activated {
+		t.Error("user was activated")
+	}
+	if _, ok := fake.User(user.ID); ok {
+		t.Error("user was registered with the identity provider")
+	}
+}
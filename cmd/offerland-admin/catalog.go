@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"offerland.cc/internal/catalog"
+	"offerland.cc/internal/models"
+)
+
+// catalogImportTimeout bounds an import, which runs in a single transaction.
+const catalogImportTimeout = 5 * time.Minute
+
+// importCatalog imports a CSV or JSON catalog file, or stdin with "-".
+func (a *admin) importCatalog(args []string) error {
+	flags := flag.NewFlagSet("import-catalog", flag.ContinueOnError)
+	format := flags.String("format", "", "csv or json, guessed from the file name by default")
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing anything")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected one file, or - for stdin")
+	}
+	name := flags.Arg(0)
+
+	input := a.stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	if *format == "" {
+		if name == "-" {
+			return errors.New("-format is required when reading stdin")
+		}
+		*format, err = catalog.FormatFromName(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	records, err := catalog.Parse(input, *format)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), catalogImportTimeout)
+	defer cancel()
+
+	report, err := catalog.NewImporter(a.db).Import(ctx, records, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		a.audit("", "catalog.imported", map[string]any{
+			"file":      name,
+			"rows":      report.Rows,
+			"created":   report.Created,
+			"conflicts": len(report.Conflicts),
+		})
+	}
+
+	return a.print(report, func(w io.Writer) error {
+		return printImportReport(w, report)
+	})
+}
+
+func printImportReport(w io.Writer, report *catalog.Report) error {
+	if report.DryRun {
+		fmt.Fprintln(w, "dry run, nothing was written")
+	}
+	fmt.Fprintf(w, "%d rows\n\n", report.Rows)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tCREATED\tUNCHANGED")
+	for _, kind := range []catalog.Kind{catalog.KindSchool, catalog.KindDegree, catalog.KindDepartment, catalog.KindMajor} {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", kind, report.Created[kind], report.Unchanged[kind])
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	if len(report.Errors) > 0 {
+		fmt.Fprintf(w, "\nerrors:\n")
+		for _, issue := range report.Errors {
+			fmt.Fprintf(w, "  row %d: %s %q: %s\n", issue.Row, issue.Kind, issue.Name, issue.Message)
+		}
+	}
+	if len(report.Conflicts) > 0 {
+		fmt.Fprintf(w, "\nconflicts:\n")
+		for _, issue := range report.Conflicts {
+			fmt.Fprintf(w, "  row %d: %s %q: %s\n", issue.Row, issue.Kind, issue.Name, issue.Message)
+		}
+	}
+	if len(report.NearDuplicates) > 0 {
+		fmt.Fprintf(w, "\nnear duplicates:\n")
+		for _, near := range report.NearDuplicates {
+			fmt.Fprintf(w, "  row %d: %s %q looks like %q (%.2f)\n", near.Row, near.Kind, near.Name, near.Similar, near.Similarity)
+		}
+	}
+	return nil
+}
+
+// parseKind accepts the kinds of catalog entries that can have aliases.
+func parseKind(value string) (catalog.Kind, error) {
+	switch kind := catalog.Kind(value); kind {
+	case catalog.KindSchool, catalog.KindMajor:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unknown kind %q, expected school or major", value)
+	}
+}
+
+// searchCatalog prints the schools or majors resembling a name, to find their IDs.
+func (a *admin) searchCatalog(args []string) error {
+	flags := flag.NewFlagSet("catalog-search", flag.ContinueOnError)
+	kindName := flags.String("kind", "school", "school or major")
+	school := flags.String("school", "", "only majors of the school with this ID")
+	limit := flags.Int("limit", 20, "maximum number of results")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("expected a name to search for")
+	}
+	kind, err := parseKind(*kindName)
+	if err != nil {
+		return err
+	}
+
+	var schoolID *uuid.UUID
+	if *school != "" {
+		id, err := uuid.Parse(*school)
+		if err != nil {
+			return fmt.Errorf("invalid school ID %q", *school)
+		}
+		schoolID = &id
+	}
+
+	entries, err := a.models.Catalog.Autocomplete(kind, strings.Join(flags.Args(), " "), schoolID, *limit)
+	if err != nil {
+		return err
+	}
+
+	return a.print(entries, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCHOOL\tMATCHED\tSCORE")
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.2f\n", entry.ID, entry.Name, entry.SchoolName, entry.Matched, entry.Score)
+		}
+		return tw.Flush()
+	})
+}
+
+// aliases lists the aliases of a school or major.
+func (a *admin) aliases(args []string) error {
+	if len(args) != 2 {
+		return errors.New("expected a kind and an ID")
+	}
+	kind, err := parseKind(args[0])
+	if err != nil {
+		return err
+	}
+	id, err := uuid.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", args[1])
+	}
+
+	aliases, err := a.models.Catalog.GetAliases(kind, id)
+	if err != nil {
+		return err
+	}
+
+	return a.print(aliases, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tALIAS\tCREATED")
+		for _, alias := range aliases {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", alias.ID, alias.Alias, alias.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	})
+}
+
+// addAlias adds another name for a school or major.
+func (a *admin) addAlias(args []string) error {
+	if len(args) < 3 {
+		return errors.New("expected a kind, an ID and an alias")
+	}
+	kind, err := parseKind(args[0])
+	if err != nil {
+		return err
+	}
+	id, err := uuid.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", args[1])
+	}
+	name := strings.Join(args[2:], " ")
+	if catalog.Normalize(name) == "" {
+		return errors.New("the alias is empty")
+	}
+
+	alias, err := a.models.Catalog.AddAlias(kind, id, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			return fmt.Errorf("no %s with ID %s", kind, id)
+		case errors.Is(err, models.ErrDuplicateAlias):
+			return fmt.Errorf("%q already names another %s", name, kind)
+		default:
+			return err
+		}
+	}
+	a.audit("", "catalog.alias_added", map[string]any{
+		"kind":      kind,
+		"target_id": id,
+		"alias":     alias.Alias,
+	})
+
+	return a.print(alias, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "added alias %d %q\n", alias.ID, alias.Alias)
+		return err
+	})
+}
+
+// removeAlias deletes an alias of a school or major.
+func (a *admin) removeAlias(args []string) error {
+	if len(args) != 2 {
+		return errors.New("expected a kind and an alias ID")
+	}
+	kind, err := parseKind(args[0])
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid alias ID %q", args[1])
+	}
+
+	err = a.models.Catalog.DeleteAlias(kind, id)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return fmt.Errorf("no %s alias with ID %d", kind, id)
+		}
+		return err
+	}
+	a.audit("", "catalog.alias_deleted", map[string]any{
+		"kind":     kind,
+		"alias_id": id,
+	})
+
+	return a.print(map[string]any{"deleted": id}, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "deleted alias %d\n", id)
+		return err
+	})
+}
+
+// mergeCatalog folds a duplicate school or major into another one.
+func (a *admin) mergeCatalog(args []string) error {
+	if len(args) != 3 {
+		return errors.New("expected a kind, the ID to merge and the ID to merge it into")
+	}
+	kind, err := parseKind(args[0])
+	if err != nil {
+		return err
+	}
+	from, err := uuid.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", args[1])
+	}
+	into, err := uuid.Parse(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", args[2])
+	}
+
+	merge, err := a.models.Catalog.Merge(kind, from, into)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			return fmt.Errorf("both IDs must be existing %ss", kind)
+		case errors.Is(err, models.ErrMergeMismatch):
+			return errors.New("cannot merge an entry into itself, or majors of different schools or degrees")
+		default:
+			return err
+		}
+	}
+	a.audit("", "catalog.merged", map[string]any{
+		"kind":    kind,
+		"from":    from,
+		"into":    into,
+		"results": merge.Results,
+	})
+
+	return a.print(merge, func(w io.Writer) error {
+		fmt.Fprintf(w, "merged %s %s into %s\n", kind, from, into)
+		fmt.Fprintf(w, "  %d results, %d aliases", merge.Results, merge.Aliases)
+		if kind == catalog.KindSchool {
+			fmt.Fprintf(w, ", %d departments, %d majors", merge.Departments, merge.Majors)
+		}
+		_, err := fmt.Fprintln(w, " moved")
+		return err
+	})
+}
@@ -0,0 +1,210 @@
+// Command offerland-admin runs operational tasks against the OfferLand database:
+// managing permissions and accounts, running migrations, importing the catalog and
+// printing statistics.
+//
+// It reads the same configuration as the API, so it can be run from the same
+// directory or container. Every command prints JSON instead of text with -json.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	_ "github.com/lib/pq"
+	"offerland.cc/configs"
+	"offerland.cc/internal/database"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/smtp"
+)
+
+// admin holds the dependencies of the commands.
+type admin struct {
+	cfg    *configs.Config
+	db     *sql.DB
+	models *models.Models
+	json   bool
+	stdout io.Writer
+	stdin  io.Reader
+	// operator is recorded in the audit log as the person who ran the command.
+	operator string
+}
+
+// A command is one subcommand of the CLI. Commands parse their own arguments.
+type command struct {
+	usage   string
+	summary string
+	run     func(a *admin, args []string) error
+}
+
+var commands = map[string]command{
+	"grant":             {"grant <user> <permission>...", "grant permissions to a user", (*admin).grant},
+	"revoke":            {"revoke <user> <permission>...", "take permissions away from a user", (*admin).revoke},
+	"permissions":       {"permissions [<user>]", "list the permissions of a user, or all permissions", (*admin).permissions},
+	"create-admin":      {"create-admin -email <email> -username <name> [-password-stdin]", "create an activated user with the admin permission", (*admin).createAdmin},
+	"activate":          {"activate <user>", "activate an account without an activation code", (*admin).activate},
+	"deactivate":        {"deactivate <user>", "deactivate an account and sign it out everywhere", (*admin).deactivate},
+	"resend-activation": {"resend-activation <user>", "send a new activation email", (*admin).resendActivation},
+	"migrate":           {"migrate up|down N|status", "manage the database schema", (*admin).migrate},
+	"import-catalog":    {"import-catalog [-format csv|json] [-dry-run] <file>", "import schools, degrees, departments and majors", (*admin).importCatalog},
+	"catalog-search":    {"catalog-search [-kind school|major] [-school <id>] <name>", "find schools or majors by name or alias", (*admin).searchCatalog},
+	"aliases":           {"aliases school|major <id>", "list the aliases of a school or major", (*admin).aliases},
+	"add-alias":         {"add-alias school|major <id> <alias>", "add another name for a school or major", (*admin).addAlias},
+	"remove-alias":      {"remove-alias school|major <alias-id>", "delete an alias", (*admin).removeAlias},
+	"merge-catalog":     {"merge-catalog school|major <from-id> <into-id>", "fold a duplicate into another entry and re-point its results", (*admin).mergeCatalog},
+	"stats":             {"stats", "print record counts", (*admin).stats},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: offerland-admin [-json] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Users are given by email address or user ID.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].summary)
+	}
+	tw.Flush()
+}
+
+func main() {
+	flags := flag.NewFlagSet("offerland-admin", flag.ContinueOnError)
+	flags.Usage = func() { usage(os.Stderr) }
+	asJSON := flags.Bool("json", false, "print JSON instead of text")
+
+	err := flags.Parse(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() == 0 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "offerland-admin: unknown command %q\n\n", flags.Arg(0))
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	a := &admin{json: *asJSON, stdout: os.Stdout, stdin: os.Stdin, operator: operator()}
+	err = a.open()
+	if err == nil {
+		err = cmd.run(a, flags.Args()[1:])
+		a.db.Close()
+	}
+	if err != nil {
+		a.fail(err)
+		os.Exit(1)
+	}
+}
+
+// open loads the configuration and connects to the database. Migrations are never
+// applied implicitly, so that "migrate down" does not first apply everything.
+func (a *admin) open() error {
+	cfg, err := configs.LoadConfig(".")
+	if err != nil {
+		return err
+	}
+
+	db, err := database.New(cfg.DB_DSN, false, cfg.DB_MAX_OPEN_CONNS, cfg.DB_MAX_IDLE_CONNS, cfg.DB_MAX_IDLE_TIME)
+	if err != nil {
+		return err
+	}
+
+	a.cfg = cfg
+	a.db = db
+	a.models = models.NewModels(db)
+	return nil
+}
+
+// print writes v as JSON with -json, and calls text to describe it otherwise.
+func (a *admin) print(v any, text func(w io.Writer) error) error {
+	if a.json {
+		return json.NewEncoder(a.stdout).Encode(v)
+	}
+	return text(a.stdout)
+}
+
+// fail reports err on stderr, as JSON with -json so that scripts can parse it.
+func (a *admin) fail(err error) {
+	if a.json {
+		json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "offerland-admin: %s\n", err)
+}
+
+// findUser looks a user up by email address, or by user ID when ref is not an email
+// address.
+func (a *admin) findUser(ref string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if strings.Contains(ref, "@") {
+		user, err = a.models.Users.GetByEmail(ref)
+	} else {
+		user, err = a.models.Users.Get(ref)
+	}
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+// audit records an action taken on a user's account. A failure to record it does not
+// undo the action, so it is only reported.
+func (a *admin) audit(userID, event string, metadata map[string]any) {
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadata["operator"] = a.operator
+
+	err := a.models.Audit.Insert(&models.AuditEntry{
+		UserID:    userID,
+		Event:     event,
+		UserAgent: "offerland-admin",
+		Metadata:  metadata,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "offerland-admin: recording %s in the audit log: %s\n", event, err)
+	}
+}
+
+func operator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// newMailTransport returns the mail transport selected by MAIL_TRANSPORT, like the
+// API does.
+func newMailTransport(cfg *configs.Config) (smtp.Transport, error) {
+	switch cfg.MAIL_TRANSPORT {
+	case "smtp", "":
+		return smtp.NewSMTPTransport(cfg.SMTP_HOST, cfg.SMTP_PORT, cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD), nil
+	case "file":
+		return smtp.NewFileTransport(cfg.MAIL_DIR)
+	case "capture":
+		return nil, errors.New("MAIL_TRANSPORT=capture cannot deliver mail from the admin CLI")
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", cfg.MAIL_TRANSPORT)
+	}
+}
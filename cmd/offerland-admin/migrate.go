@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+
+	"offerland.cc/internal/database"
+)
+
+// migrate manages the schema with the migrations embedded in the binary, like
+// "api migrate" does.
+func (a *admin) migrate(args []string) error {
+	command, args, err := database.ParseMigrateCommand(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return errors.New("expected up, down N or status")
+	}
+
+	result, err := database.RunMigrateCommand(a.db, command)
+	if err != nil {
+		return err
+	}
+	return a.print(result.JSON(), result.WriteText)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+func (a *admin) stats(args []string) error {
+	if len(args) != 0 {
+		return errors.New("stats takes no arguments")
+	}
+
+	stats, err := a.models.Stats.Get()
+	if err != nil {
+		return err
+	}
+
+	return a.print(stats, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "users\t%d\n", stats.Users)
+		fmt.Fprintf(tw, "activated users\t%d\n", stats.ActivatedUsers)
+		fmt.Fprintf(tw, "pending deletion\t%d\n", stats.PendingDeletion)
+		fmt.Fprintf(tw, "active sessions\t%d\n", stats.ActiveSessions)
+		fmt.Fprintf(tw, "posts\t%d\n", stats.Posts)
+		fmt.Fprintf(tw, "results\t%d\n", stats.Results)
+		fmt.Fprintf(tw, "schools\t%d\n", stats.Schools)
+		fmt.Fprintf(tw, "majors\t%d\n", stats.Majors)
+		return tw.Flush()
+	})
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+	"github.com/google/uuid"
+	"google.golang.org/api/option"
+	"offerland.cc/internal/identity"
+	"offerland.cc/internal/models"
+	"offerland.cc/internal/password"
+	"offerland.cc/internal/smtp"
+	"offerland.cc/internal/validator"
+)
+
+// activationTokenTTL matches the lifetime of the activation tokens sent at signup.
+const activationTokenTTL = 24 * time.Hour
+
+type userPermissions struct {
+	UserID      string             `json:"user_id"`
+	Email       string             `json:"email"`
+	Permissions models.Permissions `json:"permissions"`
+}
+
+func (a *admin) grant(args []string) error {
+	return a.changePermissions(args, true)
+}
+
+func (a *admin) revoke(args []string) error {
+	return a.changePermissions(args, false)
+}
+
+func (a *admin) changePermissions(args []string, grant bool) error {
+	if len(args) < 2 {
+		return errors.New("expected a user and at least one permission")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	codes := args[1:]
+
+	known, err := a.models.Permissions.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if !known.Include(code) {
+			return fmt.Errorf("unknown permission %q, expected one of %s", code, strings.Join(known, ", "))
+		}
+	}
+
+	event := "admin.permissions_granted"
+	if grant {
+		err = a.models.Permissions.AddForUser(user.ID, codes...)
+	} else {
+		event = "admin.permissions_revoked"
+		err = a.models.Permissions.RemoveForUser(user.ID, codes...)
+	}
+	if err != nil {
+		return err
+	}
+	a.audit(user.ID, event, map[string]any{"permissions": codes})
+
+	return a.printPermissions(user)
+}
+
+func (a *admin) permissions(args []string) error {
+	switch len(args) {
+	case 0:
+		known, err := a.models.Permissions.GetAll()
+		if err != nil {
+			return err
+		}
+		return a.print(map[string]any{"permissions": known}, func(w io.Writer) error {
+			for _, code := range known {
+				fmt.Fprintln(w, code)
+			}
+			return nil
+		})
+	case 1:
+		user, err := a.findUser(args[0])
+		if err != nil {
+			return err
+		}
+		return a.printPermissions(user)
+	default:
+		return errors.New("expected at most one user")
+	}
+}
+
+func (a *admin) printPermissions(user *models.User) error {
+	permissions, err := a.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if permissions == nil {
+		permissions = models.Permissions{}
+	}
+
+	result := userPermissions{UserID: user.ID, Email: user.Email, Permissions: permissions}
+	return a.print(result, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%s (%s): %s\n", user.Email, user.ID, strings.Join(permissions, ", "))
+		return err
+	})
+}
+
+// createAdmin creates an activated account with the admin permission. The password
+// is read from stdin with -password-stdin; otherwise a random one is generated and
+// printed once.
+func (a *admin) createAdmin(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the account")
+	username := flags.String("username", "", "username of the account")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	plaintext := ""
+	generated := false
+	if *passwordStdin {
+		line, err := bufio.NewReader(a.stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		plaintext = strings.TrimRight(line, "\r\n")
+	} else {
+		plaintext, err = randomPassword()
+		if err != nil {
+			return err
+		}
+		generated = true
+	}
+
+	v := validator.Validator{}
+	v.CheckField(validator.Matches(*email, validator.RgxEmail), "email", "Must be a valid email address")
+	v.CheckField(validator.NotBlank(*username), "username", "Must be provided")
+	v.CheckField(len(plaintext) >= 8, "password", "Password is too short, must be at least 8 characters")
+	v.CheckField(len(plaintext) <= 72, "password", "Password is too long, must be at most 72 characters")
+	v.CheckField(validator.NotIn(plaintext, password.CommonPasswords...), "password", "Password is too common")
+	if v.HasErrors() {
+		return validationError(v)
+	}
+
+	taken, err := a.models.Users.UsernameTaken(*username)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("the username %q is already in use", *username)
+	}
+
+	err = password.Configure(password.Params{
+		Algorithm:     a.cfg.PASSWORD_HASH_ALGORITHM,
+		BcryptCost:    a.cfg.PASSWORD_BCRYPT_COST,
+		Argon2Memory:  a.cfg.PASSWORD_ARGON2_MEMORY,
+		Argon2Time:    a.cfg.PASSWORD_ARGON2_TIME,
+		Argon2Threads: a.cfg.PASSWORD_ARGON2_THREADS,
+	})
+	if err != nil {
+		return err
+	}
+	passwordHash, err := password.Hash(plaintext)
+	if err != nil {
+		return err
+	}
+
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Username:  *username,
+		Email:     *email,
+		Password:  passwordHash,
+		Activated: true,
+	}
+	err = a.models.Users.Insert(user)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			return fmt.Errorf("the email address %q is already in use", *email)
+		}
+		return err
+	}
+
+	err = a.models.Permissions.AddForUser(user.ID, "posts:read", "posts:write", "admin")
+	if err != nil {
+		return err
+	}
+	a.audit(user.ID, "admin.user_created", map[string]any{"admin": true})
+
+	result := map[string]any{"user_id": user.ID, "email": user.Email, "username": user.Username}
+	if generated {
+		result["password"] = plaintext
+	}
+	return a.print(result, func(w io.Writer) error {
+		fmt.Fprintf(w, "created admin %s (%s)\n", user.Email, user.ID)
+		if generated {
+			fmt.Fprintf(w, "password: %s\n", plaintext)
+		}
+		return nil
+	})
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 18)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func validationError(v validator.Validator) error {
+	var problems []string
+	problems = append(problems, v.Errors...)
+	for field, message := range v.FieldErrors {
+		problems = append(problems, fmt.Sprintf("%s: %s", field, message))
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// activate activates an account that was never activated, and enables one that was
+// deactivated.
+func (a *admin) activate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected one user")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	activated := !user.Activated
+	if activated {
+		user.Activated = true
+		err = a.models.Users.Update(user)
+		if err != nil {
+			return err
+		}
+	}
+	err = a.models.Tokens.DeleteActivationTokensForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	enabled, err := a.models.Users.Enable(user.ID)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		err = a.setProviderDisabled(user.ID, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	changed := activated || enabled
+	if changed {
+		a.audit(user.ID, "admin.user_activated", nil)
+	}
+	return a.printActivation(user, false, changed)
+}
+
+// deactivate stops an account from signing in and ends its sessions, which signs it
+// out of every device that uses our own tokens. The account stays activated, so that
+// the cleanup job does not delete it and its email address stays taken.
+func (a *admin) deactivate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected one user")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+
+	changed, err := a.models.Users.Disable(user.ID)
+	if err != nil {
+		return err
+	}
+	err = a.setProviderDisabled(user.ID, true)
+	if err != nil {
+		return err
+	}
+	err = a.models.Sessions.DeleteAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if changed {
+		a.audit(user.ID, "admin.user_deactivated", nil)
+	}
+	return a.printActivation(user, true, changed)
+}
+
+// setProviderDisabled disables or enables the user with the identity provider, so
+// that it stops or resumes issuing tokens for them. Users that only exist in our own
+// database need no outside call.
+func (a *admin) setProviderDisabled(userID string, disabled bool) error {
+	if a.cfg.IDENTITY_PROVIDER != "firebase" {
+		return nil
+	}
+
+	ctx := context.Background()
+	firebaseApp, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(a.cfg.FIREBASE_CONFIG))
+	if err != nil {
+		return err
+	}
+	client, err := firebaseApp.Auth(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting Auth client: %w", err)
+	}
+	provider := identity.NewFirebase(client)
+
+	if disabled {
+		err = provider.DisableUser(ctx, userID)
+	} else {
+		err = provider.EnableUser(ctx, userID)
+	}
+	if err != nil && !errors.Is(err, identity.ErrUserNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (a *admin) printActivation(user *models.User, disabled, changed bool) error {
+	result := map[string]any{"user_id": user.ID, "email": user.Email, "activated": user.Activated, "disabled": disabled, "changed": changed}
+	return a.print(result, func(w io.Writer) error {
+		state := "activated"
+		if disabled {
+			state = "deactivated"
+		}
+		if !changed {
+			state = "already " + state
+		}
+		_, err := fmt.Fprintf(w, "%s (%s) %s\n", user.Email, user.ID, state)
+		return err
+	})
+}
+
+// resendActivation replaces the activation tokens of an account that is not activated
+// yet, and emails the new passcode. The client that signed up only knows the old
+// token, so the email also links to the activation page for the new one.
+func (a *admin) resendActivation(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected one user")
+	}
+
+	user, err := a.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	if user.Activated {
+		return fmt.Errorf("%s is already activated", user.Email)
+	}
+
+	transport, err := newMailTransport(a.cfg)
+	if err != nil {
+		return err
+	}
+	mailer := smtp.NewMailer(transport, a.cfg.SMTP_FROM)
+
+	err = a.models.Tokens.DeleteActivationTokensForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	token, err := a.models.Tokens.NewActivationToken(user.ID, activationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]any{
+		"username":       user.Username,
+		"passcode":       token.Passcode,
+		"activationLink": fmt.Sprintf("%s/activate/%s", a.cfg.FRONTEND_URL, token.Plaintext),
+	}
+	err = mailer.SendLocalized(user.Email, user.Locale, data, "user_activation.tmpl")
+	if err != nil {
+		return err
+	}
+	a.audit(user.ID, "admin.activation_resent", nil)
+
+	result := map[string]any{"user_id": user.ID, "email": user.Email, "expiry": token.Expiry}
+	return a.print(result, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "sent a new activation email to %s\n", user.Email)
+		return err
+	})
+}
@@ -1,7 +1,9 @@
 package configs
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -18,9 +20,17 @@ type Config struct {
 	DB_MAX_IDLE_TIME  string `mapstructure:"DB_MAX_IDLE_TIME"`
 
 	ACCESS_TOKEN_SECRET  string `mapstructure:"ACCESS_TOKEN_SECRET"`
-	ACCESS_TOKEN_TTL     string `mapsctructure:"ACCESS_TOKEN_TTL"`
-	REFRESH_TOKEN_SECRET string `mapsctructure:"REFRESH_TOKEN_SECRET"`
-	REFRESH_TOKEN_TTL    string `mapsctructure:"REFRESH_TOKEN_TTL"`
+	ACCESS_TOKEN_TTL     string `mapstructure:"ACCESS_TOKEN_TTL"`
+	REFRESH_TOKEN_SECRET string `mapstructure:"REFRESH_TOKEN_SECRET"`
+	REFRESH_TOKEN_TTL    string `mapstructure:"REFRESH_TOKEN_TTL"`
+	JWT_ALGORITHM        string `mapstructure:"JWT_ALGORITHM"`
+	JWT_ED25519_SEED     string `mapstructure:"JWT_ED25519_SEED"`
+
+	PASSWORD_HASH_ALGORITHM string `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	PASSWORD_BCRYPT_COST    int    `mapstructure:"PASSWORD_BCRYPT_COST"`
+	PASSWORD_ARGON2_MEMORY  uint32 `mapstructure:"PASSWORD_ARGON2_MEMORY"`
+	PASSWORD_ARGON2_TIME    uint32 `mapstructure:"PASSWORD_ARGON2_TIME"`
+	PASSWORD_ARGON2_THREADS uint8  `mapstructure:"PASSWORD_ARGON2_THREADS"`
 
 	SMTP_HOST     string `mapstructure:"SMTP_HOST"`
 	SMTP_PORT     int    `mapstructure:"SMTP_PORT"`
@@ -28,9 +38,47 @@ type Config struct {
 	SMTP_PASSWORD string `mapstructure:"SMTP_PASSWORD"`
 	SMTP_FROM     string `mapstructure:"SMTP_FROM"`
 
+	MAIL_TRANSPORT string `mapstructure:"MAIL_TRANSPORT"`
+	MAIL_DIR       string `mapstructure:"MAIL_DIR"`
+
 	GOOGLE_CLIENT_ID string `mapstructure:"GOOGLE_CLIENT_ID"`
 
-	FIREBASE_CONFIG string `mapstructure:"FIREBASE_CONFIG"`
+	// OIDC_PROVIDERS is a comma-separated list of login providers, e.g.
+	// "google,github". Each one is configured by OIDC_<NAME>_* variables, which are
+	// collected into OIDCProviders.
+	OIDC_PROVIDERS string         `mapstructure:"OIDC_PROVIDERS"`
+	OIDCProviders  []OIDCProvider `mapstructure:"-"`
+
+	IDENTITY_PROVIDER string `mapstructure:"IDENTITY_PROVIDER"`
+	FIREBASE_CONFIG   string `mapstructure:"FIREBASE_CONFIG"`
+
+	// Rate limits are written as "<requests>/<period>", e.g. "60/1m"; "0" disables
+	// a limit.
+	RATE_LIMIT_ENABLED bool   `mapstructure:"RATE_LIMIT_ENABLED"`
+	RATE_LIMIT_BACKEND string `mapstructure:"RATE_LIMIT_BACKEND"`
+	RATE_LIMIT_GLOBAL  string `mapstructure:"RATE_LIMIT_GLOBAL"`
+	RATE_LIMIT_AUTH    string `mapstructure:"RATE_LIMIT_AUTH"`
+	RATE_LIMIT_LOOKUP  string `mapstructure:"RATE_LIMIT_LOOKUP"`
+	RATE_LIMIT_WRITE   string `mapstructure:"RATE_LIMIT_WRITE"`
+
+	ACCOUNT_DELETION_GRACE_PERIOD string `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+
+	CLEANUP_UNACTIVATED_TTL string `mapstructure:"CLEANUP_UNACTIVATED_TTL"`
+	CLEANUP_EXPIRED_TTL     string `mapstructure:"CLEANUP_EXPIRED_TTL"`
+
+	SCHEDULER_BACKEND string `mapstructure:"SCHEDULER_BACKEND"`
+
+	// TRUSTED_PLATFORM is the header a hosting platform puts the client IP in, e.g.
+	// "Fly-Client-IP". TRUSTED_PROXIES is a comma-separated list of the IPs and CIDRs
+	// of reverse proxies whose X-Forwarded-For is believed. Neither is trusted by
+	// default, so that clients cannot pick the IP they are rate limited by.
+	TRUSTED_PLATFORM string `mapstructure:"TRUSTED_PLATFORM"`
+	TRUSTED_PROXIES  string `mapstructure:"TRUSTED_PROXIES"`
+
+	// EXPORT_MIN_GROUP_SIZE is the k of the k-anonymity of bulk exports, and the
+	// number of applicants a decision must have been given to for it to be shown among
+	// the comparable cases of predictions.
+	EXPORT_MIN_GROUP_SIZE int `mapstructure:"EXPORT_MIN_GROUP_SIZE"`
 }
 
 func LoadConfig(path string) (config *Config, err error) {
@@ -44,10 +92,18 @@ func LoadConfig(path string) (config *Config, err error) {
 	viper.SetDefault("DB_MAX_IDLE_CONNS", 25)
 	viper.SetDefault("DB_MAX_IDLE_TIME", "15m")
 
-	viper.SetDefault("ACCESS_TOKEN_SECRET", "secret")
+	viper.SetDefault("ACCESS_TOKEN_SECRET", "")
 	viper.SetDefault("ACCESS_TOKEN_TTL", "15m")
-	viper.SetDefault("REFRESH_TOKEN_SECRET", "secret")
+	viper.SetDefault("REFRESH_TOKEN_SECRET", "")
 	viper.SetDefault("REFRESH_TOKEN_TTL", "168h")
+	viper.SetDefault("JWT_ALGORITHM", "HS256")
+	viper.SetDefault("JWT_ED25519_SEED", "")
+
+	viper.SetDefault("PASSWORD_HASH_ALGORITHM", "argon2id")
+	viper.SetDefault("PASSWORD_BCRYPT_COST", 12)
+	viper.SetDefault("PASSWORD_ARGON2_MEMORY", 64*1024)
+	viper.SetDefault("PASSWORD_ARGON2_TIME", 3)
+	viper.SetDefault("PASSWORD_ARGON2_THREADS", 2)
 
 	viper.SetDefault("SMTP_HOST", "smtp.gmail.com")
 	viper.SetDefault("SMTP_PORT", 587)
@@ -55,10 +111,35 @@ func LoadConfig(path string) (config *Config, err error) {
 	viper.SetDefault("SMTP_PASSWORD", "")
 	viper.SetDefault("SMTP_FROM", "")
 
+	viper.SetDefault("MAIL_TRANSPORT", "smtp")
+	viper.SetDefault("MAIL_DIR", "./mail")
+
 	viper.SetDefault("GOOGLE_CLIENT_ID", "")
 
+	viper.SetDefault("OIDC_PROVIDERS", "")
+
+	viper.SetDefault("IDENTITY_PROVIDER", "")
 	viper.SetDefault("FIREBASE_CONFIG", "")
 
+	viper.SetDefault("RATE_LIMIT_ENABLED", true)
+	viper.SetDefault("RATE_LIMIT_BACKEND", "memory")
+	viper.SetDefault("RATE_LIMIT_GLOBAL", "300/1m")
+	viper.SetDefault("RATE_LIMIT_AUTH", "20/1m")
+	viper.SetDefault("RATE_LIMIT_LOOKUP", "10/1m")
+	viper.SetDefault("RATE_LIMIT_WRITE", "60/1m")
+
+	viper.SetDefault("ACCOUNT_DELETION_GRACE_PERIOD", "720h")
+
+	viper.SetDefault("CLEANUP_UNACTIVATED_TTL", "72h")
+	viper.SetDefault("CLEANUP_EXPIRED_TTL", "24h")
+
+	viper.SetDefault("SCHEDULER_BACKEND", "postgres")
+
+	viper.SetDefault("TRUSTED_PLATFORM", "")
+	viper.SetDefault("TRUSTED_PROXIES", "")
+
+	viper.SetDefault("EXPORT_MIN_GROUP_SIZE", 5)
+
 	if os.Getenv("ENV") == "dev" || os.Getenv("ENV") == "" {
 		viper.AddConfigPath(path)
 		viper.SetConfigName(".env")
@@ -74,5 +155,70 @@ func LoadConfig(path string) (config *Config, err error) {
 		return nil, err
 	}
 
+	config.OIDCProviders = loadOIDCProviders(config.OIDC_PROVIDERS, config.FRONTEND_URL)
+	config.IDENTITY_PROVIDER = defaultIdentityProvider(config.IDENTITY_PROVIDER, config.FIREBASE_CONFIG)
+
 	return config, nil
 }
+
+// defaultIdentityProvider returns the identity provider to use when
+// IDENTITY_PROVIDER is not set. Firebase ID tokens used to be accepted
+// unconditionally, so deployments with a FIREBASE_CONFIG keep accepting them.
+func defaultIdentityProvider(provider string, firebaseConfig string) string {
+	switch {
+	case provider != "":
+		return provider
+	case firebaseConfig != "":
+		return "firebase"
+	default:
+		return "jwt"
+	}
+}
+
+// OIDCProvider holds the settings of one login provider. Issuer is only needed for
+// providers without a preset, or to point a preset at another issuer.
+type OIDCProvider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	RedirectURL  string
+	Scopes       []string
+}
+
+func loadOIDCProviders(names string, frontendURL string) []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := fmt.Sprintf("OIDC_%s_", strings.ToUpper(name))
+
+		provider := OIDCProvider{
+			Name:         name,
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+			Issuer:       viper.GetString(prefix + "ISSUER"),
+			RedirectURL:  viper.GetString(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(viper.GetString(prefix + "SCOPES")),
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = oidcCallbackURL(frontendURL, name)
+		}
+
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// OIDCCallbackURL returns the frontend page that completes a login with the named
+// provider, the default redirect URL of the provider.
+func (c *Config) OIDCCallbackURL(name string) string {
+	return oidcCallbackURL(c.FRONTEND_URL, name)
+}
+
+func oidcCallbackURL(frontendURL string, name string) string {
+	return strings.TrimSuffix(frontendURL, "/") + "/auth/callback/" + name
+}
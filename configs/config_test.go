@@ -0,0 +1,23 @@
+package configs
+
+import "testing"
+
+func TestDefaultIdentityProvider(t *testing.T) {
+	tests := []struct {
+		provider       string
+		firebaseConfig string
+		want           string
+	}{
+		{"", "", "jwt"},
+		{"", "firebase.json", "firebase"},
+		{"jwt", "firebase.json", "jwt"},
+		{"fake", "", "fake"},
+	}
+
+	for _, tt := range tests {
+		got := defaultIdentityProvider(tt.provider, tt.firebaseConfig)
+		if got != tt.want {
+			t.Errorf("defaultIdentityProvider(%q, %q) = %q, want %q", tt.provider, tt.firebaseConfig, got, tt.want)
+		}
+	}
+}
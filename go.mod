@@ -13,6 +13,7 @@ require (
 	github.com/spf13/viper v1.14.0
 	golang.org/x/crypto v0.4.0
 	golang.org/x/exp v0.0.0-20221212164502-fae10dda9338
+	golang.org/x/oauth2 v0.3.0
 	golang.org/x/text v0.5.0
 	google.golang.org/api v0.105.0
 	gopkg.in/mail.v2 v2.3.1
@@ -58,7 +59,6 @@ require (
 	github.com/ugorji/go/codec v1.2.7 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/net v0.4.0 // indirect
-	golang.org/x/oauth2 v0.3.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.3.0 // indirect
 	golang.org/x/time v0.1.0 // indirect
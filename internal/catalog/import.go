@@ -0,0 +1,438 @@
+// Package catalog imports the catalog of schools, degrees, departments and majors
+// that results and posts refer to, from CSV or JSON files.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of catalog entries.
+type Kind string
+
+const (
+	KindSchool     Kind = "school"
+	KindDegree     Kind = "degree"
+	KindDepartment Kind = "department"
+	KindMajor      Kind = "major"
+)
+
+// NearDuplicateThreshold is the Similarity from which a new entry is reported as a
+// possible duplicate of an existing one.
+const NearDuplicateThreshold = 0.85
+
+// importLockKey is the advisory lock that serializes imports, so that two of them
+// cannot create the same entry twice.
+const importLockKey = 4_180_552_907
+
+// idNamespace derives the IDs of new entries from their names, so that importing the
+// same file into two databases gives every entry the same ID in both.
+var idNamespace = uuid.MustParse("6f1d8c3e-2b4a-5e7f-9a0c-1d2e3f4a5b6c")
+
+// An Issue is a problem with one row of the imported file. Rows with errors or
+// conflicts are skipped from the entry the issue is about.
+type Issue struct {
+	Row     int    `json:"row"`
+	Kind    Kind   `json:"kind,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// A NearDuplicate is a new entry whose name is very close to an entry that already
+// exists under the same parent. It is imported anyway, and left for an operator to
+// check.
+type NearDuplicate struct {
+	Row        int       `json:"row"`
+	Kind       Kind      `json:"kind"`
+	Name       string    `json:"name"`
+	ID         uuid.UUID `json:"id"`
+	Similar    string    `json:"similar"`
+	SimilarID  uuid.UUID `json:"similar_id"`
+	Similarity float64   `json:"similarity"`
+}
+
+// A Report describes what an import did, or would do in a dry run.
+type Report struct {
+	DryRun bool `json:"dry_run"`
+	Rows   int  `json:"rows"`
+	// Created counts the new entries of each kind, Unchanged the existing entries
+	// the file mentions.
+	Created        map[Kind]int    `json:"created"`
+	Unchanged      map[Kind]int    `json:"unchanged"`
+	Conflicts      []Issue         `json:"conflicts"`
+	NearDuplicates []NearDuplicate `json:"near_duplicates"`
+	Errors         []Issue         `json:"errors"`
+}
+
+// Importer upserts catalog records into the schools, degrees, departments and majors
+// tables. Entries are matched by their normalized name under the same parent, so
+// importing a file again changes nothing.
+type Importer struct {
+	DB *sql.DB
+}
+
+func NewImporter(db *sql.DB) *Importer {
+	return &Importer{DB: db}
+}
+
+// Import adds the entries of records that do not exist yet. With dryRun nothing is
+// written, but the report is the same as for a real import.
+func (im *Importer) Import(ctx context.Context, records []Record, dryRun bool) (*Report, error) {
+	tx, err := im.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, importLockKey)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newPlan()
+	err = p.load(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := p.apply(records)
+	report.DryRun = dryRun
+	if dryRun {
+		return report, nil
+	}
+
+	for _, e := range p.created {
+		err = e.insert(ctx, tx)
+		if err != nil {
+			return nil, fmt.Errorf("catalog: row %d: %w", e.row, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// An entry is a school, degree, department or major, existing or about to be created.
+type entry struct {
+	kind  Kind
+	id    uuid.UUID
+	name  string
+	key   string
+	form  keyForm
+	scope string
+	// parents are the IDs of the school, degree and department the entry belongs
+	// to, as far as they apply to its kind.
+	parents []uuid.UUID
+
+	existing bool
+	seen     bool
+	row      int
+}
+
+func (e *entry) insert(ctx context.Context, tx *sql.Tx) error {
+	var query string
+	switch e.kind {
+	case KindSchool:
+		query = `INSERT INTO schools (school_id, school_name) VALUES ($1, $2) ON CONFLICT (school_id) DO NOTHING`
+	case KindDegree:
+		query = `INSERT INTO degrees (degree_id, degree_name) VALUES ($1, $2) ON CONFLICT (degree_id) DO NOTHING`
+	case KindDepartment:
+		query = `
+			INSERT INTO departments (department_id, department_name, school_id, degree_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (department_id) DO NOTHING`
+	case KindMajor:
+		query = `
+			INSERT INTO majors (major_id, major_name, school_id, degree_id, department_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (major_id) DO NOTHING`
+	}
+
+	args := []any{e.id, e.name}
+	for _, parent := range e.parents {
+		args = append(args, parent)
+	}
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// plan holds the catalog as it is in the database plus the entries the import
+// creates, indexed for matching names and finding near duplicates.
+type plan struct {
+	byKey map[Kind]map[string]*entry
+	byID  map[Kind]map[uuid.UUID]*entry
+	// words indexes entries by the stems of the distinctive words of their keys, by
+	// kind and scope.
+	words   map[Kind]map[string]map[string][]*entry
+	created []*entry
+	report  *Report
+}
+
+func newPlan() *plan {
+	p := &plan{
+		byKey: map[Kind]map[string]*entry{},
+		byID:  map[Kind]map[uuid.UUID]*entry{},
+		words: map[Kind]map[string]map[string][]*entry{},
+		report: &Report{
+			Created:        map[Kind]int{},
+			Unchanged:      map[Kind]int{},
+			Conflicts:      []Issue{},
+			NearDuplicates: []NearDuplicate{},
+			Errors:         []Issue{},
+		},
+	}
+	for _, kind := range []Kind{KindSchool, KindDegree, KindDepartment, KindMajor} {
+		p.byKey[kind] = map[string]*entry{}
+		p.byID[kind] = map[uuid.UUID]*entry{}
+		p.words[kind] = map[string]map[string][]*entry{}
+		p.report.Created[kind] = 0
+		p.report.Unchanged[kind] = 0
+	}
+	return p
+}
+
+func (p *plan) load(ctx context.Context, tx *sql.Tx) error {
+	queries := []struct {
+		kind    Kind
+		query   string
+		parents int
+	}{
+		{KindSchool, `SELECT school_id, school_name FROM schools`, 0},
+		{KindDegree, `SELECT degree_id, degree_name FROM degrees`, 0},
+		{KindDepartment, `SELECT department_id, department_name, school_id, degree_id FROM departments`, 2},
+		{KindMajor, `SELECT major_id, major_name, school_id, degree_id, department_id FROM majors`, 3},
+	}
+
+	for _, q := range queries {
+		rows, err := tx.QueryContext(ctx, q.query)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			e := &entry{kind: q.kind, existing: true, parents: make([]uuid.UUID, q.parents)}
+			dest := []any{&e.id, &e.name}
+			for i := range e.parents {
+				dest = append(dest, &e.parents[i])
+			}
+			err := rows.Scan(dest...)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			e.key = Normalize(e.name)
+			e.form = newKeyForm(e.key)
+			e.scope = scopeOf(e.parents)
+			p.add(e)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeOf identifies the parent an entry's name has to be unique under.
+func scopeOf(parents []uuid.UUID) string {
+	ids := make([]string, len(parents))
+	for i, parent := range parents {
+		ids[i] = parent.String()
+	}
+	return strings.Join(ids, "/")
+}
+
+func (p *plan) add(e *entry) {
+	keyed := e.scope + "\x00" + e.key
+	// The database may already hold duplicates; the first one wins.
+	if _, ok := p.byKey[e.kind][keyed]; !ok {
+		p.byKey[e.kind][keyed] = e
+	}
+	p.byID[e.kind][e.id] = e
+
+	words := p.words[e.kind][e.scope]
+	if words == nil {
+		words = map[string][]*entry{}
+		p.words[e.kind][e.scope] = words
+	}
+	for _, stem := range stems(e.key) {
+		words[stem] = append(words[stem], e)
+	}
+}
+
+// stems returns the first four letters of the distinctive words of key, so that
+// entries with a typo towards the end of a word or a plural still share a stem.
+func stems(key string) []string {
+	var stems []string
+	seen := map[string]bool{}
+	for _, word := range distinctive(key) {
+		stem := word
+		if runes := []rune(word); len(runes) > 4 {
+			stem = string(runes[:4])
+		}
+		if !seen[stem] {
+			seen[stem] = true
+			stems = append(stems, stem)
+		}
+	}
+	return stems
+}
+
+func (p *plan) apply(records []Record) *Report {
+	for _, record := range records {
+		p.report.Rows++
+		p.applyRecord(record)
+	}
+	return p.report
+}
+
+func (p *plan) applyRecord(r Record) {
+	switch {
+	case strings.TrimSpace(r.School) == "":
+		p.fail(r.Row, KindSchool, "", "a school is required")
+		return
+	case r.Major != "" && (r.Degree == "" || r.Department == ""):
+		p.fail(r.Row, KindMajor, r.Major, "a major needs a degree and a department")
+		return
+	case r.Department != "" && r.Degree == "":
+		p.fail(r.Row, KindDepartment, r.Department, "a department needs a degree")
+		return
+	}
+
+	school, ok := p.resolve(r.Row, KindSchool, nil, r.School, r.SchoolID, r.SchoolRef)
+	if !ok || r.Degree == "" {
+		return
+	}
+	degree, ok := p.resolve(r.Row, KindDegree, nil, r.Degree, r.DegreeID, "")
+	if !ok || r.Department == "" {
+		return
+	}
+	department, ok := p.resolve(r.Row, KindDepartment, []uuid.UUID{school.id, degree.id}, r.Department, r.DepartmentID, "")
+	if !ok || r.Major == "" {
+		return
+	}
+	p.resolve(r.Row, KindMajor, []uuid.UUID{school.id, degree.id, department.id}, r.Major, r.MajorID, "")
+}
+
+// resolve finds the entry a row refers to, or plans to create it. It reports false if
+// the row conflicts with the catalog.
+func (p *plan) resolve(row int, kind Kind, parents []uuid.UUID, name, explicitID, ref string) (*entry, bool) {
+	name = DisplayName(name)
+	key := Normalize(name)
+	if key == "" {
+		p.fail(row, kind, name, "the name has no letters or digits")
+		return nil, false
+	}
+	scope := scopeOf(parents)
+
+	var id uuid.UUID
+	if explicitID != "" {
+		var err error
+		id, err = uuid.Parse(explicitID)
+		if err != nil {
+			p.fail(row, kind, name, fmt.Sprintf("invalid id %q", explicitID))
+			return nil, false
+		}
+	}
+
+	e := p.byKey[kind][scope+"\x00"+key]
+	if id != uuid.Nil {
+		if other := p.byID[kind][id]; other != nil && other != e {
+			p.conflict(row, kind, name, fmt.Sprintf("id %s already belongs to %q", id, other.name))
+			return nil, false
+		}
+		if e != nil && e.id != id {
+			p.conflict(row, kind, name, fmt.Sprintf("%q already exists with id %s", e.name, e.id))
+			return nil, false
+		}
+	}
+	if e != nil {
+		if e.existing && !e.seen {
+			p.report.Unchanged[kind]++
+		}
+		e.seen = true
+		return e, true
+	}
+
+	switch {
+	case id != uuid.Nil:
+	case ref != "":
+		id = uuid.NewSHA1(idNamespace, []byte(string(kind)+":ref:"+ref))
+	default:
+		id = uuid.NewSHA1(idNamespace, []byte(string(kind)+":"+scope+":"+key))
+	}
+	if other := p.byID[kind][id]; other != nil {
+		p.conflict(row, kind, name, fmt.Sprintf("id %s already belongs to %q", id, other.name))
+		return nil, false
+	}
+
+	e = &entry{kind: kind, id: id, name: name, key: key, scope: scope, parents: parents, seen: true, row: row}
+	e.form = newKeyForm(key)
+	p.checkNearDuplicates(e)
+	p.add(e)
+	p.created = append(p.created, e)
+	p.report.Created[kind]++
+	return e, true
+}
+
+// checkNearDuplicates reports the entry most similar to e under the same parent, if
+// it is similar enough. Only entries sharing one of the two rarest stems of e are
+// compared, which keeps large imports fast.
+func (p *plan) checkNearDuplicates(e *entry) {
+	index := p.words[e.kind][e.scope]
+	if index == nil {
+		return
+	}
+
+	words := stems(e.key)
+	sort.Slice(words, func(i, j int) bool { return len(index[words[i]]) < len(index[words[j]]) })
+	if len(words) > 2 {
+		words = words[:2]
+	}
+
+	var best *entry
+	bestScore := 0.0
+	compared := map[*entry]bool{}
+	for _, word := range words {
+		for _, candidate := range index[word] {
+			if compared[candidate] {
+				continue
+			}
+			compared[candidate] = true
+
+			score := e.form.similarity(candidate.form, NearDuplicateThreshold)
+			if score > bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+	}
+
+	if best != nil && bestScore >= NearDuplicateThreshold {
+		p.report.NearDuplicates = append(p.report.NearDuplicates, NearDuplicate{
+			Row:        e.row,
+			Kind:       e.kind,
+			Name:       e.name,
+			ID:         e.id,
+			Similar:    best.name,
+			SimilarID:  best.id,
+			Similarity: float64(int(bestScore*100)) / 100,
+		})
+	}
+}
+
+func (p *plan) fail(row int, kind Kind, name, message string) {
+	p.report.Errors = append(p.report.Errors, Issue{Row: row, Kind: kind, Name: DisplayName(name), Message: message})
+}
+
+func (p *plan) conflict(row int, kind Kind, name, message string) {
+	p.report.Conflicts = append(p.report.Conflicts, Issue{Row: row, Kind: kind, Name: name, Message: message})
+}
@@ -0,0 +1,206 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// existing adds an entry to p as if it had been loaded from the database.
+func existing(p *plan, kind Kind, id uuid.UUID, name string, parents ...uuid.UUID) *entry {
+	e := &entry{kind: kind, id: id, name: name, key: Normalize(name), parents: parents, existing: true}
+	e.form = newKeyForm(e.key)
+	e.scope = scopeOf(e.parents)
+	p.add(e)
+	return e
+}
+
+var importRecords = []Record{
+	{Row: 1, School: "University of Oxford"},
+	{Row: 2, School: "University of Oxford", Degree: "Master", Department: "Computer Science", Major: "Machine Learning"},
+	{Row: 3, School: "University of Oxford", Degree: "Master", Department: "Computer Science", Major: "Software Engineering"},
+	{Row: 4, School: "Stanford University", SchoolRef: "243744", Degree: "PhD"},
+}
+
+func TestImportAgainCreatesNothing(t *testing.T) {
+	first := newPlan()
+	report := first.apply(importRecords)
+	if len(report.Errors) > 0 || len(report.Conflicts) > 0 || len(report.NearDuplicates) > 0 {
+		t.Fatalf("first import: %+v", report)
+	}
+	want := map[Kind]int{KindSchool: 2, KindDegree: 2, KindDepartment: 1, KindMajor: 2}
+	for kind, n := range want {
+		if report.Created[kind] != n {
+			t.Errorf("first import created %d of %s, want %d", report.Created[kind], kind, n)
+		}
+	}
+
+	// The second import sees what the first one wrote.
+	second := newPlan()
+	for _, e := range first.created {
+		existing(second, e.kind, e.id, e.name, e.parents...)
+	}
+	report = second.apply(importRecords)
+	if len(report.Errors) > 0 || len(report.Conflicts) > 0 || len(report.NearDuplicates) > 0 {
+		t.Fatalf("second import: %+v", report)
+	}
+	for kind, n := range want {
+		if report.Created[kind] != 0 {
+			t.Errorf("second import created %d of %s", report.Created[kind], kind)
+		}
+		if report.Unchanged[kind] != n {
+			t.Errorf("second import left %d of %s unchanged, want %d", report.Unchanged[kind], kind, n)
+		}
+	}
+	if len(second.created) != 0 {
+		t.Errorf("second import would insert %d entries", len(second.created))
+	}
+
+	// IDs derive from names, so a fresh database gets the same ones.
+	third := newPlan()
+	third.apply(importRecords)
+	for i, e := range third.created {
+		if e.id != first.created[i].id {
+			t.Errorf("%s %q got id %s, then %s", e.kind, e.name, first.created[i].id, e.id)
+		}
+	}
+}
+
+func TestImportExplicitIDConflicts(t *testing.T) {
+	oxford := uuid.MustParse("0b6a3f0e-8d5c-4f1a-9e2b-7c3d4e5f6a70")
+	stanford := uuid.MustParse("0b6a3f0e-8d5c-4f1a-9e2b-7c3d4e5f6a71")
+
+	tests := []struct {
+		name    string
+		record  Record
+		message string
+	}{
+		{
+			"id of another entry",
+			Record{Row: 1, School: "Harvard University", SchoolID: oxford.String()},
+			`already belongs to "University of Oxford"`,
+		},
+		{
+			"name with another id",
+			Record{Row: 1, School: "University of Oxford", SchoolID: stanford.String()},
+			"already exists with id " + oxford.String(),
+		},
+		{
+			"reference of another entry",
+			Record{Row: 1, School: "Harvard University", SchoolRef: "243744"},
+			`already belongs to "Stanford University"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPlan()
+			existing(p, KindSchool, oxford, "University of Oxford")
+			existing(p, KindSchool, uuid.NewSHA1(idNamespace, []byte("school:ref:243744")), "Stanford University")
+
+			report := p.apply([]Record{tt.record})
+			if len(report.Conflicts) != 1 || !strings.Contains(report.Conflicts[0].Message, tt.message) {
+				t.Fatalf("conflicts = %+v, want one with %q", report.Conflicts, tt.message)
+			}
+			if report.Conflicts[0].Row != 1 || report.Conflicts[0].Kind != KindSchool {
+				t.Errorf("conflict = %+v", report.Conflicts[0])
+			}
+			if report.Created[KindSchool] != 0 || len(p.created) != 0 {
+				t.Errorf("created %d schools despite the conflict", report.Created[KindSchool])
+			}
+		})
+	}
+
+	// Pinning the id an entry already has is no conflict.
+	p := newPlan()
+	existing(p, KindSchool, oxford, "University of Oxford")
+	report := p.apply([]Record{{Row: 1, School: "University of Oxford", SchoolID: oxford.String()}})
+	if len(report.Conflicts) != 0 || report.Unchanged[KindSchool] != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestImportNearDuplicates(t *testing.T) {
+	oxford := uuid.MustParse("0b6a3f0e-8d5c-4f1a-9e2b-7c3d4e5f6a70")
+
+	tests := []struct {
+		name    string
+		school  string
+		similar bool
+		created bool
+	}{
+		// Abbreviations are expanded before matching, so this is the same school.
+		{"abbreviation", "Univ. of Oxford", false, false},
+		{"generic words", "Oxford University", true, true},
+		{"typo at the end", "Univ. of Oxfort", true, true},
+		{"plural", "Universities of Oxford", true, true},
+		{"another school", "University of Bristol", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPlan()
+			existing(p, KindSchool, oxford, "University of Oxford")
+
+			report := p.apply([]Record{{Row: 7, School: tt.school}})
+			if len(report.Errors) > 0 || len(report.Conflicts) > 0 {
+				t.Fatalf("report = %+v", report)
+			}
+			if created := report.Created[KindSchool] == 1; created != tt.created {
+				t.Errorf("created = %v, want %v", created, tt.created)
+			}
+			if !tt.similar {
+				if len(report.NearDuplicates) != 0 {
+					t.Errorf("near duplicates = %+v, want none", report.NearDuplicates)
+				}
+				return
+			}
+
+			if len(report.NearDuplicates) != 1 {
+				t.Fatalf("near duplicates = %+v, want one", report.NearDuplicates)
+			}
+			d := report.NearDuplicates[0]
+			if d.Row != 7 || d.Name != tt.school || d.SimilarID != oxford || d.Similarity < NearDuplicateThreshold {
+				t.Errorf("near duplicate = %+v", d)
+			}
+		})
+	}
+
+	// Names are only compared under the same parent.
+	school := uuid.MustParse("0b6a3f0e-8d5c-4f1a-9e2b-7c3d4e5f6a72")
+	degree := uuid.MustParse("0b6a3f0e-8d5c-4f1a-9e2b-7c3d4e5f6a73")
+	p := newPlan()
+	existing(p, KindSchool, oxford, "University of Oxford")
+	existing(p, KindSchool, school, "Stanford University")
+	existing(p, KindDegree, degree, "Master")
+	existing(p, KindDepartment, uuid.New(), "Computer Science", oxford, degree)
+	report := p.apply([]Record{{Row: 1, School: "Stanford University", Degree: "Master", Department: "Computer Sciences"}})
+	if len(report.NearDuplicates) != 0 || report.Created[KindDepartment] != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"University of Oxford", "university of oxford"},
+		{"Univ. of Oxford", "university of oxford"},
+		{"  The  University of   Oxford ", "university of oxford"},
+		{"The", "the"},
+		{"Texas A&M University", "texas a and m university"},
+		{"École Polytechnique Fédérale de Lausanne", "ecole polytechnique federale de lausanne"},
+		{"Dept. of Comp. Sci. & Eng.", "department of comp science and engineering"},
+		{"MIT Sloan School of Mgmt", "mit sloan school of management"},
+		{"國立臺灣大學", "國立臺灣大學"},
+		{"!!!", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.name); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
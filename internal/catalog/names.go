@@ -0,0 +1,177 @@
+package catalog
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// abbreviations are expanded before names are compared, so that "Univ. of Oxford"
+// and "University of Oxford" are the same school.
+var abbreviations = map[string]string{
+	"univ":  "university",
+	"uni":   "university",
+	"coll":  "college",
+	"inst":  "institute",
+	"tech":  "technology",
+	"dept":  "department",
+	"sci":   "science",
+	"eng":   "engineering",
+	"engr":  "engineering",
+	"mgmt":  "management",
+	"admin": "administration",
+	"intl":  "international",
+	"natl":  "national",
+}
+
+// genericWords carry no meaning on their own when telling names apart: "Stanford"
+// and "Stanford University" are probably the same school.
+var genericWords = map[string]bool{
+	"the":        true,
+	"of":         true,
+	"and":        true,
+	"at":         true,
+	"in":         true,
+	"for":        true,
+	"university": true,
+	"college":    true,
+	"institute":  true,
+	"school":     true,
+	"department": true,
+}
+
+var foldAccents = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// DisplayName trims a name and collapses the whitespace inside it.
+func DisplayName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Normalize returns the key names are compared by: lower case, without accents or
+// punctuation, with "&" spelled out, abbreviations expanded and a leading "the"
+// dropped.
+func Normalize(name string) string {
+	folded, _, err := transform.String(foldAccents, name)
+	if err != nil {
+		folded = name
+	}
+	folded = strings.ReplaceAll(strings.ToLower(folded), "&", " and ")
+
+	words := strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if expanded, ok := abbreviations[word]; ok {
+			words[i] = expanded
+		}
+	}
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// distinctive returns the words of a normalized key that are not generic.
+func distinctive(key string) []string {
+	var words []string
+	for _, word := range strings.Fields(key) {
+		if !genericWords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// Similarity scores how alike two normalized keys are, from 0 to 1. Keys that only
+// differ in generic words score 0.95; otherwise the score is based on the edit
+// distance between the keys.
+func Similarity(a, b string) float64 {
+	return newKeyForm(a).similarity(newKeyForm(b), 0)
+}
+
+// keyForm holds the forms of a normalized key that similarity compares, so that they
+// are only computed once per entry.
+type keyForm struct {
+	key   string
+	core  string
+	runes []rune
+}
+
+func newKeyForm(key string) keyForm {
+	return keyForm{key: key, core: strings.Join(distinctive(key), " "), runes: []rune(key)}
+}
+
+// similarity is Similarity, except that it gives up and returns 0 as soon as the
+// score is certain to be below floor.
+func (a keyForm) similarity(b keyForm, floor float64) float64 {
+	if a.key == b.key {
+		return 1
+	}
+	if a.core != "" && a.core == b.core {
+		return 0.95
+	}
+
+	longest := len(a.runes)
+	if len(b.runes) > longest {
+		longest = len(b.runes)
+	}
+	if longest == 0 {
+		return 0
+	}
+
+	maxDistance := int(float64(longest) * (1 - floor))
+	distance, ok := levenshtein(a.runes, b.runes, maxDistance)
+	if !ok {
+		return 0
+	}
+	return 1 - float64(distance)/float64(longest)
+}
+
+// levenshtein returns the edit distance between a and b, or false once it is known
+// to exceed max.
+func levenshtein(a, b []rune, max int) (int, bool) {
+	if len(a)-len(b) > max || len(b)-len(a) > max {
+		return 0, false
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minOf(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > max {
+			return 0, false
+		}
+		prev, curr = curr, prev
+	}
+	if prev[len(b)] > max {
+		return 0, false
+	}
+	return prev[len(b)], true
+}
+
+func minOf(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,156 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Formats accepted by Parse.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// A Record is one row of a catalog file. Only the school is required: a row can add
+// just a school, a degree offered by a school, a department, or a major. IDs are
+// optional and pin the ID of the entry they belong to.
+type Record struct {
+	// Row is the line of a CSV file or the position in a JSON array, from 1.
+	Row int `json:"-"`
+
+	School       string `json:"school"`
+	SchoolID     string `json:"school_id,omitempty"`
+	Degree       string `json:"degree,omitempty"`
+	DegreeID     string `json:"degree_id,omitempty"`
+	Department   string `json:"department,omitempty"`
+	DepartmentID string `json:"department_id,omitempty"`
+	Major        string `json:"major,omitempty"`
+	MajorID      string `json:"major_id,omitempty"`
+
+	// SchoolRef is an identifier of the school in an external list, like an IPEDS
+	// UNITID. New schools get an ID derived from it, so that importing a newer
+	// version of the list after a school was renamed updates the same school.
+	SchoolRef string `json:"school_ref,omitempty"`
+}
+
+// FormatFromName guesses the format of a file from its extension.
+func FormatFromName(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".txt":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("catalog: cannot tell the format of %q, expected a .csv or .json file", name)
+	}
+}
+
+// Parse reads the records of a catalog file.
+//
+// CSV files need a header row naming the columns: school, degree, department and
+// major, each optionally followed by _id (and also accepted with a _name suffix).
+// School lists in the IPEDS layout are recognized by their INSTNM column, with UNITID
+// as the reference of each school.
+//
+// JSON files hold an array of objects with the same fields as the CSV columns.
+func Parse(r io.Reader, format string) ([]Record, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSON:
+		return parseJSON(r)
+	default:
+		return nil, fmt.Errorf("catalog: unknown format %q", format)
+	}
+}
+
+// csvColumns maps the accepted header names onto the fields of a Record.
+var csvColumns = map[string]func(*Record) *string{
+	"school":          func(r *Record) *string { return &r.School },
+	"school_name":     func(r *Record) *string { return &r.School },
+	"school_id":       func(r *Record) *string { return &r.SchoolID },
+	"degree":          func(r *Record) *string { return &r.Degree },
+	"degree_name":     func(r *Record) *string { return &r.Degree },
+	"degree_id":       func(r *Record) *string { return &r.DegreeID },
+	"department":      func(r *Record) *string { return &r.Department },
+	"department_name": func(r *Record) *string { return &r.Department },
+	"department_id":   func(r *Record) *string { return &r.DepartmentID },
+	"major":           func(r *Record) *string { return &r.Major },
+	"major_name":      func(r *Record) *string { return &r.Major },
+	"major_id":        func(r *Record) *string { return &r.MajorID },
+	"school_ref":      func(r *Record) *string { return &r.SchoolRef },
+	// IPEDS institutional characteristics files.
+	"instnm": func(r *Record) *string { return &r.School },
+	"unitid": func(r *Record) *string { return &r.SchoolRef },
+}
+
+func parseCSV(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	// Spreadsheets like to start UTF-8 files with a byte order mark.
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("catalog: the file is empty")
+		}
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+
+	fields := make([]func(*Record) *string, len(header))
+	hasSchool := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		fields[i] = csvColumns[name]
+		if name == "school" || name == "school_name" || name == "instnm" {
+			hasSchool = true
+		}
+	}
+	if !hasSchool {
+		return nil, errors.New("catalog: the header has no school column")
+	}
+
+	var records []Record
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("catalog: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		record := Record{Row: line}
+		for i, value := range row {
+			if fields[i] != nil {
+				*fields[i](&record) = strings.TrimSpace(value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseJSON(r io.Reader) ([]Record, error) {
+	var records []Record
+	err := json.NewDecoder(r).Decode(&records)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+	for i := range records {
+		records[i].Row = i + 1
+	}
+	return records, nil
+}
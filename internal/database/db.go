@@ -8,6 +8,9 @@ import (
 
 const DefaultTimeout = 3 * time.Second
 
+// MigrationTimeout bounds applying migrations at startup.
+const MigrationTimeout = 5 * time.Minute
+
 // The openDB() function returns a sql.DB connection pool.
 func New(dsn string, automigrate bool, maxOpenConns int, maxIdleConns int, maxIdleTime string) (*sql.DB, error) {
 	// Use sql.Open() to create an empty connection pool, using the DSN from the config // struct.
@@ -42,6 +45,22 @@ func New(dsn string, automigrate bool, maxOpenConns int, maxIdleConns int, maxId
 	if err != nil {
 		return nil, err
 	}
+
+	// Bring the schema up to date with the migrations embedded in the binary.
+	if automigrate {
+		migrator, err := NewEmbeddedMigrator(db)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), MigrationTimeout)
+		defer cancel()
+
+		_, err = migrator.Up(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Return the sql.DB connection pool.
 	return db, nil
 }
@@ -0,0 +1,364 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"offerland.cc/assets"
+)
+
+// migrationLockKey is the advisory lock that serializes migrations between instances
+// starting at the same time.
+const migrationLockKey = 7_312_964_811
+
+var (
+	ErrDrift        = errors.New("database: applied migrations differ from the embedded ones")
+	ErrNoDown       = errors.New("database: migration has no down migration")
+	ErrDirtyLegacy  = errors.New("database: schema_migrations is dirty, fix it with the migrate CLI first")
+	migrationFileRx = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+// A Migration is one numbered schema change, read from a pair of NNNNNN_name.up.sql
+// and NNNNNN_name.down.sql files.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes a migration that is embedded, applied, or both. Drift is
+// set when the applied migration does not match the embedded one any more, Missing
+// when it was applied but is not embedded.
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Drift     bool       `json:"drift,omitempty"`
+	Missing   bool       `json:"missing,omitempty"`
+}
+
+// Migrator applies embedded migrations and records them in the schema_versions table,
+// together with a checksum of each one to detect migrations edited after the fact.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewEmbeddedMigrator returns a Migrator for the migrations embedded in the binary.
+func NewEmbeddedMigrator(db *sql.DB) (*Migrator, error) {
+	fsys, err := fs.Sub(assets.EmbeddedFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db, fsys)
+}
+
+// NewMigrator reads the migrations in the root of fsys.
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileRx.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("database: migration %d has two names, %q and %q", version, migration.Name, match[2])
+		}
+
+		switch match[3] {
+		case "up":
+			migration.Up = string(content)
+		case "down":
+			migration.Down = string(content)
+		}
+	}
+
+	m := &Migrator{db: db}
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("database: migration %d_%s has no up migration", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		m.migrations = append(m.migrations, *migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+
+	return m, nil
+}
+
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a connection that holds the migration lock, after making sure
+// the schema_versions table exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_versions (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			checksum text NOT NULL,
+			applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	err = m.adoptLegacy(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// adoptLegacy takes over databases that were migrated with the migrate CLI: the
+// migrations it recorded in schema_migrations are marked as applied.
+func (m *Migrator) adoptLegacy(ctx context.Context, conn *sql.Conn) error {
+	var tracked bool
+	err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_versions)`).Scan(&tracked)
+	if err != nil || tracked {
+		return err
+	}
+
+	var legacy sql.NullString
+	err = conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations')::text`).Scan(&legacy)
+	if err != nil || !legacy.Valid {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	err = conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if dirty {
+		return ErrDirtyLegacy
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		_, err = conn.ExecContext(ctx, `INSERT INTO schema_versions (version, name, checksum) VALUES ($1, $2, $3)`,
+			migration.Version, migration.Name, migration.Checksum)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_versions ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) status(applied []appliedMigration) []MigrationStatus {
+	appliedByVersion := map[int64]appliedMigration{}
+	for _, a := range applied {
+		appliedByVersion[a.version] = a
+	}
+
+	var statuses []MigrationStatus
+	embedded := map[int64]bool{}
+	for _, migration := range m.migrations {
+		embedded[migration.Version] = true
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := appliedByVersion[migration.Version]; ok {
+			appliedAt := a.appliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Drift = a.checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range applied {
+		if !embedded[a.version] {
+			appliedAt := a.appliedAt
+			statuses = append(statuses, MigrationStatus{Version: a.version, Name: a.name, Applied: true, AppliedAt: &appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses
+}
+
+// Status returns every embedded or applied migration.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		statuses = m.status(applied)
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies every migration that has not been applied yet, each in its own
+// transaction, and returns them. It refuses to run if an applied migration was
+// changed or removed since.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		isApplied := map[int64]bool{}
+		for _, status := range m.status(applied) {
+			if status.Drift || status.Missing {
+				return fmt.Errorf("%w: %d_%s", ErrDrift, status.Version, status.Name)
+			}
+			isApplied[status.Version] = status.Applied
+		}
+
+		for _, migration := range m.migrations {
+			if isApplied[migration.Version] {
+				continue
+			}
+
+			err = inTx(ctx, conn, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, migration.Up)
+				if err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `INSERT INTO schema_versions (version, name, checksum) VALUES ($1, $2, $3)`,
+					migration.Version, migration.Name, migration.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("database: migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the n most recently applied migrations, newest first, and returns
+// them.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	embedded := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		embedded[migration.Version] = migration
+	}
+
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < n; i-- {
+			migration, ok := embedded[applied[i].version]
+			if !ok || migration.Checksum != applied[i].checksum {
+				return fmt.Errorf("%w: %d_%s", ErrDrift, applied[i].version, applied[i].name)
+			}
+			if strings.TrimSpace(migration.Down) == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDown, migration.Version, migration.Name)
+			}
+
+			err = inTx(ctx, conn, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, migration.Down)
+				if err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `DELETE FROM schema_versions WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("database: migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
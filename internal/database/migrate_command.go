@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// A MigrateCommand is one of the "up", "down N" and "status" commands that the API
+// and the admin CLI both offer to manage the schema.
+type MigrateCommand struct {
+	Name string
+	// N is the number of migrations "down" rolls back.
+	N int
+}
+
+// ParseMigrateCommand reads a command from the start of args and returns it along
+// with the arguments that follow it.
+func ParseMigrateCommand(args []string) (MigrateCommand, []string, error) {
+	if len(args) == 0 {
+		return MigrateCommand{}, nil, errors.New("expected up, down N or status")
+	}
+
+	command := MigrateCommand{Name: args[0]}
+	args = args[1:]
+
+	switch command.Name {
+	case "up", "status":
+	case "down":
+		if len(args) == 0 {
+			return MigrateCommand{}, nil, errors.New("down needs the number of migrations to roll back")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return MigrateCommand{}, nil, fmt.Errorf("down needs a positive number of migrations, got %q", args[0])
+		}
+		command.N = n
+		args = args[1:]
+	default:
+		return MigrateCommand{}, nil, fmt.Errorf("unknown migrate command %q, expected up, down N or status", command.Name)
+	}
+	return command, args, nil
+}
+
+// A MigrateResult is the outcome of a MigrateCommand: the migrations that "up" or
+// "down" applied or rolled back, or the status of every migration.
+type MigrateResult struct {
+	Command  MigrateCommand
+	Done     []Migration
+	Statuses []MigrationStatus
+}
+
+// RunMigrateCommand runs the command with the migrations embedded in the binary.
+func RunMigrateCommand(db *sql.DB, command MigrateCommand) (*MigrateResult, error) {
+	migrator, err := NewEmbeddedMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MigrationTimeout)
+	defer cancel()
+
+	result := &MigrateResult{Command: command}
+	switch command.Name {
+	case "up":
+		result.Done, err = migrator.Up(ctx)
+	case "down":
+		result.Done, err = migrator.Down(ctx, command.N)
+	case "status":
+		result.Statuses, err = migrator.Status(ctx)
+	default:
+		err = fmt.Errorf("unknown migrate command %q", command.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// JSON returns what is printed for the result with -json: the versions applied or
+// rolled back, or the statuses.
+func (r *MigrateResult) JSON() any {
+	if r.Command.Name == "status" {
+		return map[string]any{"migrations": r.Statuses}
+	}
+
+	versions := []int64{}
+	for _, migration := range r.Done {
+		versions = append(versions, migration.Version)
+	}
+	return map[string]any{r.Command.Name: versions}
+}
+
+// WriteText describes the result for people: one line per migration applied or
+// rolled back, or a table of the statuses.
+func (r *MigrateResult) WriteText(w io.Writer) error {
+	if r.Command.Name == "status" {
+		return writeMigrationStatus(w, r.Statuses)
+	}
+
+	if len(r.Done) == 0 {
+		fmt.Fprintln(w, "nothing to do")
+	}
+	for _, migration := range r.Done {
+		fmt.Fprintf(w, "%s %06d_%s\n", r.Command.Name, migration.Version, migration.Name)
+	}
+	return nil
+}
+
+func writeMigrationStatus(w io.Writer, statuses []MigrationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Missing:
+			state = "missing"
+		case status.Drift:
+			state = "drift"
+		case status.Applied:
+			state = "applied"
+		}
+
+		appliedAt := ""
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%06d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return tw.Flush()
+}
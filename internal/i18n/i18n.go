@@ -0,0 +1,70 @@
+package i18n
+
+import (
+	"golang.org/x/text/language"
+)
+
+// Supported lists the locales the API and the email templates are translated into.
+// The first entry is the default and is used whenever a client's preferences cannot
+// be matched.
+var Supported = []language.Tag{
+	language.English,
+	language.MustParse("zh-TW"),
+}
+
+var matcher = language.NewMatcher(Supported)
+
+// DefaultLocale is the locale used when nothing better is known about the client.
+var DefaultLocale = Supported[0].String()
+
+// Match returns the supported locale that best fits the given Accept-Language
+// header value, e.g. "zh-TW,zh;q=0.9,en;q=0.8" returns "zh-TW".
+func Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+
+	_, index, _ := matcher.Match(tags...)
+	return Supported[index].String()
+}
+
+// Normalize returns the supported locale closest to the given locale string, or the
+// default locale if it cannot be parsed.
+func Normalize(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return DefaultLocale
+	}
+
+	_, index, _ := matcher.Match(tag)
+	return Supported[index].String()
+}
+
+// IsSupported reports whether locale is exactly one of the supported locales.
+func IsSupported(locale string) bool {
+	for _, tag := range Supported {
+		if tag.String() == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate returns the translation of message for locale. Messages without a
+// translation, including dynamically built ones, are returned unchanged.
+func Translate(locale string, message string) string {
+	catalog, ok := catalogs[locale]
+	if !ok {
+		return message
+	}
+
+	if translated, ok := catalog[message]; ok {
+		return translated
+	}
+	return message
+}
+
+var catalogs = map[string]map[string]string{
+	"zh-TW": zhTW,
+}
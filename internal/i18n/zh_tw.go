@@ -0,0 +1,102 @@
+package i18n
+
+// zhTW holds the Traditional Chinese translations of the API's error and
+// validation messages, keyed by the English message used in the handlers.
+var zhTW = map[string]string{
+	// Error responses
+	"The server encountered a problem and could not process your request":   "伺服器發生問題，無法處理您的請求",
+	"The requested resource could not be found, please try again.":          "找不到您要求的資源，請再試一次。",
+	"The email address you entered could not be found":                      "找不到您輸入的電子郵件地址",
+	"unable to update the record due to an edit conflict, please try again": "資料已被其他請求修改，無法更新，請再試一次",
+	"invalid email address or password":                                     "電子郵件地址或密碼錯誤",
+	"your user account must be activated to access this resource":           "您的帳號必須先啟用才能存取此資源",
+	"Invalid or missing authentication token":                               "驗證權杖無效或缺少驗證權杖",
+	"duplicate record": "資料重複",
+	"the login request is invalid or has expired, please try again":                                       "登入請求無效或已過期，請再試一次",
+	"the login provider did not return a verified email address":                                          "登入服務未提供已驗證的電子郵件地址",
+	"an account with this email address already exists, sign in to it to link this login provider":        "已有帳號使用此電子郵件地址，請先登入該帳號再連結此登入服務",
+	"this login provider account is already linked to your account":                                       "此登入服務帳號已連結到您的帳號",
+	"there are not enough reported results with applicant profiles for this program to make a prediction": "此科系附有申請背景的結果不足，無法預測",
+	"you are already watching this program":                                                               "您已在關注此科系",
+	"this login provider account is linked to another account":                                            "此登入服務帳號已連結到其他帳號",
+	"you cannot remove your only way to sign in, set a password or link another login provider first":     "您無法移除唯一的登入方式，請先設定密碼或連結其他登入服務",
+	"this email address is already in use":                                                                "此電子郵件地址已被使用",
+	"your account has no password yet, set one first":                                                     "您的帳號尚未設定密碼，請先設定密碼",
+	"your account has been disabled":                                                                      "您的帳號已被停用",
+	"your account is scheduled for deletion, sign in again to cancel it":                                  "您的帳號已排定刪除，重新登入即可取消",
+	"your account already has a password":                                                                 "您的帳號已設定密碼",
+	"your user account doesn't have the necessary permissions to access this resource":                    "您的帳號沒有存取此資源的權限",
+	"please confirm your identity again to perform this action":                                           "請再次確認您的身分以執行此操作",
+	"invalid or expired two-factor authentication code":                                                   "兩步驟驗證碼無效或已過期",
+	"two-factor authentication is already enabled":                                                        "已啟用兩步驟驗證",
+	"too many attempts, please try again later":                                                           "嘗試次數過多，請稍後再試",
+	"this alias already names another catalog entry":                                                      "此別名已用於其他目錄項目",
+	"these catalog entries cannot be merged, majors must belong to the same school and degree":            "無法合併這些目錄項目，科系必須屬於同一所學校與學位",
+	"rate limit exceeded, please slow down":                                                               "請求過於頻繁，請放慢速度",
+
+	// Request decoding
+	"body contains badly-formed JSON":            "請求內容的 JSON 格式錯誤",
+	"body must not be empty":                     "請求內容不可為空",
+	"body must only contain a single JSON value": "請求內容只能包含一個 JSON 值",
+
+	// Validation
+	"Token is required":                     "必須提供權杖",
+	"A code or a recovery code is required": "必須提供驗證碼或復原碼",
+	"Code is required":                      "必須提供授權碼",
+	"State is required":                     "必須提供狀態參數",
+	"must be 26 bytes long":                 "長度必須為 26 個字元",
+	"must be 6 bytes long":                  "長度必須為 6 個字元",
+	"invalid or expired passcode":           "驗證碼無效或已過期",
+	"This is already your email address":    "這已經是您的電子郵件地址",
+	"Current password is required":          "請輸入目前的密碼",
+	"Current password is incorrect":         "目前的密碼不正確",
+	"This email address is already in use":  "此電子郵件地址已被使用",
+	"This email address is awaiting activation, check your inbox for the activation code": "此電子郵件地址正在等待啟用，請至信箱查看啟用碼",
+	"This username is already in use":                          "此使用者名稱已被使用",
+	"Must be a valid email address":                            "必須是有效的電子郵件地址",
+	"Password is too short, must be at least 8 characters":     "密碼太短，至少需要 8 個字元",
+	"Password is too long, must be at most 72 characters":      "密碼太長，最多 72 個字元",
+	"Password must be at least 8 characters":                   "密碼至少需要 8 個字元",
+	"Password must be at most 72 characters":                   "密碼最多 72 個字元",
+	"Password is too common":                                   "密碼太常見",
+	"Locale is not supported":                                  "不支援此語系",
+	"Query must be at least 2 characters":                      "搜尋字串至少需要 2 個字元",
+	"Query must be at most 100 characters":                     "搜尋字串最多 100 個字元",
+	"Kind must be school or major":                             "類型必須是 school 或 major",
+	"Must be a valid ID":                                       "必須是有效的 ID",
+	"Limit must be between 1 and 50":                           "數量必須介於 1 到 50 之間",
+	"Alias is required":                                        "必須提供別名",
+	"GPA and GPA scale must be given together":                 "GPA 與 GPA 滿分必須一起提供",
+	"GPA scale must be between 0 and 100":                      "GPA 滿分必須介於 0 到 100 之間",
+	"GPA must be between 0 and the GPA scale":                  "GPA 必須介於 0 與 GPA 滿分之間",
+	"GRE scores must be between 130 and 170":                   "GRE 分數必須介於 130 到 170 之間",
+	"Must be between 0 and 6 in steps of 0.5":                  "必須介於 0 到 6 之間，以 0.5 為單位",
+	"TOEFL scores must be between 0 and 120":                   "TOEFL 分數必須介於 0 到 120 之間",
+	"Must be between 0 and 9 in steps of 0.5":                  "必須介於 0 到 9 之間，以 0.5 為單位",
+	"Must be at most 255 characters":                           "最多 255 個字元",
+	"Graduation year is out of range":                          "畢業年份超出範圍",
+	"Country must be a two-letter ISO 3166 code":               "國家必須是兩個字母的 ISO 3166 代碼",
+	"Work experience must be between 0 and 600 months":         "工作經驗必須介於 0 到 600 個月之間",
+	"Publications must be between 0 and 1000":                  "發表數量必須介於 0 到 1000 之間",
+	"Format must be csv, ndjson or parquet":                    "格式必須是 csv、ndjson 或 parquet",
+	"Cycle must be a year":                                     "申請季必須是年份",
+	"k must not be below the minimum group size":               "k 不可小於最小群組大小",
+	"Mode must be merge or replace":                            "模式必須是 merge 或 replace",
+	"The file has another result for this school and major":    "檔案中已有此學校與科系的另一筆結果",
+	"Unknown result field":                                     "未知的結果欄位",
+	"No column is mapped to this field":                        "沒有欄位對應到此項目",
+	"The file has no such column":                              "檔案中沒有此欄位",
+	"This column is already mapped to another field":           "此欄位已對應到其他項目",
+	"School is required":                                       "必須提供學校",
+	"Major is required":                                        "必須提供科系",
+	"Status is required":                                       "必須提供結果",
+	"Status must be admitted or rejected":                      "結果必須是錄取或拒絕",
+	"Date is required":                                         "必須提供日期",
+	"Date is out of range":                                     "日期超出範圍",
+	"Date is not in a known format, use YYYY-MM-DD":            "無法辨識日期格式，請使用 YYYY-MM-DD",
+	"Days must be between 1 and 30":                            "天數必須介於 1 到 30 之間",
+	"Limit must be between 1 and 100":                          "數量必須介於 1 到 100 之間",
+	"Profile is required":                                      "必須提供申請背景",
+	"Profile must have at least one score or background field": "申請背景至少需要一項成績或背景資料",
+	"Alias must be at most 200 characters":                     "別名最多 200 個字元",
+}
@@ -0,0 +1,148 @@
+package identity
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Fake is an in-memory Provider for tests and offline development. Tokens are
+// opaque strings handed out by IssueToken.
+type Fake struct {
+	mu     sync.Mutex
+	users  map[string]FakeUser
+	tokens map[string]string
+}
+
+type FakeUser struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	DisplayName   string
+	Disabled      bool
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		users:  map[string]FakeUser{},
+		tokens: map[string]string{},
+	}
+}
+
+// IssueToken returns a new token that verifies as uid.
+func (f *Fake) IssueToken(uid string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token := uuid.New().String()
+	f.tokens[token] = uid
+	return token
+}
+
+// User returns the user registered under uid.
+func (f *Fake) User(uid string) (FakeUser, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[uid]
+	return user, ok
+}
+
+func (f *Fake) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	uid, ok := f.tokens[token]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if user, exists := f.users[uid]; exists && user.Disabled {
+		return nil, ErrInvalidToken
+	}
+
+	return &Identity{UID: uid}, nil
+}
+
+func (f *Fake) CreateUser(ctx context.Context, user *UserToCreate) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, existing := range f.users {
+		if existing.Email == user.Email {
+			return "", ErrEmailExists
+		}
+	}
+
+	uid := user.UID
+	if uid == "" {
+		uid = uuid.New().String()
+	}
+
+	f.users[uid] = FakeUser{
+		UID:           uid,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		DisplayName:   user.DisplayName,
+	}
+	return uid, nil
+}
+
+func (f *Fake) DisableUser(ctx context.Context, uid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[uid]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Disabled = true
+	f.users[uid] = user
+	return nil
+}
+
+func (f *Fake) EnableUser(ctx context.Context, uid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[uid]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Disabled = false
+	f.users[uid] = user
+	return nil
+}
+
+func (f *Fake) UpdateEmail(ctx context.Context, uid string, email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[uid]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for _, existing := range f.users {
+		if existing.UID != uid && existing.Email == email {
+			return ErrEmailExists
+		}
+	}
+
+	user.Email = email
+	user.EmailVerified = true
+	f.users[uid] = user
+	return nil
+}
+
+func (f *Fake) DeleteUser(ctx context.Context, uid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[uid]; !ok {
+		return ErrUserNotFound
+	}
+	delete(f.users, uid)
+	return nil
+}
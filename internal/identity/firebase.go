@@ -0,0 +1,100 @@
+package identity
+
+import (
+	"context"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// Firebase verifies Firebase ID tokens and manages users in Firebase Authentication.
+type Firebase struct {
+	client *auth.Client
+}
+
+func NewFirebase(client *auth.Client) *Firebase {
+	return &Firebase{client: client}
+}
+
+func (f *Firebase) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	verified, err := f.client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &Identity{UID: verified.UID}, nil
+}
+
+func (f *Firebase) CreateUser(ctx context.Context, user *UserToCreate) (string, error) {
+	params := (&auth.UserToCreate{}).
+		Email(user.Email).
+		EmailVerified(user.EmailVerified).
+		Disabled(false)
+
+	if user.UID != "" {
+		params = params.UID(user.UID)
+	}
+	if user.DisplayName != "" {
+		params = params.DisplayName(user.DisplayName)
+	}
+	if user.PhotoURL != "" {
+		params = params.PhotoURL(user.PhotoURL)
+	}
+
+	record, err := f.client.CreateUser(ctx, params)
+	if err != nil {
+		if auth.IsEmailAlreadyExists(err) {
+			return "", ErrEmailExists
+		}
+		return "", err
+	}
+
+	return record.UID, nil
+}
+
+func (f *Firebase) DisableUser(ctx context.Context, uid string) error {
+	_, err := f.client.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Disabled(true))
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *Firebase) EnableUser(ctx context.Context, uid string) error {
+	_, err := f.client.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Disabled(false))
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *Firebase) UpdateEmail(ctx context.Context, uid string, email string) error {
+	_, err := f.client.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Email(email).EmailVerified(true))
+	if err != nil {
+		switch {
+		case auth.IsUserNotFound(err):
+			return ErrUserNotFound
+		case auth.IsEmailAlreadyExists(err):
+			return ErrEmailExists
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Firebase) DeleteUser(ctx context.Context, uid string) error {
+	err := f.client.DeleteUser(ctx, uid)
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Package identity abstracts the service that verifies bearer tokens and owns user
+// accounts. The API talks to a Provider instead of a concrete client, so it can run
+// against Firebase, against its own first-party tokens only, or against an in-memory
+// fake in tests and offline development.
+package identity
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrInvalidToken = errors.New("identity: invalid token")
+	ErrEmailExists  = errors.New("identity: email already exists")
+	ErrUserNotFound = errors.New("identity: user not found")
+)
+
+// Identity is the verified subject of a bearer token.
+type Identity struct {
+	UID string
+	// SessionID is set for first-party access tokens, which are bound to a session.
+	SessionID string
+}
+
+type UserToCreate struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	DisplayName   string
+	PhotoURL      string
+}
+
+type Provider interface {
+	// VerifyToken checks a bearer token and returns the identity it was issued for.
+	VerifyToken(ctx context.Context, token string) (*Identity, error)
+	// CreateUser registers a user with the provider and returns its UID, which is
+	// the UID requested in user when the provider honours it.
+	CreateUser(ctx context.Context, user *UserToCreate) (string, error)
+	// DisableUser prevents the user from signing in with the provider.
+	DisableUser(ctx context.Context, uid string) error
+	// EnableUser lets a disabled user sign in with the provider again.
+	EnableUser(ctx context.Context, uid string) error
+	// UpdateEmail changes the verified email address of the user.
+	UpdateEmail(ctx context.Context, uid string, email string) error
+	// DeleteUser removes the user from the provider for good.
+	DeleteUser(ctx context.Context, uid string) error
+}
+
+// Chain returns a Provider that accepts tokens verified by any of the providers,
+// trying them in order, and manages users with the first one.
+func Chain(primary Provider, others ...Provider) Provider {
+	return chain(append([]Provider{primary}, others...))
+}
+
+type chain []Provider
+
+func (c chain) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	for _, provider := range c {
+		identity, err := provider.VerifyToken(ctx, token)
+		if err == nil {
+			return identity, nil
+		}
+		if !errors.Is(err, ErrInvalidToken) {
+			return nil, err
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+func (c chain) CreateUser(ctx context.Context, user *UserToCreate) (string, error) {
+	return c[0].CreateUser(ctx, user)
+}
+
+func (c chain) DisableUser(ctx context.Context, uid string) error {
+	return c[0].DisableUser(ctx, uid)
+}
+
+func (c chain) EnableUser(ctx context.Context, uid string) error {
+	return c[0].EnableUser(ctx, uid)
+}
+
+func (c chain) UpdateEmail(ctx context.Context, uid string, email string) error {
+	return c[0].UpdateEmail(ctx, uid, email)
+}
+
+func (c chain) DeleteUser(ctx context.Context, uid string) error {
+	return c[0].DeleteUser(ctx, uid)
+}
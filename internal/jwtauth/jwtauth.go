@@ -0,0 +1,173 @@
+// Package jwtauth issues and verifies the first-party JWTs used for sessions. Tokens
+// are signed either with an HMAC secret (HS256) or an Ed25519 key (EdDSA), and carry
+// a "typ" claim so that a refresh token can never be used as an access token or the
+// other way around.
+package jwtauth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pascaldekloe/jwt"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+
+	// Issuer and audience of every token we sign.
+	Name = "offerland.cc"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Issuer signs and verifies tokens of a single type with a fixed time-to-live.
+type Issuer struct {
+	Type string
+	TTL  time.Duration
+
+	algorithm  string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// Token is a signed JWT together with the claims it was issued with.
+type Token struct {
+	Token   string
+	ID      string
+	Subject string
+	Expiry  time.Time
+	TTL     time.Duration
+}
+
+// MinHMACSecretLength is the length in bytes below which an HMAC secret is too weak
+// to sign tokens with outside development, the size of an HS256 key.
+const MinHMACSecretLength = 32
+
+// CheckHMACSecret returns an error when secret is missing, a placeholder or too short
+// to sign production tokens with.
+func CheckHMACSecret(secret string) error {
+	switch {
+	case secret == "":
+		return errors.New("jwtauth: HMAC secret must not be empty")
+	case secret == "secret":
+		return errors.New("jwtauth: HMAC secret must not be the placeholder \"secret\"")
+	case len(secret) < MinHMACSecretLength:
+		return fmt.Errorf("jwtauth: HMAC secret must be at least %d bytes", MinHMACSecretLength)
+	}
+	return nil
+}
+
+// NewHMACIssuer returns an Issuer that signs tokens with HS256 and secret.
+func NewHMACIssuer(tokenType string, ttl time.Duration, secret string) (*Issuer, error) {
+	if secret == "" {
+		return nil, errors.New("jwtauth: HMAC secret must not be empty")
+	}
+
+	return &Issuer{
+		Type:      tokenType,
+		TTL:       ttl,
+		algorithm: AlgorithmHS256,
+		secret:    []byte(secret),
+	}, nil
+}
+
+// NewEdDSAIssuer returns an Issuer that signs tokens with the Ed25519 key derived
+// from seed, a base64-encoded 32-byte private key seed.
+func NewEdDSAIssuer(tokenType string, ttl time.Duration, seed string) (*Issuer, error) {
+	rawSeed, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil {
+		return nil, fmt.Errorf("jwtauth: decoding Ed25519 seed: %w", err)
+	}
+	if len(rawSeed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("jwtauth: Ed25519 seed must be %d bytes", ed25519.SeedSize)
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(rawSeed)
+
+	return &Issuer{
+		Type:       tokenType,
+		TTL:        ttl,
+		algorithm:  AlgorithmEdDSA,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// Issue signs a new token for subject. Extra claims are added to the payload as is.
+func (i *Issuer) Issue(subject string, extra map[string]any) (*Token, error) {
+	now := time.Now()
+	expiry := now.Add(i.TTL)
+
+	claims := jwt.Claims{Set: map[string]any{}}
+	for name, value := range extra {
+		claims.Set[name] = value
+	}
+	claims.Set["typ"] = i.Type
+
+	claims.Subject = subject
+	claims.ID = uuid.New().String()
+	claims.Issued = jwt.NewNumericTime(now)
+	claims.NotBefore = jwt.NewNumericTime(now)
+	claims.Expires = jwt.NewNumericTime(expiry)
+	claims.Issuer = Name
+	claims.Audiences = []string{Name}
+
+	var tokenBytes []byte
+	var err error
+	switch i.algorithm {
+	case AlgorithmEdDSA:
+		tokenBytes, err = claims.EdDSASign(i.privateKey)
+	default:
+		tokenBytes, err = claims.HMACSign(jwt.HS256, i.secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Token:   string(tokenBytes),
+		ID:      claims.ID,
+		Subject: subject,
+		Expiry:  expiry,
+		TTL:     i.TTL,
+	}, nil
+}
+
+// Verify checks the signature, the temporal claims, the issuer, the audience and the
+// token type, and returns the claims of a valid token.
+func (i *Issuer) Verify(token string) (*jwt.Claims, error) {
+	var claims *jwt.Claims
+	var err error
+	switch i.algorithm {
+	case AlgorithmEdDSA:
+		claims, err = jwt.EdDSACheck([]byte(token), i.publicKey)
+	default:
+		claims, err = jwt.HMACCheck([]byte(token), i.secret)
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !claims.Valid(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Issuer != Name || !claims.AcceptAudience(Name) || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if tokenType, _ := claims.String("typ"); tokenType != i.Type {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
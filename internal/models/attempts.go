@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// An AttemptPolicy says how many failures a counter tolerates within Window before
+// it locks. The first lockout lasts Lockout; every further failure while over the
+// limit doubles it, up to MaxLockout.
+type AttemptPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	Lockout     time.Duration
+	MaxLockout  time.Duration
+}
+
+// Create an AttemptModel struct which wraps the connection pool. Counters are kept in
+// Postgres so that every instance of the API sees the same ones.
+type AttemptModel struct {
+	DB *sql.DB
+}
+
+// LockedUntil returns the time until which the counter is locked, or the zero time if
+// it is not locked.
+func (m AttemptModel) LockedUntil(scope, key string) (time.Time, error) {
+	query := `
+		SELECT locked_until
+		FROM auth_attempts
+		WHERE scope = $1 AND key = $2 AND locked_until > $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lockedUntil time.Time
+	err := m.DB.QueryRowContext(ctx, query, scope, key, time.Now()).Scan(&lockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, err
+		}
+	}
+	return lockedUntil, nil
+}
+
+// Fail counts a failure against the counter and returns the time until which it is
+// now locked, or the zero time if it is still under the limit.
+func (m AttemptModel) Fail(scope, key string, policy AttemptPolicy) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	// Start a new window when the previous one has passed and the counter is not
+	// locked, otherwise keep counting.
+	query := `
+		INSERT INTO auth_attempts (scope, key, failures, window_start)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET failures = CASE
+				WHEN auth_attempts.window_start <= $4 AND COALESCE(auth_attempts.locked_until, $3) <= $3 THEN 1
+				ELSE auth_attempts.failures + 1
+			END,
+			window_start = CASE
+				WHEN auth_attempts.window_start <= $4 AND COALESCE(auth_attempts.locked_until, $3) <= $3 THEN $3
+				ELSE auth_attempts.window_start
+			END
+		RETURNING failures`
+
+	var failures int
+	err = tx.QueryRowContext(ctx, query, scope, key, now, now.Add(-policy.Window)).Scan(&failures)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if failures < policy.MaxFailures {
+		return time.Time{}, tx.Commit()
+	}
+
+	lockout := policy.Lockout
+	for i := policy.MaxFailures; i < failures && lockout < policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > policy.MaxLockout {
+		lockout = policy.MaxLockout
+	}
+	lockedUntil := now.Add(lockout)
+
+	_, err = tx.ExecContext(ctx, `UPDATE auth_attempts SET locked_until = $1 WHERE scope = $2 AND key = $3`, lockedUntil, scope, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lockedUntil, tx.Commit()
+}
+
+// DeleteStale deletes the counters whose window started before before and that are
+// not locked any more.
+func (m AttemptModel) DeleteStale(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM auth_attempts
+		WHERE window_start < $1 AND COALESCE(locked_until, window_start) < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Reset clears the counter, e.g. after a successful login.
+func (m AttemptModel) Reset(scope, key string) error {
+	query := `
+		DELETE FROM auth_attempts
+		WHERE scope = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, key)
+	return err
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// An AuditEntry records a security-relevant event, such as a failed login or a
+// lockout. UserID is empty when the event cannot be tied to an account.
+type AuditEntry struct {
+	ID        int64          `json:"id"`
+	UserID    string         `json:"-"`
+	Event     string         `json:"event"`
+	IP        string         `json:"ip"`
+	UserAgent string         `json:"user_agent"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Create an AuditModel struct which wraps the connection pool.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	metadata := entry.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (user_id, event, ip, user_agent, metadata)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	args := []any{entry.UserID, entry.Event, entry.IP, entry.UserAgent, metadataJSON}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
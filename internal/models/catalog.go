@@ -0,0 +1,596 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"offerland.cc/internal/catalog"
+)
+
+var (
+	ErrDuplicateAlias = errors.New("duplicate alias")
+	ErrMergeMismatch  = errors.New("catalog entries cannot be merged")
+	ErrUnknownKind    = errors.New("unknown catalog kind")
+)
+
+// A CatalogEntry is a school or major matching a search. Matched is the alias the
+// search matched, when it was not the name itself.
+type CatalogEntry struct {
+	Kind       catalog.Kind `json:"kind"`
+	ID         uuid.UUID    `json:"id"`
+	Name       string       `json:"name"`
+	Matched    string       `json:"matched,omitempty"`
+	SchoolID   *uuid.UUID   `json:"school_id,omitempty"`
+	SchoolName string       `json:"school_name,omitempty"`
+	DegreeName string       `json:"degree_name,omitempty"`
+	Score      float64      `json:"score"`
+}
+
+// A CatalogAlias is another name of a school or major.
+type CatalogAlias struct {
+	ID        int64        `json:"id"`
+	Kind      catalog.Kind `json:"kind"`
+	TargetID  uuid.UUID    `json:"target_id"`
+	Alias     string       `json:"alias"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// A CatalogMerge describes what merging two catalog entries moved over.
+type CatalogMerge struct {
+	Kind        catalog.Kind `json:"kind"`
+	From        uuid.UUID    `json:"from"`
+	Into        uuid.UUID    `json:"into"`
+	Results     int64        `json:"results"`
+	Departments int64        `json:"departments"`
+	Majors      int64        `json:"majors"`
+	Aliases     int64        `json:"aliases"`
+}
+
+// Create a CatalogModel struct which wraps the connection pool.
+type CatalogModel struct {
+	DB *sql.DB
+}
+
+// containsPattern returns an ILIKE pattern matching names that contain q.
+func containsPattern(q string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(q) + "%"
+}
+
+// Autocomplete returns the schools or majors whose name or an alias resembles q,
+// best match first. Majors can be limited to one school.
+func (m CatalogModel) Autocomplete(kind catalog.Kind, q string, schoolID *uuid.UUID, limit int) ([]*CatalogEntry, error) {
+	var query string
+	var args []any
+	switch kind {
+	case catalog.KindSchool:
+		query = `
+			SELECT school_id, school_name, matched, score, NULL::uuid, '', ''
+			FROM (
+				SELECT DISTINCT ON (s.school_id) s.school_id, s.school_name, matches.matched, matches.score
+				FROM (
+					SELECT school_id, school_name AS matched, word_similarity($1, school_name) AS score
+					FROM schools
+					WHERE $1 <% school_name OR school_name ILIKE $2
+					UNION ALL
+					SELECT school_id, alias, word_similarity($1, alias)
+					FROM school_aliases
+					WHERE $1 <% alias OR alias ILIKE $2
+				) matches
+				INNER JOIN schools s ON s.school_id = matches.school_id
+				ORDER BY s.school_id, matches.score DESC
+			) best
+			ORDER BY score DESC, school_name
+			LIMIT $3`
+		args = []any{q, containsPattern(q), limit}
+	case catalog.KindMajor:
+		query = `
+			SELECT major_id, major_name, matched, score, school_id, school_name, degree_name
+			FROM (
+				SELECT DISTINCT ON (m.major_id) m.major_id, m.major_name, matches.matched, matches.score,
+					s.school_id, s.school_name, d.degree_name
+				FROM (
+					SELECT major_id, major_name AS matched, word_similarity($1, major_name) AS score
+					FROM majors
+					WHERE $1 <% major_name OR major_name ILIKE $2
+					UNION ALL
+					SELECT major_id, alias, word_similarity($1, alias)
+					FROM major_aliases
+					WHERE $1 <% alias OR alias ILIKE $2
+				) matches
+				INNER JOIN majors m ON m.major_id = matches.major_id
+				INNER JOIN schools s ON s.school_id = m.school_id
+				INNER JOIN degrees d ON d.degree_id = m.degree_id
+				WHERE $3::uuid IS NULL OR m.school_id = $3
+				ORDER BY m.major_id, matches.score DESC
+			) best
+			ORDER BY score DESC, major_name
+			LIMIT $4`
+		args = []any{q, containsPattern(q), schoolID, limit}
+	default:
+		return nil, ErrUnknownKind
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*CatalogEntry{}
+	for rows.Next() {
+		entry := &CatalogEntry{Kind: kind}
+		err := rows.Scan(&entry.ID, &entry.Name, &entry.Matched, &entry.Score, &entry.SchoolID, &entry.SchoolName, &entry.DegreeName)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Matched == entry.Name {
+			entry.Matched = ""
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ResolveSchool returns the school called name, or the school name is an alias of.
+func (m CatalogModel) ResolveSchool(name string) (*CatalogEntry, error) {
+	query := `
+		SELECT school_id, school_name
+		FROM (
+			SELECT school_id, school_name, 0 AS priority
+			FROM schools
+			WHERE lower(school_name) = lower($1)
+			UNION ALL
+			SELECT s.school_id, s.school_name, 1
+			FROM school_aliases a
+			INNER JOIN schools s ON s.school_id = a.school_id
+			WHERE a.normalized = $2
+		) matches
+		ORDER BY priority, school_id
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry := &CatalogEntry{Kind: catalog.KindSchool, Score: 1}
+	err := m.DB.QueryRowContext(ctx, query, catalog.DisplayName(name), catalog.Normalize(name)).Scan(&entry.ID, &entry.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// ResolveMajor returns the major of the school called name, or the major name is an
+// alias of.
+func (m CatalogModel) ResolveMajor(schoolID uuid.UUID, name string) (*CatalogEntry, error) {
+	query := `
+		SELECT major_id, major_name, degree_name
+		FROM (
+			SELECT m.major_id, m.major_name, m.degree_id, 0 AS priority
+			FROM majors m
+			WHERE m.school_id = $1 AND lower(m.major_name) = lower($2)
+			UNION ALL
+			SELECT m.major_id, m.major_name, m.degree_id, 1
+			FROM major_aliases a
+			INNER JOIN majors m ON m.major_id = a.major_id
+			WHERE m.school_id = $1 AND a.normalized = $3
+		) matches
+		INNER JOIN degrees ON degrees.degree_id = matches.degree_id
+		ORDER BY priority, major_id
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry := &CatalogEntry{Kind: catalog.KindMajor, SchoolID: &schoolID, Score: 1}
+	err := m.DB.QueryRowContext(ctx, query, schoolID, catalog.DisplayName(name), catalog.Normalize(name)).Scan(&entry.ID, &entry.Name, &entry.DegreeName)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// GetSchool returns the school with the ID.
+func (m CatalogModel) GetSchool(id uuid.UUID) (*CatalogEntry, error) {
+	query := `SELECT school_id, school_name FROM schools WHERE school_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry := &CatalogEntry{Kind: catalog.KindSchool, Score: 1}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&entry.ID, &entry.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// GetMajor returns the major with the ID, along with its school and degree.
+func (m CatalogModel) GetMajor(id uuid.UUID) (*CatalogEntry, error) {
+	query := `
+		SELECT m.major_id, m.major_name, s.school_id, s.school_name, d.degree_name
+		FROM majors m
+		INNER JOIN schools s ON s.school_id = m.school_id
+		INNER JOIN degrees d ON d.degree_id = m.degree_id
+		WHERE m.major_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry := &CatalogEntry{Kind: catalog.KindMajor, Score: 1}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&entry.ID, &entry.Name, &entry.SchoolID, &entry.SchoolName, &entry.DegreeName)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// GetAliases returns the aliases of a school or major, oldest first.
+func (m CatalogModel) GetAliases(kind catalog.Kind, targetID uuid.UUID) ([]*CatalogAlias, error) {
+	var query string
+	switch kind {
+	case catalog.KindSchool:
+		query = `SELECT alias_id, school_id, alias, created_at FROM school_aliases WHERE school_id = $1 ORDER BY alias_id`
+	case catalog.KindMajor:
+		query = `SELECT alias_id, major_id, alias, created_at FROM major_aliases WHERE major_id = $1 ORDER BY alias_id`
+	default:
+		return nil, ErrUnknownKind
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []*CatalogAlias{}
+	for rows.Next() {
+		alias := &CatalogAlias{Kind: kind}
+		err := rows.Scan(&alias.ID, &alias.TargetID, &alias.Alias, &alias.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// AddAlias adds another name for a school or major. A school alias must not name any
+// other school, and a major alias must not name any other major of the same school.
+func (m CatalogModel) AddAlias(kind catalog.Kind, targetID uuid.UUID, alias string) (*CatalogAlias, error) {
+	alias = catalog.DisplayName(alias)
+	normalized := catalog.Normalize(alias)
+
+	var conflictQuery, insertQuery string
+	switch kind {
+	case catalog.KindSchool:
+		conflictQuery = `
+			SELECT
+				EXISTS (SELECT 1 FROM schools WHERE school_id = $1),
+				EXISTS (SELECT 1 FROM schools WHERE school_id <> $1 AND lower(school_name) = lower($2))
+					OR EXISTS (SELECT 1 FROM school_aliases WHERE school_id <> $1 AND normalized = $3)`
+		insertQuery = `
+			INSERT INTO school_aliases (school_id, alias, normalized)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (normalized) DO NOTHING
+			RETURNING alias_id, created_at`
+	case catalog.KindMajor:
+		conflictQuery = `
+			SELECT
+				EXISTS (SELECT 1 FROM majors WHERE major_id = $1),
+				EXISTS (
+					SELECT 1 FROM majors other
+					INNER JOIN majors target ON target.major_id = $1
+					LEFT JOIN major_aliases a ON a.major_id = other.major_id
+					WHERE other.school_id = target.school_id AND other.major_id <> $1
+					AND (lower(other.major_name) = lower($2) OR a.normalized = $3)
+				)`
+		insertQuery = `
+			INSERT INTO major_aliases (major_id, alias, normalized)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (major_id, normalized) DO NOTHING
+			RETURNING alias_id, created_at`
+	default:
+		return nil, ErrUnknownKind
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists, conflict bool
+	err := m.DB.QueryRowContext(ctx, conflictQuery, targetID, alias, normalized).Scan(&exists, &conflict)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	if conflict {
+		return nil, ErrDuplicateAlias
+	}
+
+	created := &CatalogAlias{Kind: kind, TargetID: targetID, Alias: alias}
+	err = m.DB.QueryRowContext(ctx, insertQuery, targetID, alias, normalized).Scan(&created.ID, &created.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrDuplicateAlias
+		default:
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// DeleteAlias deletes an alias of a school or major.
+func (m CatalogModel) DeleteAlias(kind catalog.Kind, aliasID int64) error {
+	var query string
+	switch kind {
+	case catalog.KindSchool:
+		query = `DELETE FROM school_aliases WHERE alias_id = $1`
+	case catalog.KindMajor:
+		query = `DELETE FROM major_aliases WHERE alias_id = $1`
+	default:
+		return ErrUnknownKind
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, aliasID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Merge folds the duplicate school or major from into into. Results, watches,
+// aliases and, for schools, departments and majors move over to into, the name of
+// from becomes an alias of into, and from is deleted. Results and watches that would
+// then duplicate ones the user already has for into are dropped. Majors can only be
+// merged within the same school and degree.
+func (m CatalogModel) Merge(kind catalog.Kind, from, into uuid.UUID) (*CatalogMerge, error) {
+	if from == into {
+		return nil, ErrMergeMismatch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	merge := &CatalogMerge{Kind: kind, From: from, Into: into}
+	switch kind {
+	case catalog.KindSchool:
+		err = mergeSchools(ctx, tx, merge)
+	case catalog.KindMajor:
+		err = mergeMajors(ctx, tx, merge)
+	default:
+		err = ErrUnknownKind
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+// lockCatalogEntries locks the rows of from and into selected by query, and returns
+// the name and the extra column of each.
+func lockCatalogEntries(ctx context.Context, tx *sql.Tx, query string, from, into uuid.UUID) (fromName, intoName string, fromExtra, intoExtra string, err error) {
+	rows, err := tx.QueryContext(ctx, query, from, into)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var id uuid.UUID
+		var name, extra string
+		err = rows.Scan(&id, &name, &extra)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		if id == from {
+			fromName, fromExtra = name, extra
+		} else {
+			intoName, intoExtra = name, extra
+		}
+		found++
+	}
+	if err = rows.Err(); err != nil {
+		return "", "", "", "", err
+	}
+	if found != 2 {
+		return "", "", "", "", ErrRecordNotFound
+	}
+	return fromName, intoName, fromExtra, intoExtra, nil
+}
+
+func mergeSchools(ctx context.Context, tx *sql.Tx, merge *CatalogMerge) error {
+	fromName, intoName, _, _, err := lockCatalogEntries(ctx, tx,
+		`SELECT school_id, school_name, '' FROM schools WHERE school_id IN ($1, $2) ORDER BY school_id FOR UPDATE`,
+		merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+
+	// Results still without a school_id are matched by name.
+	matches := func(r string) string {
+		return `(` + r + `.school_id = $1 OR (` + r + `.school_id IS NULL AND lower(` + r + `.school_name) = lower($2)))`
+	}
+
+	// Results and watches of programs move along. A user may already have the same
+	// result or watch for both schools, and only one of them can stay.
+	for _, table := range []string{"user_to_results", "program_watches"} {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM `+table+` r
+			WHERE `+matches("r")+`
+			AND EXISTS (
+				SELECT 1 FROM `+table+` kept
+				WHERE kept.user_id = r.user_id AND kept.major_name = r.major_name
+				AND (kept.school_name = $3 OR (`+matches("kept")+` AND kept.ctid < r.ctid))
+			)`, merge.From, fromName, intoName)
+		if err != nil {
+			return err
+		}
+
+		moved, err := execCount(ctx, tx, `
+			UPDATE `+table+` r SET school_id = $3, school_name = $4
+			WHERE `+matches("r"), merge.From, fromName, merge.Into, intoName)
+		if err != nil {
+			return err
+		}
+		if table == "user_to_results" {
+			merge.Results = moved
+		}
+	}
+
+	merge.Departments, err = execCount(ctx, tx, `UPDATE departments SET school_id = $2 WHERE school_id = $1`, merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+	merge.Majors, err = execCount(ctx, tx, `UPDATE majors SET school_id = $2 WHERE school_id = $1`, merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+
+	merge.Aliases, err = execCount(ctx, tx, `UPDATE school_aliases SET school_id = $2 WHERE school_id = $1`, merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+	if normalized := catalog.Normalize(fromName); normalized != catalog.Normalize(intoName) {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO school_aliases (school_id, alias, normalized)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (normalized) DO UPDATE SET school_id = EXCLUDED.school_id`,
+			merge.Into, fromName, normalized)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schools WHERE school_id = $1`, merge.From)
+	return err
+}
+
+func mergeMajors(ctx context.Context, tx *sql.Tx, merge *CatalogMerge) error {
+	fromName, intoName, fromParent, intoParent, err := lockCatalogEntries(ctx, tx,
+		`SELECT major_id, major_name, school_id::text || '/' || degree_id::text FROM majors WHERE major_id IN ($1, $2) ORDER BY major_id FOR UPDATE`,
+		merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+	if fromParent != intoParent {
+		return ErrMergeMismatch
+	}
+	schoolID := strings.SplitN(fromParent, "/", 2)[0]
+
+	// Results still without a major_id are matched by name within the school.
+	matches := func(r string) string {
+		return `(` + r + `.major_id = $1 OR (` + r + `.major_id IS NULL AND ` + r + `.school_id = $3 AND lower(` + r + `.major_name) = lower($2)))`
+	}
+
+	for _, table := range []string{"user_to_results", "program_watches"} {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM `+table+` r
+			WHERE `+matches("r")+`
+			AND EXISTS (
+				SELECT 1 FROM `+table+` kept
+				WHERE kept.user_id = r.user_id AND kept.school_name = r.school_name
+				AND (kept.major_name = $4 OR (`+matches("kept")+` AND kept.ctid < r.ctid))
+			)`, merge.From, fromName, schoolID, intoName)
+		if err != nil {
+			return err
+		}
+
+		moved, err := execCount(ctx, tx, `
+			UPDATE `+table+` r SET major_id = $4, major_name = $5
+			WHERE `+matches("r"), merge.From, fromName, schoolID, merge.Into, intoName)
+		if err != nil {
+			return err
+		}
+		if table == "user_to_results" {
+			merge.Results = moved
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM major_aliases
+		WHERE major_id = $1
+		AND normalized IN (SELECT normalized FROM major_aliases WHERE major_id = $2)`, merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+	merge.Aliases, err = execCount(ctx, tx, `UPDATE major_aliases SET major_id = $2 WHERE major_id = $1`, merge.From, merge.Into)
+	if err != nil {
+		return err
+	}
+	if normalized := catalog.Normalize(fromName); normalized != catalog.Normalize(intoName) {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO major_aliases (major_id, alias, normalized)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (major_id, normalized) DO NOTHING`,
+			merge.Into, fromName, normalized)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM majors WHERE major_id = $1`, merge.From)
+	return err
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
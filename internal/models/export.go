@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Levels of suppression of an AnonymizedResult.
+const (
+	SuppressionNone       = "none"
+	SuppressionBackground = "background"
+	SuppressionProfile    = "profile"
+)
+
+// An AnonymizedResult is a result with the background of the applicant, for export.
+// It carries nothing that points at the user: no IDs, names or free text, and not
+// even a pseudonym, since the results of a user are public and a set of results
+// linked by a pseudonym would be easy to match against them.
+//
+// Profile fields are generalized: the GPA to bands of 0.2 on a 4.0 scale, GRE and
+// TOEFL scores to bands of 5, work experience to whole years and publications capped
+// at 5. They are then suppressed as needed for k-anonymity, see ResultModel.Export.
+type AnonymizedResult struct {
+	SchoolID            *uuid.UUID `json:"school_id"`
+	School              string     `json:"school"`
+	MajorID             *uuid.UUID `json:"major_id"`
+	Major               string     `json:"major"`
+	Degree              *string    `json:"degree"`
+	Cycle               int        `json:"cycle"`
+	DecisionMonth       string     `json:"decision_month"`
+	Status              string     `json:"status"`
+	GPA                 *float64   `json:"gpa"`
+	GREVerbal           *int       `json:"gre_verbal"`
+	GREQuant            *int       `json:"gre_quant"`
+	GREWriting          *float64   `json:"gre_writing"`
+	TOEFL               *int       `json:"toefl"`
+	IELTS               *float64   `json:"ielts"`
+	UndergradSchool     *string    `json:"undergrad_school"`
+	UndergradMajor      *string    `json:"undergrad_major"`
+	GraduationYear      *int       `json:"graduation_year"`
+	Country             *string    `json:"country"`
+	WorkExperienceYears *int       `json:"work_experience_years"`
+	Publications        *int       `json:"publications"`
+	Suppression         string     `json:"suppression"`
+}
+
+// ExportFilter selects the results to export.
+type ExportFilter struct {
+	// Cycle limits the export to one admission cycle, 0 exports every cycle.
+	Cycle    int
+	SchoolID *uuid.UUID
+	// MinGroupSize is the k of k-anonymity.
+	MinGroupSize int
+}
+
+// cycleExpr is the admission cycle of a result. A cycle runs from August to July and
+// is named after the year it ends in, which is the year admitted applicants start.
+const cycleExpr = `EXTRACT(YEAR FROM r.announce_date + interval '5 months')::int`
+
+// Export calls fn with each result matching filter, reading them from the database
+// one at a time.
+//
+// Since results are public, what an export adds is the background of the applicants,
+// and what has to be protected is telling whose background a result comes with. The
+// quasi-identifiers are therefore the program, cycle, decision month and status of a
+// result along with the generalized profile. A result whose full set of
+// quasi-identifiers is shared by fewer than MinGroupSize exported results keeps only
+// the GPA band, GRE verbal and quantitative bands, TOEFL band and country, if those
+// are shared by enough results, and otherwise loses its profile fields entirely.
+func (m *ResultModel) Export(ctx context.Context, filter ExportFilter, fn func(*AnonymizedResult) error) error {
+	query := `
+		WITH results AS (
+			SELECT r.user_id, r.school_id, r.school_name, r.major_id, r.major_name, r.status,
+				` + cycleExpr + ` AS cycle,
+				to_char(r.announce_date, 'YYYY-MM') AS decision_month,
+				COALESCE(r.school_id::text, lower(r.school_name)) AS school_key,
+				COALESCE(r.major_id::text, lower(r.major_name)) AS major_key
+			FROM user_to_results r
+			WHERE ($1 = 0 OR ` + cycleExpr + ` = $1)
+			AND ($2::uuid IS NULL OR r.school_id = $2)
+		), profiles AS (
+			SELECT user_id,
+				(floor(gpa / gpa_scale * 20) / 5)::float8 AS gpa,
+				gre_verbal / 5 * 5 AS gre_verbal,
+				gre_quant / 5 * 5 AS gre_quant,
+				gre_writing::float8 AS gre_writing,
+				toefl / 5 * 5 AS toefl,
+				ielts::float8 AS ielts,
+				undergrad_school,
+				undergrad_major,
+				graduation_year,
+				country,
+				work_experience_months / 12 AS work_experience_years,
+				LEAST(publications, 5) AS publications
+			FROM applicant_profiles
+			WHERE user_id IN (SELECT user_id FROM results)
+		)
+		SELECT r.school_id, r.school_name, r.major_id, r.major_name, d.degree_name,
+			r.cycle, r.decision_month, r.status,
+			p.gpa, p.gre_verbal, p.gre_quant, p.gre_writing, p.toefl, p.ielts,
+			p.undergrad_school, p.undergrad_major, p.graduation_year, p.country,
+			p.work_experience_years, p.publications, p.user_id IS NOT NULL,
+			count(*) OVER (PARTITION BY r.school_key, r.major_key, r.cycle, r.decision_month, r.status,
+				p.gpa, p.gre_verbal, p.gre_quant, p.gre_writing, p.toefl, p.ielts,
+				p.undergrad_school, p.undergrad_major, p.graduation_year, p.country,
+				p.work_experience_years, p.publications),
+			count(*) OVER (PARTITION BY r.school_key, r.major_key, r.cycle, r.decision_month, r.status,
+				p.gpa, p.gre_verbal, p.gre_quant, p.toefl, p.country)
+		FROM results r
+		LEFT JOIN profiles p ON p.user_id = r.user_id
+		LEFT JOIN majors m ON m.major_id = r.major_id
+		LEFT JOIN degrees d ON d.degree_id = m.degree_id
+		ORDER BY r.school_name, r.major_name, r.cycle, r.decision_month, r.status`
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.Cycle, filter.SchoolID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r AnonymizedResult
+		var hasProfile bool
+		var fullGroup, coarseGroup int
+		err := rows.Scan(
+			&r.SchoolID, &r.School, &r.MajorID, &r.Major, &r.Degree,
+			&r.Cycle, &r.DecisionMonth, &r.Status,
+			&r.GPA, &r.GREVerbal, &r.GREQuant, &r.GREWriting, &r.TOEFL, &r.IELTS,
+			&r.UndergradSchool, &r.UndergradMajor, &r.GraduationYear, &r.Country,
+			&r.WorkExperienceYears, &r.Publications, &hasProfile,
+			&fullGroup, &coarseGroup,
+		)
+		if err != nil {
+			return err
+		}
+
+		r.Suppression = SuppressionNone
+		if hasProfile && fullGroup < filter.MinGroupSize {
+			r.Suppression = SuppressionBackground
+			r.GREWriting, r.IELTS = nil, nil
+			r.UndergradSchool, r.UndergradMajor, r.GraduationYear = nil, nil, nil
+			r.WorkExperienceYears, r.Publications = nil, nil
+		}
+		if hasProfile && coarseGroup < filter.MinGroupSize {
+			r.Suppression = SuppressionProfile
+			r.GPA, r.GREVerbal, r.GREQuant, r.TOEFL, r.Country = nil, nil, nil, nil, nil
+		}
+
+		err = fn(&r)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// An Identity links an account at an external login provider to a user. One user
+// can have identities at several providers.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Define a custom ErrDuplicateIdentity error, returned when the provider account is
+// already linked to a user.
+var (
+	ErrDuplicateIdentity = errors.New("duplicate identity")
+)
+
+// Create an IdentityModel struct which wraps the connection pool.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+func (m IdentityModel) Insert(identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at`
+
+	args := []any{identity.Provider, identity.Subject, identity.UserID, identity.Email}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&identity.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_pkey"`:
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUserID returns the ID of the user linked to the provider account.
+func (m IdentityModel) GetUserID(provider, subject string) (string, error) {
+	query := `
+		SELECT user_id
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID string
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return userID, nil
+}
+
+func (m IdentityModel) GetAllForUser(userID string) ([]*Identity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Delete unlinks every account at provider from the user.
+func (m IdentityModel) Delete(userID, provider string) error {
+	query := `
+		DELETE FROM user_identities
+		WHERE user_id = $1 AND provider = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, provider)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// OIDCState is the server-side half of an authorization request: the PKCE verifier
+// and nonce that must match when the provider redirects back with the state. UserID
+// is set when a logged-in user is linking the provider account to their own.
+type OIDCState struct {
+	Plaintext    string
+	Provider     string
+	UserID       string
+	CodeVerifier string
+	Nonce        string
+	Expiry       time.Time
+}
+
+func (m IdentityModel) InsertState(state *OIDCState) error {
+	query := `
+		INSERT INTO oidc_states (hash, provider, user_id, code_verifier, nonce, expiry)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)`
+
+	stateHash := sha256.Sum256([]byte(state.Plaintext))
+	args := []any{stateHash[:], state.Provider, state.UserID, state.CodeVerifier, state.Nonce, state.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ConsumeState deletes and returns an unexpired state issued for provider, so that
+// each authorization response can be redeemed only once. userID must match the user
+// the state was issued to, or be empty for a state issued for signing in.
+func (m IdentityModel) ConsumeState(provider, plaintext, userID string) (*OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE hash = $1 AND provider = $2 AND COALESCE(user_id, '') = $3 AND expiry > $4
+		RETURNING provider, COALESCE(user_id, ''), code_verifier, nonce, expiry`
+
+	stateHash := sha256.Sum256([]byte(plaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	state := OIDCState{Plaintext: plaintext}
+	err := m.DB.QueryRowContext(ctx, query, stateHash[:], provider, userID, time.Now()).Scan(
+		&state.Provider, &state.UserID, &state.CodeVerifier, &state.Nonce, &state.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &state, nil
+}
@@ -16,8 +16,17 @@ type Models struct {
 	Users       UserModel
 	Permissions PermissionModel
 	Tokens      TokenModel
+	Sessions    SessionModel
+	Identities  IdentityModel
+	TwoFactor   TwoFactorModel
+	Attempts    AttemptModel
+	Audit       AuditModel
 	Results     ResultModel
 	Posts       PostModel
+	Stats       StatsModel
+	Catalog     CatalogModel
+	Profiles    ApplicantProfileModel
+	Watches     WatchModel
 	// ApplicationResults ApplicationResultModel
 	// Schools     SchoolModel
 	// Majors      MajorModel
@@ -30,8 +39,17 @@ func NewModels(db *sql.DB) *Models {
 		Users:       UserModel{DB: db},
 		Permissions: PermissionModel{DB: db},
 		Tokens:      TokenModel{DB: db},
+		Sessions:    SessionModel{DB: db},
+		Identities:  IdentityModel{DB: db},
+		TwoFactor:   TwoFactorModel{DB: db},
+		Attempts:    AttemptModel{DB: db},
+		Audit:       AuditModel{DB: db},
 		Results:     ResultModel{DB: db},
 		Posts:       PostModel{DB: db},
+		Stats:       StatsModel{DB: db},
+		Catalog:     CatalogModel{DB: db},
+		Profiles:    ApplicantProfileModel{DB: db},
+		Watches:     WatchModel{DB: db},
 		// ApplicationResults: ApplicationResultModel{DB: db},
 		// Schools:     SchoolModel{DB: db},
 		// Majors:      MajorModel{DB: db},
@@ -31,7 +31,7 @@ func (m PostModel) GetPostByID(postID uuid.UUID) (Post, error) {
 		"add_result",
 		"body",
 		"created_at",
-		"user_id",
+		"COALESCE(user_id, '')",
 	}
 	query = fmt.Sprintf(`
 		SELECT %s
@@ -61,7 +61,7 @@ func (m PostModel) CheckPostIsMine(post *Post) (bool, error) {
 	var postOwner string
 
 	var query = `
-		SELECT (user_id)
+		SELECT COALESCE(user_id, '')
 		FROM posts 
 		WHERE post_id = $1
 	`
@@ -152,7 +152,7 @@ func (m PostModel) GetAllPosts(filter map[string][]string) ([]Post, error) {
 		"add_result",
 		"body",
 		"created_at",
-		"user_id",
+		"COALESCE(user_id, '')",
 	}
 	query = fmt.Sprintf(`
 		SELECT %s
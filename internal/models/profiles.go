@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// An ApplicantProfile is the academic background a user applied with. Every field is
+// optional. UndergradSchoolID is set when the undergraduate school was found in the
+// catalog. Public profiles are shown to others next to the username of the user.
+type ApplicantProfile struct {
+	UserID               string     `json:"-"`
+	GPA                  *float64   `json:"gpa"`
+	GPAScale             *float64   `json:"gpa_scale"`
+	GREVerbal            *int       `json:"gre_verbal"`
+	GREQuant             *int       `json:"gre_quant"`
+	GREWriting           *float64   `json:"gre_writing"`
+	TOEFL                *int       `json:"toefl"`
+	IELTS                *float64   `json:"ielts"`
+	UndergradSchoolID    *uuid.UUID `json:"undergrad_school_id"`
+	UndergradSchool      *string    `json:"undergrad_school"`
+	UndergradMajor       *string    `json:"undergrad_major"`
+	GraduationYear       *int       `json:"graduation_year"`
+	Country              *string    `json:"country"`
+	WorkExperienceMonths *int       `json:"work_experience_months"`
+	Publications         *int       `json:"publications"`
+	Public               bool       `json:"public"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// GPA4 returns the GPA converted to a 4.0 scale, or nil when it is not known.
+func (p *ApplicantProfile) GPA4() *float64 {
+	if p.GPA == nil || p.GPAScale == nil || *p.GPAScale <= 0 {
+		return nil
+	}
+	gpa := *p.GPA / *p.GPAScale * 4
+	return &gpa
+}
+
+// Create an ApplicantProfileModel struct which wraps the connection pool.
+type ApplicantProfileModel struct {
+	DB *sql.DB
+}
+
+func (m ApplicantProfileModel) Get(userID string) (*ApplicantProfile, error) {
+	query := `
+		SELECT user_id, gpa, gpa_scale, gre_verbal, gre_quant, gre_writing, toefl, ielts,
+			undergrad_school_id, undergrad_school, undergrad_major, graduation_year, country,
+			work_experience_months, publications, public, updated_at
+		FROM applicant_profiles
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p ApplicantProfile
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&p.UserID, &p.GPA, &p.GPAScale, &p.GREVerbal, &p.GREQuant, &p.GREWriting, &p.TOEFL, &p.IELTS,
+		&p.UndergradSchoolID, &p.UndergradSchool, &p.UndergradMajor, &p.GraduationYear, &p.Country,
+		&p.WorkExperienceMonths, &p.Publications, &p.Public, &p.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// Put creates the profile of a user or replaces all of its fields.
+func (m ApplicantProfileModel) Put(p *ApplicantProfile) error {
+	query := `
+		INSERT INTO applicant_profiles (user_id, gpa, gpa_scale, gre_verbal, gre_quant, gre_writing, toefl, ielts,
+			undergrad_school_id, undergrad_school, undergrad_major, graduation_year, country,
+			work_experience_months, publications, public)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (user_id) DO UPDATE SET
+			gpa = EXCLUDED.gpa,
+			gpa_scale = EXCLUDED.gpa_scale,
+			gre_verbal = EXCLUDED.gre_verbal,
+			gre_quant = EXCLUDED.gre_quant,
+			gre_writing = EXCLUDED.gre_writing,
+			toefl = EXCLUDED.toefl,
+			ielts = EXCLUDED.ielts,
+			undergrad_school_id = EXCLUDED.undergrad_school_id,
+			undergrad_school = EXCLUDED.undergrad_school,
+			undergrad_major = EXCLUDED.undergrad_major,
+			graduation_year = EXCLUDED.graduation_year,
+			country = EXCLUDED.country,
+			work_experience_months = EXCLUDED.work_experience_months,
+			publications = EXCLUDED.publications,
+			public = EXCLUDED.public,
+			updated_at = NOW()
+		RETURNING updated_at`
+
+	args := []any{
+		p.UserID, p.GPA, p.GPAScale, p.GREVerbal, p.GREQuant, p.GREWriting, p.TOEFL, p.IELTS,
+		p.UndergradSchoolID, p.UndergradSchool, p.UndergradMajor, p.GraduationYear, p.Country,
+		p.WorkExperienceMonths, p.Publications, p.Public,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&p.UpdatedAt)
+}
+
+// A PublicApplicant is a user with a public profile, along with the programs they
+// reported results for.
+type PublicApplicant struct {
+	UserID   string
+	Username string
+	Profile  ApplicantProfile
+	Programs []string
+}
+
+// GetPublic returns the users with a public profile other than excludeUserID, the
+// most recently updated first and at most limit of them. Accounts that are disabled
+// or waiting to be deleted are left out.
+func (m ApplicantProfileModel) GetPublic(excludeUserID string, limit int) ([]*PublicApplicant, error) {
+	query := `
+		SELECT u.user_id, u.username, p.gpa, p.gpa_scale, p.gre_verbal, p.gre_quant, p.gre_writing, p.toefl, p.ielts,
+			p.undergrad_school_id, p.undergrad_school, p.undergrad_major, p.graduation_year, p.country,
+			p.work_experience_months, p.publications, p.public, p.updated_at,
+			COALESCE(array_agg(DISTINCT ` + programKeyExpr + `) FILTER (WHERE r.user_id IS NOT NULL), '{}')
+		FROM applicant_profiles p
+		INNER JOIN users u ON u.user_id = p.user_id
+		LEFT JOIN user_to_results r ON r.user_id = p.user_id
+		WHERE p.public AND u.activated AND u.disabled_at IS NULL AND u.deletion_scheduled_at IS NULL
+			AND p.user_id <> $1
+		GROUP BY u.user_id, p.user_id
+		ORDER BY p.updated_at DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, excludeUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applicants []*PublicApplicant
+	for rows.Next() {
+		var a PublicApplicant
+		p := &a.Profile
+		err := rows.Scan(
+			&a.UserID, &a.Username, &p.GPA, &p.GPAScale, &p.GREVerbal, &p.GREQuant, &p.GREWriting, &p.TOEFL, &p.IELTS,
+			&p.UndergradSchoolID, &p.UndergradSchool, &p.UndergradMajor, &p.GraduationYear, &p.Country,
+			&p.WorkExperienceMonths, &p.Publications, &p.Public, &p.UpdatedAt,
+			pq.Array(&a.Programs),
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.UserID = a.UserID
+		applicants = append(applicants, &a)
+	}
+	return applicants, rows.Err()
+}
+
+func (m ApplicantProfileModel) Delete(userID string) error {
+	query := `
+		DELETE FROM applicant_profiles
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A Program is a major at a school that results are reported for. Programs in the
+// catalog are matched by ID; others by their names, ignoring case, like results
+// are grouped in exports.
+type Program struct {
+	SchoolID *uuid.UUID `json:"school_id"`
+	School   string     `json:"school"`
+	MajorID  *uuid.UUID `json:"major_id"`
+	Major    string     `json:"major"`
+	Degree   string     `json:"degree,omitempty"`
+}
+
+// programFilter matches the results r of the program given by $1 to $4: the school
+// ID, school name, major ID and major name.
+const programFilter = `
+	(CASE WHEN $1::uuid IS NULL THEN lower(r.school_name) = lower($2) ELSE r.school_id = $1 END)
+	AND (CASE WHEN $3::uuid IS NULL THEN lower(r.major_name) = lower($4) ELSE r.major_id = $3 END)`
+
+// programKeyExpr identifies the program of a result r, by its catalog IDs or else its
+// names, for comparing the programs of results.
+const programKeyExpr = `COALESCE(r.school_id::text, lower(r.school_name)) || '/' || COALESCE(r.major_id::text, lower(r.major_name))`
+
+// A ProgramCase is a decision of a program on an applicant who shared their
+// background.
+type ProgramCase struct {
+	Profile ApplicantProfile
+	Status  string
+	Cycle   int
+}
+
+// GetProgramCases returns the admissions and rejections of the program, most recent
+// first and at most limit of them, of applicants with a profile other than the user
+// excludeUserID.
+func (m *ResultModel) GetProgramCases(program Program, excludeUserID string, limit int) ([]*ProgramCase, error) {
+	query := `
+		SELECT p.gpa, p.gpa_scale, p.gre_verbal, p.gre_quant, p.gre_writing, p.toefl, p.ielts,
+			p.undergrad_school_id, p.undergrad_school, p.undergrad_major, p.graduation_year, p.country,
+			p.work_experience_months, p.publications, r.status, ` + cycleExpr + `
+		FROM user_to_results r
+		INNER JOIN applicant_profiles p ON p.user_id = r.user_id
+		WHERE ` + programFilter + `
+		AND r.status IN ('admitted', 'rejected')
+		AND r.user_id <> $5
+		ORDER BY r.announce_date DESC
+		LIMIT $6`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, program.SchoolID, program.School, program.MajorID, program.Major, excludeUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cases []*ProgramCase
+	for rows.Next() {
+		var c ProgramCase
+		p := &c.Profile
+		err := rows.Scan(
+			&p.GPA, &p.GPAScale, &p.GREVerbal, &p.GREQuant, &p.GREWriting, &p.TOEFL, &p.IELTS,
+			&p.UndergradSchoolID, &p.UndergradSchool, &p.UndergradMajor, &p.GraduationYear, &p.Country,
+			&p.WorkExperienceMonths, &p.Publications, &c.Status, &c.Cycle,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, &c)
+	}
+	return cases, rows.Err()
+}
+
+// GetProgramKeys returns the programs the user reported results for, as the keys
+// that PublicApplicant.Programs holds.
+func (m *ResultModel) GetProgramKeys(userID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT ` + programKeyExpr + `
+		FROM user_to_results r
+		WHERE r.user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		err := rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// A ProgramDecision is when a program announced a decision and when it was reported.
+type ProgramDecision struct {
+	AnnounceDate time.Time
+	ReportedAt   time.Time
+	Status       string
+}
+
+// GetProgramDecisions returns the admissions and rejections of the program in the
+// cycles since firstCycle, oldest first.
+func (m *ResultModel) GetProgramDecisions(program Program, firstCycle int) ([]*ProgramDecision, error) {
+	query := `
+		SELECT r.announce_date, r.reported_at, r.status
+		FROM user_to_results r
+		WHERE ` + programFilter + `
+		AND r.status IN ('admitted', 'rejected')
+		AND ` + cycleExpr + ` >= $5
+		ORDER BY r.announce_date`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, program.SchoolID, program.School, program.MajorID, program.Major, firstCycle)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []*ProgramDecision
+	for rows.Next() {
+		var d ProgramDecision
+		err := rows.Scan(&d.AnnounceDate, &d.ReportedAt, &d.Status)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, &d)
+	}
+	return decisions, rows.Err()
+}
+
+// A ProgramActivity counts the decisions of a program reported recently.
+type ProgramActivity struct {
+	Program
+	Admitted       int       `json:"admitted"`
+	Rejected       int       `json:"rejected"`
+	LatestReported time.Time `json:"latest_reported"`
+}
+
+// GetRecentActivity returns the programs with the most decisions of the cycle
+// reported since the time, at most limit of them.
+func (m *ResultModel) GetRecentActivity(since time.Time, cycle, limit int) ([]*ProgramActivity, error) {
+	query := `
+		SELECT (array_agg(r.school_id ORDER BY r.reported_at DESC))[1],
+			(array_agg(r.school_name ORDER BY r.reported_at DESC))[1],
+			(array_agg(r.major_id ORDER BY r.reported_at DESC))[1],
+			(array_agg(r.major_name ORDER BY r.reported_at DESC))[1],
+			count(*) FILTER (WHERE r.status = 'admitted'),
+			count(*) FILTER (WHERE r.status = 'rejected'),
+			max(r.reported_at)
+		FROM user_to_results r
+		WHERE r.reported_at >= $1
+		AND r.status IN ('admitted', 'rejected')
+		AND ` + cycleExpr + ` = $2
+		GROUP BY COALESCE(r.school_id::text, lower(r.school_name)), COALESCE(r.major_id::text, lower(r.major_name))
+		ORDER BY count(*) DESC, max(r.reported_at) DESC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, since, cycle, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []*ProgramActivity{}
+	for rows.Next() {
+		var a ProgramActivity
+		err := rows.Scan(&a.SchoolID, &a.School, &a.MajorID, &a.Major, &a.Admitted, &a.Rejected, &a.LatestReported)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, &a)
+	}
+	return activity, rows.Err()
+}
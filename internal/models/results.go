@@ -1,21 +1,30 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type ResultModel struct {
 	DB *sql.DB
 }
 
+// SchoolID and MajorID are set when the names of a result were found in the catalog,
+// in which case the names are the canonical ones.
 type Result struct {
-	UserID       string `json:"user_id"`
-	SchoolName   string `json:"school_name"`
-	MajorName    string `json:"major_name"`
-	AnnounceDate string `json:"announce_date"`
-	Status       string `json:"status"`
-	Others       string `json:"others"`
+	UserID       string     `json:"user_id"`
+	SchoolID     *uuid.UUID `json:"school_id,omitempty"`
+	SchoolName   string     `json:"school_name"`
+	MajorID      *uuid.UUID `json:"major_id,omitempty"`
+	MajorName    string     `json:"major_name"`
+	AnnounceDate string     `json:"announce_date"`
+	Status       string     `json:"status"`
+	Others       string     `json:"others"`
 }
 
 var (
@@ -31,20 +40,61 @@ func (m *ResultModel) Delete(userID string) error {
 	return err
 }
 
-func (m *ResultModel) Insert(userID string, schoolName string, majorName string, announceDate string, status string, others string) error {
+func (m *ResultModel) Insert(userID string, result Result) error {
 	// Insert only unique results
 	query := `
-		INSERT INTO user_to_results (user_id, school_name, major_name, announce_date, status, others)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO user_to_results (user_id, school_id, school_name, major_id, major_name, announce_date, status, others)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
-	_, err := m.DB.Exec(query, userID, schoolName, majorName, announceDate, status, others)
+	_, err := m.DB.Exec(query, userID, result.SchoolID, result.SchoolName, result.MajorID, result.MajorName, result.AnnounceDate, result.Status, result.Others)
 	return err
 }
 
+// Import saves results of a user in a single transaction. With replace, the results
+// the user had before are deleted first; otherwise a result for a school and major
+// the user already has a result for replaces that one.
+func (m *ResultModel) Import(ctx context.Context, userID string, results []Result, replace bool) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_to_results WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO user_to_results (user_id, school_id, school_name, major_id, major_name, announce_date, status, others)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, school_name, major_name) DO UPDATE SET
+			school_id = EXCLUDED.school_id,
+			major_id = EXCLUDED.major_id,
+			announce_date = EXCLUDED.announce_date,
+			status = EXCLUDED.status,
+			others = EXCLUDED.others`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, result := range results {
+		_, err = stmt.ExecContext(ctx, userID, result.SchoolID, result.SchoolName, result.MajorID, result.MajorName, result.AnnounceDate, result.Status, result.Others)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (m *ResultModel) Get(userID string) ([]Result, error) {
 	query := `
-		SELECT user_id, school_name, major_name, announce_date, status, others
+		SELECT COALESCE(user_id, ''), school_id, school_name, major_id, major_name, announce_date, status, others
 		FROM user_to_results
 		WHERE user_id = $1
 	`
@@ -58,7 +108,7 @@ func (m *ResultModel) Get(userID string) ([]Result, error) {
 	results := []Result{}
 	for rows.Next() {
 		var r Result
-		err = rows.Scan(&r.UserID, &r.SchoolName, &r.MajorName, &r.AnnounceDate, &r.Status, &r.Others)
+		err = rows.Scan(&r.UserID, &r.SchoolID, &r.SchoolName, &r.MajorID, &r.MajorName, &r.AnnounceDate, &r.Status, &r.Others)
 		if err != nil {
 			return nil, err
 		}
@@ -70,9 +120,38 @@ func (m *ResultModel) Get(userID string) ([]Result, error) {
 	return results, nil
 }
 
+// GetForUsers returns the results of the users, grouped by user.
+func (m *ResultModel) GetForUsers(userIDs []string) (map[string][]Result, error) {
+	query := `
+		SELECT user_id, school_id, school_name, major_id, major_name, announce_date, status, others
+		FROM user_to_results
+		WHERE user_id = ANY($1)
+		ORDER BY announce_date DESC, school_name, major_name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := map[string][]Result{}
+	for rows.Next() {
+		var r Result
+		err := rows.Scan(&r.UserID, &r.SchoolID, &r.SchoolName, &r.MajorID, &r.MajorName, &r.AnnounceDate, &r.Status, &r.Others)
+		if err != nil {
+			return nil, err
+		}
+		results[r.UserID] = append(results[r.UserID], r)
+	}
+	return results, rows.Err()
+}
+
 func (m *ResultModel) GetAll() ([]Result, error) {
 	query := `
-		SELECT user_id, school_name, major_name, announce_date, status, others
+		SELECT COALESCE(user_id, ''), school_id, school_name, major_id, major_name, announce_date, status, others
 		FROM user_to_results
 	`
 
@@ -86,7 +165,7 @@ func (m *ResultModel) GetAll() ([]Result, error) {
 	results := []Result{}
 	for rows.Next() {
 		var r Result
-		err = rows.Scan(&r.UserID, &r.SchoolName, &r.MajorName, &r.AnnounceDate, &r.Status, &r.Others)
+		err = rows.Scan(&r.UserID, &r.SchoolID, &r.SchoolName, &r.MajorID, &r.MajorName, &r.AnnounceDate, &r.Status, &r.Others)
 		if err != nil {
 			return nil, err
 		}
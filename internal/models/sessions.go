@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A Session is one logged-in device. Each session owns a family of refresh tokens,
+// of which only the most recent one can be exchanged.
+type Session struct {
+	ID         uuid.UUID `json:"session_id"`
+	UserID     string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// Create a SessionModel struct which wraps the connection pool.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+func (m SessionModel) Insert(session *Session) error {
+	query := `
+		INSERT INTO sessions (session_id, user_id, user_agent, ip)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, last_used_at`
+
+	args := []any{session.ID, session.UserID, session.UserAgent, session.IP}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&session.CreatedAt, &session.LastUsedAt)
+}
+
+// GetAllForUser returns the active sessions of a user, most recently used first. A
+// session is active while its latest refresh token is unused and unexpired.
+func (m SessionModel) GetAllForUser(userID string) ([]*Session, error) {
+	query := `
+		SELECT session_id, user_id, user_agent, ip, created_at, last_used_at
+		FROM sessions
+		WHERE user_id = $1
+		AND EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE refresh_tokens.family_id = sessions.session_id
+			AND refresh_tokens.used_at IS NULL
+			AND refresh_tokens.expires_at > NOW()
+		)
+		ORDER BY last_used_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Exists reports whether the session is still present, i.e. has not been revoked.
+func (m SessionModel) Exists(sessionID uuid.UUID, userID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE session_id = $1 AND user_id = $2
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, sessionID, userID).Scan(&exists)
+	return exists, err
+}
+
+// Touch records that a session was just used from the given client.
+func (m SessionModel) Touch(sessionID uuid.UUID, userAgent, ip string) error {
+	query := `
+		UPDATE sessions
+		SET user_agent = $1, ip = $2, last_used_at = NOW()
+		WHERE session_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userAgent, ip, sessionID)
+	return err
+}
+
+// Delete revokes a single session of a user, together with its refresh tokens.
+func (m SessionModel) Delete(sessionID uuid.UUID, userID string) error {
+	query := `
+		DELETE FROM sessions
+		WHERE session_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllForUser revokes every session of a user.
+func (m SessionModel) DeleteAllForUser(userID string) error {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// DeleteOthersForUser revokes every session of a user except the given one, e.g.
+// after the password was changed from that session.
+func (m SessionModel) DeleteOthersForUser(userID string, keep uuid.UUID) error {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND session_id <> $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, keep)
+	return err
+}
+
+// DeleteExpired deletes the sessions created before createdBefore that have no refresh
+// tokens left, as nobody can use them any more.
+func (m SessionModel) DeleteExpired(createdBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE created_at < $1
+		AND NOT EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE refresh_tokens.family_id = sessions.session_id
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StepUp records that the user of the session just confirmed their identity again.
+func (m SessionModel) StepUp(sessionID uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET stepped_up_at = NOW()
+		WHERE session_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, sessionID)
+	return err
+}
+
+// AuthenticatedSince reports whether the user of the session logged in or stepped up
+// after since.
+func (m SessionModel) AuthenticatedSince(sessionID uuid.UUID, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE session_id = $1
+			AND GREATEST(created_at, COALESCE(stepped_up_at, created_at)) > $2
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var authenticated bool
+	err := m.DB.QueryRowContext(ctx, query, sessionID, since).Scan(&authenticated)
+	return authenticated, err
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Stats counts the main records in the database, for operators.
+type Stats struct {
+	Users           int64 `json:"users"`
+	ActivatedUsers  int64 `json:"activated_users"`
+	PendingDeletion int64 `json:"pending_deletion"`
+	ActiveSessions  int64 `json:"active_sessions"`
+	Posts           int64 `json:"posts"`
+	Results         int64 `json:"results"`
+	Schools         int64 `json:"schools"`
+	Majors          int64 `json:"majors"`
+}
+
+// Create a StatsModel struct which wraps the connection pool.
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// Get counts everything in a single query, so that the numbers are consistent with
+// each other.
+func (m StatsModel) Get() (*Stats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE activated = true),
+			(SELECT COUNT(*) FROM users WHERE deletion_scheduled_at IS NOT NULL),
+			(SELECT COUNT(DISTINCT family_id) FROM refresh_tokens WHERE used_at IS NULL AND expires_at > NOW()),
+			(SELECT COUNT(*) FROM posts),
+			(SELECT COUNT(*) FROM user_to_results),
+			(SELECT COUNT(*) FROM schools),
+			(SELECT COUNT(*) FROM majors)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var stats Stats
+	err := m.DB.QueryRowContext(ctx, query).Scan(
+		&stats.Users, &stats.ActivatedUsers, &stats.PendingDeletion, &stats.ActiveSessions,
+		&stats.Posts, &stats.Results, &stats.Schools, &stats.Majors,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
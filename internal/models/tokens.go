@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/base32"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/pascaldekloe/jwt"
+	"offerland.cc/internal/jwtauth"
 )
 
 // Define a Token struct to hold the data for an individual token. This includes the
@@ -33,84 +36,138 @@ type JWTToken struct {
 	TTL   time.Duration `json:"ttl"`
 }
 
-// Generate new token pair
-func (m *TokenModel) NewTokenPair(userID uuid.UUID, accessTokenSecret string, accessTokenTTL string, refreshTokenSecret string, refreshTokenTTL string) (*JWTToken, *JWTToken, error) {
-	// Generate access token
-	accessTokenTTLDuration, err := time.ParseDuration(accessTokenTTL)
+// Define a custom ErrRefreshTokenReused error. It is returned when a refresh token
+// that has already been exchanged is presented again, which means it has most likely
+// been stolen.
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Define a custom ErrTokenExhausted error, returned when the last allowed attempt at
+// a token's passcode failed and the token has been deleted.
+var (
+	ErrTokenExhausted = errors.New("token exhausted")
+)
+
+// queryExecer is satisfied by both *sql.DB and *sql.Tx.
+type queryExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// NewTokenPair issues an access token and a refresh token for the user. Every
+// refresh token belongs to a family, which is the session it was issued for: logging
+// in starts a new session, and each rotation issues the next token of the same
+// session. Only the SHA-256 hash of the refresh token is stored.
+func (m TokenModel) NewTokenPair(userID string, familyID uuid.UUID, accessTokens, refreshTokens *jwtauth.Issuer) (*JWTToken, *JWTToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.newTokenPair(ctx, m.DB, userID, familyID, accessTokens, refreshTokens)
+}
+
+func (m TokenModel) newTokenPair(ctx context.Context, db queryExecer, userID string, familyID uuid.UUID, accessTokens, refreshTokens *jwtauth.Issuer) (*JWTToken, *JWTToken, error) {
+	accessToken, err := accessTokens.Issue(userID, map[string]any{"sid": familyID.String()})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	accessToken, err := NewJWT(userID, accessTokenTTLDuration, accessTokenSecret)
+	refreshToken, err := refreshTokens.Issue(userID, map[string]any{"fam": familyID.String()})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Generate refresh token
-	refreshTokenTTLDuration, err := time.ParseDuration(refreshTokenTTL)
+	query := `
+		INSERT INTO refresh_tokens (hash, token_id, family_id, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	tokenHash := sha256.Sum256([]byte(refreshToken.Token))
+	args := []any{tokenHash[:], refreshToken.ID, familyID, userID, time.Now(), refreshToken.Expiry}
+	_, err = db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	refreshToken, err := NewJWT(userID, refreshTokenTTLDuration, refreshTokenSecret)
+	// Return the tokens.
+	return &JWTToken{Token: accessToken.Token, TTL: accessToken.TTL},
+		&JWTToken{Token: refreshToken.Token, TTL: refreshToken.TTL},
+		nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair of the same
+// family. Each refresh token can be exchanged exactly once: presenting a token that
+// was already used deletes its whole session and returns ErrRefreshTokenReused.
+// Unknown and expired tokens return ErrRecordNotFound.
+func (m TokenModel) RotateRefreshToken(refreshToken string, accessTokens, refreshTokens *jwtauth.Issuer) (*JWTToken, *JWTToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer tx.Rollback()
 
-	m.DeleteRefreshTokenByUserID(userID)
-	m.InsertRefreshToken(refreshToken, userID)
+	query := `
+		SELECT user_id, family_id, expires_at, used_at
+		FROM refresh_tokens
+		WHERE hash = $1
+		FOR UPDATE`
 
-	// Return the tokens.
-	return accessToken, refreshToken, nil
-}
+	tokenHash := sha256.Sum256([]byte(refreshToken))
 
-func (m *TokenModel) InsertRefreshToken(refreshToken *JWTToken, userID uuid.UUID) error {
-	query := `
-		INSERT INTO refresh_tokens (token, user_id, created_at, expires_at)
-		VALUES ($1, $2, $3, $4)
-	`
-	_, err := m.DB.Exec(query, refreshToken.Token, userID, time.Now(), time.Now().Add(refreshToken.TTL))
+	var userID string
+	var familyID uuid.UUID
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+
+	err = tx.QueryRowContext(ctx, query, tokenHash[:]).Scan(&userID, &familyID, &expiresAt, &usedAt)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
 	}
-	return nil
-}
 
-func (m *TokenModel) GetUserIDByRefreshToken(refreshToken string) (uuid.UUID, error) {
-	query := `
-		SELECT user_id FROM refresh_tokens
-		WHERE token = $1
-	`
-	var userID uuid.UUID
-	err := m.DB.QueryRow(query, refreshToken).Scan(&userID)
+	if expiresAt.Before(time.Now()) {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	if usedAt.Valid {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM sessions
+			WHERE session_id = $1`, familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE hash = $1`, tokenHash[:])
 	if err != nil {
-		return uuid.Nil, err
+		return nil, nil, err
 	}
-	return userID, nil
-}
 
-func (m *TokenModel) DeleteRefreshToken(refreshToken string) error {
-	query := `
-		DELETE FROM refresh_tokens
-		WHERE token = $1
-	`
-	_, err := m.DB.Exec(query, refreshToken)
+	accessToken, newRefreshToken, err := m.newTokenPair(ctx, tx, userID, familyID, accessTokens, refreshTokens)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	return nil
-}
 
-func (m *TokenModel) DeleteRefreshTokenByUserID(userID uuid.UUID) error {
-	query := `
-		DELETE FROM refresh_tokens
-		WHERE user_id = $1
-	`
-	_, err := m.DB.Exec(query, userID)
+	err = tx.Commit()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	return nil
+
+	return accessToken, newRefreshToken, nil
 }
 
 func generateToken(userID string, ttl time.Duration) (*Token, error) {
@@ -149,44 +206,23 @@ func generateToken(userID string, ttl time.Duration) (*Token, error) {
 	return token, nil
 }
 
-func NewJWT(userID uuid.UUID, ttl time.Duration, secret string) (*JWTToken, error) {
-	var claims jwt.Claims
-	claims.Subject = userID.String()
-
-	expiry := time.Now().Add(ttl)
-	claims.Issued = jwt.NewNumericTime(time.Now())
-	claims.NotBefore = jwt.NewNumericTime(time.Now())
-	claims.Expires = jwt.NewNumericTime(expiry)
-
-	claims.Issuer = "offerland.cc"
-	claims.Audiences = []string{"offerland.cc"}
-
-	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(secret))
-	if err != nil {
-		return nil, err
-	}
-
-	jwtToken := &JWTToken{
-		Token: string(jwtBytes),
-		TTL:   ttl,
-	}
-
-	return jwtToken, nil
-}
-
 func (m TokenModel) generatePasscode() (string, error) {
 	const otpChars = "1234567890"
-	var length = 6
+	return generateCode(otpChars, 6)
+}
 
+// generateCode returns length random characters from chars. len(chars) should
+// divide 256, otherwise some characters are more likely than others.
+func generateCode(chars string, length int) (string, error) {
 	buffer := make([]byte, length)
 	_, err := rand.Read(buffer)
 	if err != nil {
 		return "", err
 	}
 
-	otpCharsLength := len(otpChars)
+	charsLength := len(chars)
 	for i := 0; i < length; i++ {
-		buffer[i] = otpChars[int(buffer[i])%otpCharsLength]
+		buffer[i] = chars[int(buffer[i])%charsLength]
 	}
 
 	return string(buffer), nil
@@ -220,20 +256,26 @@ func (m TokenModel) NewResetToken(userID string, ttl time.Duration) (*Token, err
 	return token, err
 }
 
-func (m TokenModel) Validate(passcode string, tokenPlaintext string) (bool, error) {
+// Validate checks the passcode of an activation token. Every call counts as an
+// attempt, and once maxAttempts have been made the token is deleted, so that the
+// passcode cannot be guessed within the lifetime of the token.
+func (m TokenModel) Validate(passcode string, tokenPlaintext string, maxAttempts int) (bool, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
-		SELECT passcode
-		FROM activation_tokens
+		UPDATE activation_tokens
+		SET attempts = attempts + 1
 		WHERE activation_tokens.hash = $1
-		AND activation_tokens.expiry > $2`
+		AND activation_tokens.expiry > $2
+		AND activation_tokens.attempts < $3
+		RETURNING passcode, attempts`
 
-	args := []any{tokenHash[:], time.Now()}
+	args := []any{tokenHash[:], time.Now(), maxAttempts}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	row := m.DB.QueryRowContext(ctx, query, args...)
 	var storedPasscode string
-	err := row.Scan(&storedPasscode)
+	var attempts int
+	err := row.Scan(&storedPasscode, &attempts)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
@@ -241,7 +283,18 @@ func (m TokenModel) Validate(passcode string, tokenPlaintext string) (bool, erro
 		return false, err
 	}
 
-	return storedPasscode == passcode, nil
+	if subtle.ConstantTimeCompare([]byte(storedPasscode), []byte(passcode)) == 1 {
+		return true, nil
+	}
+
+	if attempts >= maxAttempts {
+		_, err = m.DB.ExecContext(ctx, `DELETE FROM activation_tokens WHERE hash = $1`, tokenHash[:])
+		if err != nil {
+			return false, err
+		}
+		return false, ErrTokenExhausted
+	}
+	return false, nil
 }
 
 // Insert() adds the data for a specific token to the tokens table.
@@ -289,3 +342,270 @@ func (m TokenModel) DeleteResetTokensForUser(userID string) error {
 	_, err := m.DB.ExecContext(ctx, query, userID)
 	return err
 }
+
+// NewTwoFactorToken issues the token that carries a login from the password check to
+// the second factor.
+func (m TokenModel) NewTwoFactorToken(userID string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO two_factor_tokens (hash, user_id, expiry) VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry)
+	return token, err
+}
+
+// GetTwoFactorToken returns the user a two-factor token was issued to. The token is
+// counted as one attempt; after maxAttempts it stops working.
+func (m TokenModel) GetTwoFactorToken(tokenPlaintext string, maxAttempts int) (string, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		UPDATE two_factor_tokens
+		SET attempts = attempts + 1
+		WHERE hash = $1 AND expiry > $2 AND attempts < $3
+		RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID string
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now(), maxAttempts).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return userID, nil
+}
+
+func (m TokenModel) DeleteTwoFactorToken(tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		DELETE FROM two_factor_tokens
+		WHERE hash = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:])
+	return err
+}
+
+// NewRememberedDevice issues a token that lets the device skip the second factor on
+// later logins of the same user.
+func (m TokenModel) NewRememberedDevice(userID string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO remembered_devices (hash, user_id, expiry) VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry)
+	return token, err
+}
+
+func (m TokenModel) IsRememberedDevice(userID string, tokenPlaintext string) (bool, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM remembered_devices
+			WHERE hash = $1 AND user_id = $2 AND expiry > $3
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var remembered bool
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], userID, time.Now()).Scan(&remembered)
+	return remembered, err
+}
+
+// NewLoginToken issues a token and passcode for signing in without a password. Any
+// earlier login tokens of the user stop working.
+func (m TokenModel) NewLoginToken(userID string, ttl time.Duration) (*Token, error) {
+	passcode, err := m.generatePasscode()
+	if err != nil {
+		return nil, err
+	}
+	token, err := generateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	token.Passcode = passcode
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO login_tokens (hash, user_id, passcode, expiry) VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, passcode, token.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, tx.Commit()
+}
+
+// ConsumeLoginToken returns the user a login token was issued to if passcode
+// matches, and deletes the token so that it cannot be used again. Every call counts
+// as an attempt; after maxAttempts the token stops working.
+func (m TokenModel) ConsumeLoginToken(tokenPlaintext, passcode string, maxAttempts int) (string, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		UPDATE login_tokens
+		SET attempts = attempts + 1
+		WHERE hash = $1 AND expiry > $2 AND attempts < $3
+		RETURNING user_id, passcode`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID, storedPasscode string
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now(), maxAttempts).Scan(&userID, &storedPasscode)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(storedPasscode), []byte(passcode)) != 1 {
+		return "", ErrRecordNotFound
+	}
+
+	// Only the request that deletes the token gets to use it.
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM login_tokens WHERE hash = $1`, tokenHash[:])
+	if err != nil {
+		return "", err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rowsAffected == 0 {
+		return "", ErrRecordNotFound
+	}
+	return userID, nil
+}
+
+// NewEmailChangeToken issues the token that confirms newEmail belongs to the user.
+// Any earlier pending change of the user is cancelled.
+func (m TokenModel) NewEmailChangeToken(userID, newEmail string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_change_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO email_change_tokens (hash, user_id, new_email, expiry) VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, newEmail, token.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, tx.Commit()
+}
+
+// ConsumeEmailChangeToken deletes an unexpired email change token and returns the
+// user and the new address it was issued for.
+func (m TokenModel) ConsumeEmailChangeToken(tokenPlaintext string) (string, string, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		DELETE FROM email_change_tokens
+		WHERE hash = $1 AND expiry > $2
+		RETURNING user_id, new_email`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID, newEmail string
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(&userID, &newEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", "", ErrRecordNotFound
+		default:
+			return "", "", err
+		}
+	}
+	return userID, newEmail, nil
+}
+
+// expiringTables lists the tables of short-lived tokens and states, with the column
+// that holds their expiry.
+var expiringTables = []struct {
+	table  string
+	column string
+}{
+	{"activation_tokens", "expiry"},
+	{"reset_tokens", "expiry"},
+	{"refresh_tokens", "expires_at"},
+	{"two_factor_tokens", "expiry"},
+	{"remembered_devices", "expiry"},
+	{"login_tokens", "expiry"},
+	{"email_change_tokens", "expiry"},
+	{"oidc_states", "expiry"},
+}
+
+// DeleteExpired deletes every token that expired before expiredBefore and returns
+// how many were deleted from each table.
+func (m TokenModel) DeleteExpired(expiredBefore time.Time) (map[string]int64, error) {
+	deleted := map[string]int64{}
+	for _, t := range expiringTables {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE %s < $1`, t.table, t.column)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		result, err := m.DB.ExecContext(ctx, query, expiredBefore)
+		cancel()
+		if err != nil {
+			return deleted, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted[t.table] = rows
+	}
+	return deleted, nil
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TOTP is the authenticator app secret of a user. Two-factor authentication is only
+// enabled once the user has confirmed the secret with a valid code.
+type TOTP struct {
+	UserID       string
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// Define a custom ErrTwoFactorEnabled error, returned when enrolling a user that has
+// already confirmed an authenticator app.
+var (
+	ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+)
+
+// Recovery codes are ten characters from an alphabet without look-alikes, shown to
+// the user as "xxxxx-xxxxx".
+const (
+	recoveryCodeChars  = "abcdefghijkmnpqrstuvwxyz23456789"
+	recoveryCodeLength = 10
+)
+
+// Create a TwoFactorModel struct which wraps the connection pool.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+func (m TwoFactorModel) GetTOTP(userID string) (*TOTP, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step
+		FROM user_totp
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var totp TOTP
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// IsEnabled reports whether the user has confirmed an authenticator app.
+func (m TwoFactorModel) IsEnabled(userID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_totp
+			WHERE user_id = $1 AND confirmed_at IS NOT NULL
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var enabled bool
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// SetPendingTOTP stores a new, unconfirmed secret for the user, replacing any earlier
+// unconfirmed one. It returns ErrTwoFactorEnabled if the user already has a
+// confirmed secret.
+func (m TwoFactorModel) SetPendingTOTP(userID, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// UseStep records that the code of the given time step was used, and reports false
+// if that step or a later one had already been used. Confirming a pending secret
+// this way enables two-factor authentication.
+func (m TwoFactorModel) UseStep(userID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $1, confirmed_at = COALESCE(confirmed_at, NOW())
+		WHERE user_id = $2 AND last_used_step < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Disable removes the user's secret, recovery codes and remembered devices.
+func (m TwoFactorModel) Disable(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM remembered_devices WHERE user_id = $1`,
+	} {
+		_, err = tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// NewRecoveryCodes replaces the user's recovery codes with n new ones and returns
+// them in plaintext. Only their SHA-256 hashes are stored.
+func (m TwoFactorModel) NewRecoveryCodes(userID string, n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		code, err := generateCode(recoveryCodeChars, recoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		codeHash := hashRecoveryCode(code)
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, codeHash[:], userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+// UseRecoveryCode marks a recovery code of the user as used, and reports false if it
+// does not exist or was used before.
+func (m TwoFactorModel) UseRecoveryCode(userID, code string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE hash = $1 AND user_id = $2 AND used_at IS NULL`
+
+	codeHash := hashRecoveryCode(code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, codeHash[:], userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// hashRecoveryCode hashes a recovery code regardless of case, spaces and dashes, so
+// that codes typed in by hand still match.
+func hashRecoveryCode(code string) [32]byte {
+	normalized := strings.ToLower(code)
+	normalized = strings.NewReplacer("-", "", " ", "").Replace(normalized)
+	return sha256.Sum256([]byte(normalized))
+}
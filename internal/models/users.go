@@ -24,7 +24,13 @@ type User struct {
 	ISS       string    `json:"-"`
 	SUB       string    `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"preferred_locale"`
 	Version   int       `json:"-"`
+	// DeletionScheduledAt is set while the account waits out the grace period
+	// after the user asked for it to be deleted.
+	DeletionScheduledAt *time.Time `json:"-"`
+	// DisabledAt is set while an administrator keeps the account from signing in.
+	DisabledAt *time.Time `json:"-"`
 }
 
 // Check if a User instance is the AnonymousUser.
@@ -47,22 +53,27 @@ type UserModel struct {
 // RETURNING clause to read them into the User struct after the insert, in the same way
 // that we did when creating a movie.
 func (m UserModel) Insert(user *User) error {
+	// Users created without a known locale get the column default.
+	if user.Locale == "" {
+		user.Locale = "en"
+	}
+
 	var query string
 	var args []any
 	switch {
 	case user.SUB == "":
 		query = `
-		INSERT INTO users (user_id, username, email, password, activated)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (user_id, username, email, password, activated, preferred_locale)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING user_id, created_at, version`
-		args = []any{user.ID, user.Username, user.Email, user.Password, user.Activated}
+		args = []any{user.ID, user.Username, user.Email, user.Password, user.Activated, user.Locale}
 
 	case user.SUB != "":
 		query = `
-		INSERT INTO users (user_id, username, email, iss, sub, activated)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (user_id, username, email, iss, sub, activated, preferred_locale)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING user_id, created_at, version`
-		args = []any{user.ID, user.Username, user.Email, user.ISS, user.SUB, user.Activated}
+		args = []any{user.ID, user.Username, user.Email, user.ISS, user.SUB, user.Activated, user.Locale}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -85,7 +96,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) Get(user_id string) (*User, error) {
 	query := `
-		SELECT user_id, created_at, username, email, COALESCE(password, ''), activated, version
+		SELECT user_id, created_at, username, email, COALESCE(password, ''), activated, preferred_locale, deletion_scheduled_at, disabled_at, version
 		FROM users 
 		WHERE user_id = $1`
 
@@ -101,6 +112,9 @@ func (m UserModel) Get(user_id string) (*User, error) {
 		&user.Email,
 		&user.Password,
 		&user.Activated,
+		&user.Locale,
+		&user.DeletionScheduledAt,
+		&user.DisabledAt,
 		&user.Version,
 	)
 
@@ -130,12 +144,161 @@ func (m UserModel) Delete(user_id string) error {
 	return nil
 }
 
+// Purge deletes the account for good. Its posts and results outlive it without
+// saying whose they were, so the free text in them, which may well say, is cleared
+// first, along with the addresses, user agents and email addresses in its audit log
+// entries.
+func (m UserModel) Purge(userID string) error {
+	queries := []string{
+		`UPDATE posts SET body = '' WHERE user_id = $1`,
+		`UPDATE user_to_results SET others = '' WHERE user_id = $1`,
+		`UPDATE audit_log
+		SET ip = '', user_agent = '', metadata = metadata - 'email' - 'old_email' - 'new_email'
+		WHERE user_id = $1`,
+		`DELETE FROM users WHERE user_id = $1`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteUnactivated deletes the accounts created before createdBefore that were never
+// activated, and returns how many there were.
+func (m UserModel) DeleteUnactivated(createdBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE activated = false AND created_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ScheduleDeletion marks the account for deletion at the given time. Until then the
+// deletion can be cancelled with CancelDeletion.
+func (m UserModel) ScheduleDeletion(userID string, at time.Time) error {
+	query := `
+		UPDATE users
+		SET deletion_scheduled_at = $1, version = version + 1
+		WHERE user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, at, userID)
+	return err
+}
+
+// CancelDeletion clears a scheduled deletion and reports whether there was one.
+func (m UserModel) CancelDeletion(userID string) (bool, error) {
+	query := `
+		UPDATE users
+		SET deletion_scheduled_at = NULL, version = version + 1
+		WHERE user_id = $1 AND deletion_scheduled_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Disable keeps the account from signing in until Enable is called, without touching
+// whether it was activated, and reports whether it was enabled before.
+func (m UserModel) Disable(userID string) (bool, error) {
+	query := `
+		UPDATE users
+		SET disabled_at = NOW(), version = version + 1
+		WHERE user_id = $1 AND disabled_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Enable lets a disabled account sign in again and reports whether it was disabled.
+func (m UserModel) Enable(userID string) (bool, error) {
+	query := `
+		UPDATE users
+		SET disabled_at = NULL, version = version + 1
+		WHERE user_id = $1 AND disabled_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// GetDueForDeletion returns the IDs of the accounts whose grace period has passed.
+func (m UserModel) GetDueForDeletion(limit int) ([]string, error) {
+	query := `
+		SELECT user_id
+		FROM users
+		WHERE deletion_scheduled_at <= $1
+		ORDER BY deletion_scheduled_at
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		err := rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
 // Retrieve the User details from the database based on the user's email address.
 // Because we have a UNIQUE constraint on the email column, this SQL query will only
 // return one record (or none at all, in which case we return a ErrRecordNotFound error).
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT user_id, created_at, username, email, COALESCE(password, ''), activated, version
+		SELECT user_id, created_at, username, email, COALESCE(password, ''), activated, preferred_locale, deletion_scheduled_at, disabled_at, version
 		FROM users
 		WHERE email = $1`
 
@@ -143,7 +306,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Version,
+		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Locale, &user.DeletionScheduledAt, &user.DisabledAt, &user.Version,
 	)
 	if err != nil {
 		switch {
@@ -155,17 +318,20 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	}
 	return &user, nil
 }
+
+// GetByUsername returns the activated user with the username. Accounts that were
+// never activated are not visible to other users, and are left for the cleanup job.
 func (m UserModel) GetByUsername(username string) (*User, error) {
 	query := `
-		SELECT user_id, created_at, username, email, COALESCE(password, ''), activated, version
+		SELECT user_id, created_at, username, email, COALESCE(password, ''), activated, preferred_locale, deletion_scheduled_at, disabled_at, version
 		FROM users
-		WHERE username = $1`
+		WHERE username = $1 AND activated = true`
 
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, username).Scan(
-		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Version,
+		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Locale, &user.DeletionScheduledAt, &user.DisabledAt, &user.Version,
 	)
 	if err != nil {
 		switch {
@@ -176,14 +342,23 @@ func (m UserModel) GetByUsername(username string) (*User, error) {
 		}
 	}
 
-	if !user.Activated {
-		m.Delete(user.ID)
-		return nil, ErrRecordNotFound
-	}
-
 	return &user, nil
 }
 
+// UsernameTaken reports whether any account uses the username, including accounts
+// that still wait to be activated.
+func (m UserModel) UsernameTaken(username string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var taken bool
+	err := m.DB.QueryRowContext(ctx, query, username).Scan(&taken)
+	return taken, err
+}
+
 // Update the details for a specific user. Notice that we check against the version
 // field to help prevent any race conditions during the request cycle, just like we did
 // when updating a movie. And we also check for a violation of the "users_email_key"
@@ -191,12 +366,12 @@ func (m UserModel) GetByUsername(username string) (*User, error) {
 // record originally.
 func (m UserModel) Update(user *User) error {
 	query := ` UPDATE users
-		SET username = $1, email = $2, password = $3, activated = $4, version = version + 1
-		WHERE user_id = $5 AND version = $6
+		SET username = $1, email = $2, password = $3, activated = $4, preferred_locale = $5, version = version + 1
+		WHERE user_id = $6 AND version = $7
 		RETURNING version`
 
 	args := []any{
-		user.Username, user.Email, user.Password, user.Activated, user.ID, user.Version,
+		user.Username, user.Email, user.Password, user.Activated, user.Locale, user.ID, user.Version,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -214,13 +389,57 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// ChangeEmail sets a new, verified email address for the user. Only activated
+// accounts hold on to their address: an account that was never activated with the
+// same email is deleted, as whoever verified the address is its owner.
+func (m UserModel) ChangeEmail(user *User, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM users
+		WHERE email = $1 AND activated = false AND user_id <> $2`
+
+	_, err = tx.ExecContext(ctx, query, email, user.ID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE users
+		SET email = $1, version = version + 1
+		WHERE user_id = $2 AND version = $3
+		RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, email, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	user.Email = email
+
+	return tx.Commit()
+}
+
 func (m UserModel) GetForActivationToken(tokenPlaintext string) (*User, error) {
 	// Calculate the SHA-256 hash of the plaintext token provided by the client.
 	// Remember that this returns a byte *array* with length 32, not a slice.
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Set up the SQL query.
 	query := `
-		SELECT users.user_id, users.created_at, users.username, users.email, COALESCE(users.password, ''), users.activated, users.version 
+		SELECT users.user_id, users.created_at, users.username, users.email, COALESCE(users.password, ''), users.activated, users.preferred_locale, users.deletion_scheduled_at, users.disabled_at, users.version 
 		FROM users
 		INNER JOIN activation_tokens
 		ON users.user_id = activation_tokens.user_id
@@ -238,7 +457,7 @@ func (m UserModel) GetForActivationToken(tokenPlaintext string) (*User, error) {
 	// Execute the query, scanning the return values into a User struct. If no matching
 	// record is found we return an ErrRecordNotFound error.
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
-		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Version,
+		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Locale, &user.DeletionScheduledAt, &user.DisabledAt, &user.Version,
 	)
 	if err != nil {
 		switch {
@@ -258,7 +477,7 @@ func (m UserModel) GetForResetToken(tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Set up the SQL query.
 	query := `
-		SELECT users.user_id, users.created_at, users.username, users.email, COALESCE(users.password, ''), users.activated, users.version 
+		SELECT users.user_id, users.created_at, users.username, users.email, COALESCE(users.password, ''), users.activated, users.preferred_locale, users.deletion_scheduled_at, users.disabled_at, users.version 
 		FROM users
 		INNER JOIN reset_tokens
 		ON users.user_id = reset_tokens.user_id
@@ -276,7 +495,7 @@ func (m UserModel) GetForResetToken(tokenPlaintext string) (*User, error) {
 	// Execute the query, scanning the return values into a User struct. If no matching
 	// record is found we return an ErrRecordNotFound error.
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
-		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Version,
+		&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password, &user.Activated, &user.Locale, &user.DeletionScheduledAt, &user.DisabledAt, &user.Version,
 	)
 	if err != nil {
 		switch {
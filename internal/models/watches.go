@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateWatch = errors.New("duplicate watch")
+)
+
+// A Watch is a program a user wants to hear about when the first decision of a cycle
+// is reported. NotifiedCycle is the last cycle they were told about.
+type Watch struct {
+	ID int64 `json:"id"`
+	Program
+	NotifiedCycle *int      `json:"notified_cycle"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// A WatchNotice is a watch that is due a notification, with the first decision of
+// the cycle and who to send it to.
+type WatchNotice struct {
+	WatchID      int64
+	Email        string
+	Username     string
+	Locale       string
+	Program      Program
+	Status       string
+	AnnounceDate time.Time
+}
+
+// watchFilter matches the results r of the program of watch w.
+const watchFilter = `
+	(CASE WHEN w.school_id IS NULL THEN lower(r.school_name) = lower(w.school_name) ELSE r.school_id = w.school_id END)
+	AND (CASE WHEN w.major_id IS NULL THEN lower(r.major_name) = lower(w.major_name) ELSE r.major_id = w.major_id END)`
+
+// Create a WatchModel struct which wraps the connection pool.
+type WatchModel struct {
+	DB *sql.DB
+}
+
+// Insert watches the program for the user. When a decision of the cycle was already
+// reported, the watch counts as notified for it, since there is no first decision
+// left to tell about.
+func (m WatchModel) Insert(userID string, program Program, cycle int) (*Watch, error) {
+	query := `
+		INSERT INTO program_watches (user_id, school_id, school_name, major_id, major_name, notified_cycle)
+		SELECT $5, $1::uuid, $2::text, $3::uuid, $4::text,
+			CASE WHEN EXISTS (
+				SELECT 1 FROM user_to_results r
+				WHERE ` + programFilter + `
+				AND r.status IN ('admitted', 'rejected')
+				AND ` + cycleExpr + ` = $6
+			) THEN $6::int END
+		ON CONFLICT (user_id, school_name, major_name) DO NOTHING
+		RETURNING watch_id, notified_cycle, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Watches do not keep the degree, so that they read the same as when listed.
+	program.Degree = ""
+	watch := &Watch{Program: program}
+	err := m.DB.QueryRowContext(ctx, query, program.SchoolID, program.School, program.MajorID, program.Major, userID, cycle).Scan(
+		&watch.ID, &watch.NotifiedCycle, &watch.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrDuplicateWatch
+		default:
+			return nil, err
+		}
+	}
+	return watch, nil
+}
+
+// GetForUser returns the watches of the user, newest first.
+func (m WatchModel) GetForUser(userID string) ([]*Watch, error) {
+	query := `
+		SELECT watch_id, school_id, school_name, major_id, major_name, notified_cycle, created_at
+		FROM program_watches
+		WHERE user_id = $1
+		ORDER BY created_at DESC, watch_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []*Watch{}
+	for rows.Next() {
+		var w Watch
+		err := rows.Scan(&w.ID, &w.SchoolID, &w.School, &w.MajorID, &w.Major, &w.NotifiedCycle, &w.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		watches = append(watches, &w)
+	}
+	return watches, rows.Err()
+}
+
+func (m WatchModel) Delete(watchID int64, userID string) error {
+	query := `
+		DELETE FROM program_watches
+		WHERE watch_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, watchID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetDue returns up to limit watches of activated, enabled users that were not
+// notified about the cycle yet, and whose program has a decision of the cycle
+// reported, along with the first reported one.
+func (m WatchModel) GetDue(cycle, limit int) ([]*WatchNotice, error) {
+	query := `
+		SELECT w.watch_id, u.email, u.username, u.preferred_locale,
+			w.school_id, w.school_name, w.major_id, w.major_name,
+			first.status, first.announce_date
+		FROM program_watches w
+		INNER JOIN users u ON u.user_id = w.user_id
+		INNER JOIN LATERAL (
+			SELECT r.status, r.announce_date
+			FROM user_to_results r
+			WHERE ` + watchFilter + `
+			AND r.status IN ('admitted', 'rejected')
+			AND ` + cycleExpr + ` = $1
+			ORDER BY r.reported_at, r.announce_date
+			LIMIT 1
+		) first ON true
+		WHERE (w.notified_cycle IS NULL OR w.notified_cycle < $1)
+		AND u.activated AND u.disabled_at IS NULL
+		ORDER BY w.watch_id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, cycle, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notices []*WatchNotice
+	for rows.Next() {
+		var n WatchNotice
+		err := rows.Scan(
+			&n.WatchID, &n.Email, &n.Username, &n.Locale,
+			&n.Program.SchoolID, &n.Program.School, &n.Program.MajorID, &n.Program.Major,
+			&n.Status, &n.AnnounceDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, &n)
+	}
+	return notices, rows.Err()
+}
+
+// MarkNotified records that the user of the watch was told about the cycle.
+func (m WatchModel) MarkNotified(watchID int64, cycle int) error {
+	query := `
+		UPDATE program_watches
+		SET notified_cycle = $2
+		WHERE watch_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, watchID, cycle)
+	return err
+}
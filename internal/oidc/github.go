@@ -0,0 +1,59 @@
+package oidc
+
+import (
+	"context"
+	"strconv"
+
+	"golang.org/x/oauth2"
+)
+
+// githubClaims reads the user's profile from the GitHub API, as GitHub issues no ID
+// tokens. The primary email is looked up separately when the profile hides it.
+func (p *Provider) githubClaims(ctx context.Context, token *oauth2.Token) (*Claims, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+
+	err := p.getJSON(ctx, p.config.UserInfoURL, token.AccessToken, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    user.Name,
+		Picture: user.AvatarURL,
+	}
+	if claims.Name == "" {
+		claims.Name = user.Login
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+
+	err = p.getJSON(ctx, p.config.UserInfoURL+"/emails", token.AccessToken, &emails)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			claims.Email = email.Email
+			claims.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	if claims.Email == "" {
+		return nil, ErrNoEmail
+	}
+
+	return claims, nil
+}
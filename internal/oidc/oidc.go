@@ -0,0 +1,414 @@
+// Package oidc implements the OAuth 2.0 authorization-code flow with PKCE against
+// OpenID Connect providers (Google, Microsoft, Apple, ...) and against GitHub, which
+// speaks plain OAuth 2.0. ID tokens are verified with the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	KindOIDC   = "oidc"
+	KindGitHub = "github"
+)
+
+var (
+	ErrUnknownProvider = errors.New("oidc: unknown provider")
+	ErrInvalidIDToken  = errors.New("oidc: invalid ID token")
+	ErrNoEmail         = errors.New("oidc: provider did not return an email address")
+)
+
+// ProviderConfig describes one login provider. For OpenID Connect providers only
+// Issuer is needed: the endpoints are read from the issuer's discovery document
+// unless they are set explicitly.
+type ProviderConfig struct {
+	Name         string
+	Kind         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+
+	// ResponseMode is sent as response_mode when set. With "form_post" the provider
+	// POSTs the code and state to RedirectURL instead of adding them to its query.
+	ResponseMode string
+	// EmailVerifiedClaim names the claim that vouches for the email address when the
+	// ID token has no email_verified claim.
+	EmailVerifiedClaim string
+}
+
+// ResponseModeFormPost is the response mode of providers that POST the result of the
+// authorization to the redirect URL.
+const ResponseModeFormPost = "form_post"
+
+// Claims are the facts about the user that a provider vouched for.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+
+	mu         sync.Mutex
+	discovered bool
+	keys       *jwt.KeyRegister
+	keysLoaded time.Time
+}
+
+// NewProvider returns a Provider for config. Discovery and key fetching happen
+// lazily on first use, with client (http.DefaultClient when nil).
+func NewProvider(config ProviderConfig, client *http.Client) *Provider {
+	if config.Kind == "" {
+		config.Kind = KindOIDC
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// ResponseMode returns how the provider hands the code and state back, "" for the
+// default of redirecting with them in the query.
+func (p *Provider) ResponseMode() string {
+	return p.config.ResponseMode
+}
+
+// AuthCodeURL returns the URL of the provider's consent page. The state, nonce and
+// PKCE challenge are echoed back or bound into the resulting tokens.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if p.config.Kind == KindOIDC {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", nonce))
+	}
+	if p.config.ResponseMode != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", p.config.ResponseMode))
+	}
+
+	return p.oauth2Config().AuthCodeURL(state, opts...), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the verified claims
+// of the user who consented.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2Config().Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.config.Kind {
+	case KindGitHub:
+		return p.githubClaims(ctx, token)
+	default:
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok || rawIDToken == "" {
+			return nil, ErrInvalidIDToken
+		}
+		return p.VerifyIDToken(ctx, rawIDToken, nonce)
+	}
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's JWKS, and
+// its issuer, audience, lifetime and nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.checkSignature(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := claims.AcceptTemporal(time.Now(), time.Minute); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if claims.Issuer != p.expectedIssuer(claims) {
+		return nil, ErrInvalidIDToken
+	}
+	if !claims.AcceptAudience(p.config.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+	if tokenNonce, _ := claims.String("nonce"); tokenNonce != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	if claims.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	result := &Claims{Subject: claims.Subject}
+	result.Email, _ = claims.String("email")
+	result.Name, _ = claims.String("name")
+	result.Picture, _ = claims.String("picture")
+
+	verified, ok := claims.Set["email_verified"]
+	if !ok && p.config.EmailVerifiedClaim != "" {
+		verified = claims.Set[p.config.EmailVerifiedClaim]
+	}
+	result.EmailVerified = isTrue(verified)
+
+	return result, nil
+}
+
+// isTrue reports whether a boolean claim is set. Apple sends booleans as the strings
+// "true" and "false", and Microsoft's optional claims may come as 1 or "1".
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "1"
+	case float64:
+		return v == 1
+	}
+	return false
+}
+
+func (p *Provider) oauth2Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.config.AuthURL,
+			TokenURL: p.config.TokenURL,
+		},
+	}
+}
+
+// expectedIssuer returns the issuer the token must carry. Multi-tenant Microsoft
+// endpoints advertise an issuer template containing "{tenantid}", which is filled in
+// from the token's tid claim.
+func (p *Provider) expectedIssuer(claims *jwt.Claims) string {
+	if strings.Contains(p.config.Issuer, "{tenantid}") {
+		tenantID, _ := claims.String("tid")
+		return strings.Replace(p.config.Issuer, "{tenantid}", tenantID, 1)
+	}
+	return p.config.Issuer
+}
+
+func (p *Provider) checkSignature(ctx context.Context, rawIDToken string) (*jwt.Claims, error) {
+	keys, err := p.loadKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := keys.Check([]byte(rawIDToken))
+	if err == nil {
+		return claims, nil
+	}
+
+	// The provider may have rotated its keys since we last fetched them.
+	keys, err = p.loadKeys(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err = keys.Check([]byte(rawIDToken))
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+func (p *Provider) loadKeys(ctx context.Context, refresh bool) (*jwt.KeyRegister, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Refetch at most once a minute, so that garbage tokens cannot make us hammer
+	// the provider.
+	if p.keys != nil && (!refresh || time.Since(p.keysLoaded) < time.Minute) {
+		return p.keys, nil
+	}
+
+	if p.config.JWKSURL == "" {
+		return nil, fmt.Errorf("oidc: provider %q has no JWKS URL", p.config.Name)
+	}
+
+	var raw json.RawMessage
+	err := p.getJSON(ctx, p.config.JWKSURL, "", &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &jwt.KeyRegister{}
+	_, err = keys.LoadJWK(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// ID tokens must be signed asymmetrically; ignore any symmetric keys.
+	keys.HMACs = nil
+	keys.HMACIDs = nil
+
+	p.keys = keys
+	p.keysLoaded = time.Now()
+	return keys, nil
+}
+
+// discover fills in the endpoints from the issuer's discovery document.
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovered || p.config.Kind != KindOIDC {
+		return nil
+	}
+	if p.config.AuthURL != "" && p.config.TokenURL != "" && p.config.JWKSURL != "" {
+		p.discovered = true
+		return nil
+	}
+
+	var document struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	err := p.getJSON(ctx, discoveryURL, "", &document)
+	if err != nil {
+		return err
+	}
+
+	// The document must be the issuer's own, or it could vouch for tokens of another
+	// issuer. Multi-tenant Microsoft endpoints advertise an issuer template, which
+	// replaces the configured issuer so that tokens are checked against their tenant.
+	if !issuerMatches(p.config.Issuer, document.Issuer) {
+		return fmt.Errorf("oidc: provider %q: discovery document is for issuer %q, not %q", p.config.Name, document.Issuer, p.config.Issuer)
+	}
+	if strings.Contains(document.Issuer, "{tenantid}") {
+		p.config.Issuer = document.Issuer
+	}
+	if p.config.AuthURL == "" {
+		p.config.AuthURL = document.AuthorizationEndpoint
+	}
+	if p.config.TokenURL == "" {
+		p.config.TokenURL = document.TokenEndpoint
+	}
+	if p.config.UserInfoURL == "" {
+		p.config.UserInfoURL = document.UserInfoEndpoint
+	}
+	if p.config.JWKSURL == "" {
+		p.config.JWKSURL = document.JWKSURI
+	}
+
+	p.discovered = true
+	return nil
+}
+
+// issuerMatches reports whether the issuer advertised by a discovery document is the
+// configured one. A "{tenantid}" path segment in the advertised issuer stands for the
+// tenant segment of the configured one, such as "common" or "organizations".
+func issuerMatches(configured, advertised string) bool {
+	configured = strings.TrimSuffix(configured, "/")
+	advertised = strings.TrimSuffix(advertised, "/")
+	if configured == advertised {
+		return true
+	}
+
+	want, got := strings.Split(configured, "/"), strings.Split(advertised, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	templated := false
+	for i := range want {
+		switch {
+		case got[i] == "{tenantid}":
+			templated = true
+		case got[i] != want[i]:
+			return false
+		}
+	}
+	return templated
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, accessToken string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: unexpected status %s", url, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(dst)
+}
+
+// NewPKCE returns a random PKCE code verifier and its S256 code challenge.
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns n random bytes encoded as unpadded base64url.
+func RandomString(n int) (string, error) {
+	randomBytes := make([]byte, n)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
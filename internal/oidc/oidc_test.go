@@ -0,0 +1,225 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"offerland.cc/internal/oidc/oidctest"
+)
+
+const testClientID = "offerland-test"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Issuer) {
+	t.Helper()
+
+	issuer, err := oidctest.NewIssuer(testClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+
+	provider := NewProvider(WithPreset(ProviderConfig{
+		Name:        "test",
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:3000/auth/callback/test",
+		Scopes:      []string{"openid", "email", "profile"},
+		Issuer:      issuer.URL,
+	}), nil)
+	return provider, issuer
+}
+
+// start plays the start and callback of a login: it builds the authorization URL
+// and returns the code the issuer redirected back with, with the PKCE verifier and
+// nonce the callback needs.
+func start(t *testing.T, provider *Provider, issuer *oidctest.Issuer) (code, verifier, nonce string) {
+	t.Helper()
+
+	state, err := RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, returnedState, err := issuer.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returnedState != state {
+		t.Fatalf("state = %q, want %q", returnedState, state)
+	}
+	return code, verifier, nonce
+}
+
+func TestLogin(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	issuer.SetUser(oidctest.User{
+		Subject:       "user-1",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		Name:          "Ada",
+	})
+
+	code, verifier, nonce := start(t, provider, issuer)
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Claims{Subject: "user-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+}
+
+// TestPresets signs in with the settings of each OpenID Connect preset against an
+// issuer that shapes its ID tokens like the real provider.
+func TestPresets(t *testing.T) {
+	tests := []struct {
+		preset          string
+		claims          map[string]any
+		requireFormPost bool
+		want            Claims
+	}{
+		{
+			preset: "google",
+			want:   Claims{Subject: "user-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada"},
+		},
+		{
+			// Microsoft v2.0 tokens have no email_verified, only the optional xms_edov.
+			preset: "microsoft",
+			claims: map[string]any{"email_verified": nil, "xms_edov": true, "tid": "9188040d-6c67-4c5b-b112-36a304b66dad"},
+			want:   Claims{Subject: "user-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada"},
+		},
+		{
+			preset: "microsoft",
+			claims: map[string]any{"email_verified": nil, "xms_edov": "1"},
+			want:   Claims{Subject: "user-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada"},
+		},
+		{
+			preset: "microsoft",
+			claims: map[string]any{"email_verified": nil},
+			want:   Claims{Subject: "user-1", Email: "ada@example.com", Name: "Ada"},
+		},
+		{
+			// Apple sends email_verified as a string and never puts the name in the
+			// ID token.
+			preset:          "apple",
+			claims:          map[string]any{"email_verified": "true", "name": nil},
+			requireFormPost: true,
+			want:            Claims{Subject: "user-1", Email: "ada@example.com", EmailVerified: true},
+		},
+		{
+			preset:          "apple",
+			claims:          map[string]any{"email_verified": "false", "name": nil},
+			requireFormPost: true,
+			want:            Claims{Subject: "user-1", Email: "ada@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			issuer, err := oidctest.NewIssuer(testClientID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(issuer.Close)
+			issuer.RequireFormPost = tt.requireFormPost
+			issuer.SetUser(oidctest.User{
+				Subject:       "user-1",
+				Email:         "ada@example.com",
+				EmailVerified: true,
+				Name:          "Ada",
+				Claims:        tt.claims,
+			})
+
+			provider := NewProvider(WithPreset(ProviderConfig{
+				Name:        tt.preset,
+				ClientID:    testClientID,
+				RedirectURL: "http://localhost:8080/auth/oidc/" + tt.preset + "/form_post",
+				Issuer:      issuer.URL,
+			}), nil)
+
+			code, verifier, nonce := start(t, provider, issuer)
+
+			claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *claims != tt.want {
+				t.Errorf("claims = %+v, want %+v", *claims, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsWrongNonce(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+
+	code, verifier, _ := start(t, provider, issuer)
+
+	_, err := provider.Exchange(context.Background(), code, verifier, "another-nonce")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestLoginRejectsWrongVerifier(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+
+	code, _, nonce := start(t, provider, issuer)
+
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Exchange(context.Background(), code, otherVerifier, nonce)
+	if err == nil {
+		t.Error("exchange with the wrong code verifier succeeded")
+	}
+}
+
+func TestDiscoveryRejectsOtherIssuer(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	issuer.AdvertisedIssuer = "https://attacker.example.com"
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err == nil {
+		t.Fatal("discovery accepted a document for another issuer")
+	}
+}
+
+func TestIssuerMatches(t *testing.T) {
+	tests := []struct {
+		configured string
+		advertised string
+		want       bool
+	}{
+		{"https://accounts.google.com", "https://accounts.google.com", true},
+		{"https://accounts.google.com/", "https://accounts.google.com", true},
+		{"https://accounts.google.com", "https://evil.example.com", false},
+		{"https://login.microsoftonline.com/common/v2.0", "https://login.microsoftonline.com/{tenantid}/v2.0", true},
+		{"https://login.microsoftonline.com/common/v2.0", "https://evil.example.com/{tenantid}/v2.0", false},
+		{"https://login.microsoftonline.com/common/v2.0", "https://login.microsoftonline.com/{tenantid}", false},
+	}
+
+	for _, tt := range tests {
+		got := issuerMatches(tt.configured, tt.advertised)
+		if got != tt.want {
+			t.Errorf("issuerMatches(%q, %q) = %v, want %v", tt.configured, tt.advertised, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Package oidctest provides a local OpenID Connect issuer for exercising the login
+// flow without talking to a real provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+const keyID = "oidctest"
+
+// User is the account the issuer signs in as on the next authorization request.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Claims are added to the ID token to mimic a provider, replacing the claims
+	// above of the same name. A nil value leaves the claim out.
+	Claims map[string]any
+}
+
+type grant struct {
+	user          User
+	clientID      string
+	nonce         string
+	codeChallenge string
+}
+
+// Issuer is an OpenID Connect provider backed by an httptest.Server. Every
+// authorization request is approved immediately for the current User.
+type Issuer struct {
+	URL      string
+	ClientID string
+	// AdvertisedIssuer, when set, is put in the discovery document instead of URL,
+	// to check that clients reject a document for another issuer.
+	AdvertisedIssuer string
+	// RequireFormPost rejects authorization requests without
+	// response_mode=form_post, as Apple does when the name or email is requested.
+	RequireFormPost bool
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	user   User
+	grants map[string]grant
+}
+
+func NewIssuer(clientID string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &Issuer{
+		ClientID: clientID,
+		key:      key,
+		grants:   map[string]grant{},
+		user: User{
+			Subject:       "oidctest-user",
+			Email:         "oidctest@example.com",
+			EmailVerified: true,
+			Name:          "OIDC Test",
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.server = httptest.NewServer(mux)
+	issuer.URL = issuer.server.URL
+	return issuer, nil
+}
+
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// SetUser changes the account that subsequent authorizations sign in as.
+func (i *Issuer) SetUser(user User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.user = user
+}
+
+// Authorize plays the browser: it visits authURL and returns the code and state
+// that the issuer redirected back with, or posted back with when authURL asks for
+// response_mode=form_post.
+func (i *Issuer) Authorize(authURL string) (code string, state string, err error) {
+	form, err := i.authorizeForm(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	return form.Get("code"), form.Get("state"), nil
+}
+
+// FormPost visits authURL, which must ask for response_mode=form_post, and returns
+// the form the browser would post to the redirect URL.
+func (i *Issuer) FormPost(authURL string) (action string, form url.Values, err error) {
+	res, err := i.visit(authURL)
+	if err != nil {
+		return "", nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", nil, errors.New("oidctest: authorization did not respond with a form")
+	}
+
+	var page strings.Builder
+	_, err = io.Copy(&page, res.Body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	match := formActionRE.FindStringSubmatch(page.String())
+	if match == nil {
+		return "", nil, errors.New("oidctest: authorization did not respond with a form")
+	}
+	action = html.UnescapeString(match[1])
+
+	form = url.Values{}
+	for _, input := range formInputRE.FindAllStringSubmatch(page.String(), -1) {
+		form.Set(html.UnescapeString(input[1]), html.UnescapeString(input[2]))
+	}
+	return action, form, nil
+}
+
+func (i *Issuer) authorizeForm(authURL string) (url.Values, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Query().Get("response_mode") == "form_post" {
+		_, form, err := i.FormPost(authURL)
+		return form, err
+	}
+
+	res, err := i.visit(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		return nil, errors.New("oidctest: authorization was not redirected")
+	}
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return nil, err
+	}
+	return location.Query(), nil
+}
+
+// visit requests authURL without following redirects.
+func (i *Issuer) visit(authURL string) (*http.Response, error) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return client.Get(authURL)
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	advertised := i.URL
+	if i.AdvertisedIssuer != "" {
+		advertised = i.AdvertisedIssuer
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                advertised,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("response_type") != "code" || q.Get("client_id") != i.ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if i.RequireFormPost && q.Get("response_mode") != "form_post" {
+		http.Error(w, "response_mode must be form_post", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.String() == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	i.mu.Lock()
+	i.grants[code] = grant{
+		user:          i.user,
+		clientID:      q.Get("client_id"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	if q.Get("response_mode") == "form_post" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		formPostPage.Execute(w, map[string]string{
+			"Action": redirectURI.String(),
+			"Code":   code,
+			"State":  q.Get("state"),
+		})
+		return
+	}
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// formPostPage is the self-submitting form that form_post responses consist of.
+var formPostPage = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html><body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="code" value="{{.Code}}">
+<input type="hidden" name="state" value="{{.State}}">
+</form>
+</body></html>
+`))
+
+var (
+	formActionRE = regexp.MustCompile(`<form method="post" action="([^"]*)">`)
+	formInputRE  = regexp.MustCompile(`<input type="hidden" name="([^"]*)" value="([^"]*)">`)
+)
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	i.mu.Lock()
+	g, ok := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.Claims{
+		KeyID: keyID,
+		Set: map[string]any{
+			"nonce":          g.nonce,
+			"email":          g.user.Email,
+			"email_verified": g.user.EmailVerified,
+			"name":           g.user.Name,
+		},
+	}
+	for name, value := range g.user.Claims {
+		if value == nil {
+			delete(claims.Set, name)
+		} else {
+			claims.Set[name] = value
+		}
+	}
+	claims.Issuer = i.URL
+	claims.Subject = g.user.Subject
+	claims.Audiences = []string{g.clientID}
+	claims.Issued = jwt.NewNumericTime(now)
+	claims.Expires = jwt.NewNumericTime(now.Add(5 * time.Minute))
+
+	idToken, err := claims.RSASign(jwt.RS256, i.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     string(idToken),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func randomString() string {
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+	return base64.RawURLEncoding.EncodeToString(randomBytes)
+}
@@ -0,0 +1,86 @@
+package oidc
+
+// Presets holds the well-known settings of the supported providers. Only the client
+// credentials need to be configured for them; any field set in the configuration
+// overrides the preset, e.g. Issuer to point at a mock issuer in tests.
+var Presets = map[string]ProviderConfig{
+	"google": {
+		Kind:   KindOIDC,
+		Issuer: "https://accounts.google.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	// Microsoft v2.0 ID tokens carry no email_verified claim. xms_edov, which says
+	// that the owner of the email domain has been verified, has to be added to the
+	// app registration as an optional claim.
+	"microsoft": {
+		Kind:               KindOIDC,
+		Issuer:             "https://login.microsoftonline.com/common/v2.0",
+		Scopes:             []string{"openid", "email", "profile"},
+		EmailVerifiedClaim: "xms_edov",
+	},
+	// Apple requires response_mode=form_post when the name or email scope is
+	// requested, so its redirect URL has to be the API's form_post endpoint.
+	"apple": {
+		Kind:         KindOIDC,
+		Issuer:       "https://appleid.apple.com",
+		Scopes:       []string{"openid", "email", "name"},
+		ResponseMode: ResponseModeFormPost,
+	},
+	"github": {
+		Kind:        KindGitHub,
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		Scopes:      []string{"read:user", "user:email"},
+	},
+}
+
+// WithPreset returns config with every empty field filled in from the preset of
+// the same name, if there is one.
+func WithPreset(config ProviderConfig) ProviderConfig {
+	preset, ok := Presets[config.Name]
+	if !ok {
+		return config
+	}
+
+	if config.Kind == "" {
+		config.Kind = preset.Kind
+	}
+	if config.Issuer == "" {
+		config.Issuer = preset.Issuer
+	}
+	if config.AuthURL == "" {
+		config.AuthURL = preset.AuthURL
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = preset.TokenURL
+	}
+	if config.UserInfoURL == "" {
+		config.UserInfoURL = preset.UserInfoURL
+	}
+	if config.JWKSURL == "" {
+		config.JWKSURL = preset.JWKSURL
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = preset.Scopes
+	}
+	if config.ResponseMode == "" {
+		config.ResponseMode = preset.ResponseMode
+	}
+	if config.EmailVerifiedClaim == "" {
+		config.EmailVerifiedClaim = preset.EmailVerifiedClaim
+	}
+
+	return config
+}
+
+// Registry holds the configured providers by name.
+type Registry map[string]*Provider
+
+func (r Registry) Get(name string) (*Provider, error) {
+	provider, ok := r[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
@@ -0,0 +1,362 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// This file holds a minimal Parquet reader for the tests. It decodes the footer and
+// the pages written by Writer independently of it, so that a mistake in the writer
+// does not cancel out against the same mistake in the reader.
+
+var errTruncated = errors.New("truncated data")
+
+// thriftReader decodes structures of the Thrift compact protocol into maps from field
+// IDs to values: int64 for integers, string for binaries, []any for lists and
+// fields for structs.
+type thriftReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// fields holds the fields of a decoded struct by ID.
+type fields map[int16]any
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = errTruncated
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) bytes(n int) []byte {
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errTruncated
+		r.pos = len(r.data)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+	if r.pos >= len(r.data) {
+		r.err = errTruncated
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = errTruncated
+		r.pos = len(r.data)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case thriftI32, thriftI64, 4:
+		return r.zigzag()
+	case 7:
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.bytes(8)))
+	case thriftBinary:
+		return string(r.bytes(int(r.varint())))
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := []any{}
+		for i := 0; i < n && r.err == nil; i++ {
+			list = append(list, r.value(header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	default:
+		r.err = fmt.Errorf("unknown thrift type %d", typ)
+		return nil
+	}
+}
+
+func (r *thriftReader) structure() fields {
+	s := fields{}
+	var last int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		s[id] = r.value(header & 0x0f)
+		last = id
+	}
+	return s
+}
+
+func (s fields) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s fields) string(id int16) string {
+	v, _ := s[id].(string)
+	return v
+}
+
+func (s fields) structure(id int16) fields {
+	v, _ := s[id].(fields)
+	return v
+}
+
+func (s fields) list(id int16) []any {
+	v, _ := s[id].([]any)
+	return v
+}
+
+func (s fields) structs(id int16) []fields {
+	var structs []fields
+	for _, v := range s.list(id) {
+		structs = append(structs, v.(fields))
+	}
+	return structs
+}
+
+// decodedFile is a file as the test reader sees it.
+type decodedFile struct {
+	columns []Column
+	// groups holds the number of rows of each row group.
+	groups []int
+	// rows holds the values of each row as Write takes them, with int32 and int64
+	// for the integer types.
+	rows [][]any
+}
+
+// decodeFile reads a whole file written by Writer.
+func decodeFile(data []byte) (*decodedFile, error) {
+	if len(data) < 12 || !bytes.Equal(data[:4], magic) || !bytes.Equal(data[len(data)-4:], magic) {
+		return nil, errors.New("missing PAR1 magic")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footerLength > len(data)-12 {
+		return nil, fmt.Errorf("footer length %d exceeds the file", footerLength)
+	}
+	r := thriftReader{data: data[len(data)-8-footerLength : len(data)-8]}
+	meta := r.structure()
+	if r.err != nil {
+		return nil, fmt.Errorf("footer: %w", r.err)
+	}
+	if r.pos != footerLength {
+		return nil, fmt.Errorf("footer is %d bytes, decoded %d", footerLength, r.pos)
+	}
+	if meta.int(1) != 1 {
+		return nil, fmt.Errorf("version = %d", meta.int(1))
+	}
+
+	file := &decodedFile{}
+	schema := meta.structs(2)
+	if len(schema) == 0 || schema[0].int(5) != int64(len(schema)-1) {
+		return nil, errors.New("schema root does not count its columns")
+	}
+	for _, element := range schema[1:] {
+		column, err := decodeColumn(element)
+		if err != nil {
+			return nil, err
+		}
+		file.columns = append(file.columns, column)
+	}
+
+	var rows int64
+	for i, group := range meta.structs(4) {
+		chunks := group.structs(1)
+		if len(chunks) != len(file.columns) {
+			return nil, fmt.Errorf("row group %d has %d chunks for %d columns", i, len(chunks), len(file.columns))
+		}
+		n := int(group.int(3))
+		values := make([][]any, len(chunks))
+		var size int64
+		for j, chunk := range chunks {
+			var err error
+			values[j], err = decodeChunk(data, file.columns[j], chunk, n)
+			if err != nil {
+				return nil, fmt.Errorf("row group %d, column %q: %w", i, file.columns[j].Name, err)
+			}
+			size += chunk.structure(3).int(7)
+		}
+		if size != group.int(2) {
+			return nil, fmt.Errorf("row group %d: size = %d, chunks add up to %d", i, group.int(2), size)
+		}
+
+		for row := 0; row < n; row++ {
+			var record []any
+			for j := range chunks {
+				record = append(record, values[j][row])
+			}
+			file.rows = append(file.rows, record)
+		}
+		file.groups = append(file.groups, n)
+		rows += int64(n)
+	}
+	if rows != meta.int(3) {
+		return nil, fmt.Errorf("num_rows = %d, row groups add up to %d", meta.int(3), rows)
+	}
+	return file, nil
+}
+
+func decodeColumn(element fields) (Column, error) {
+	column := Column{Name: element.string(4), Optional: element.int(3) == repetitionOptional}
+	switch element.int(1) {
+	case physicalInt32:
+		column.Type = Int32
+	case physicalInt64:
+		column.Type = Int64
+	case physicalDouble:
+		column.Type = Double
+	case physicalByteArray:
+		column.Type = String
+		if v, ok := element[6]; !ok || v.(int64) != convertedUTF8 {
+			return Column{}, fmt.Errorf("column %q: byte array is not annotated as UTF-8", column.Name)
+		}
+	default:
+		return Column{}, fmt.Errorf("column %q: unknown physical type %d", column.Name, element.int(1))
+	}
+	return column, nil
+}
+
+// decodeChunk reads the single data page of a column chunk, which holds n values.
+func decodeChunk(data []byte, column Column, chunk fields, n int) ([]any, error) {
+	meta := chunk.structure(3)
+	offset, size := meta.int(9), meta.int(7)
+	if chunk.int(2) != offset || meta.int(6) != size {
+		return nil, errors.New("chunk offsets or sizes disagree")
+	}
+	if meta.int(5) != int64(n) || meta.int(4) != codecUncompressed {
+		return nil, fmt.Errorf("num_values = %d, codec = %d", meta.int(5), meta.int(4))
+	}
+	if offset < 4 || size < 0 || offset+size > int64(len(data)) {
+		return nil, fmt.Errorf("chunk at %d+%d lies outside the file", offset, size)
+	}
+
+	r := thriftReader{data: data[offset : offset+size]}
+	header := r.structure()
+	page := r.bytes(int(header.int(3)))
+	if r.err != nil {
+		return nil, fmt.Errorf("page: %w", r.err)
+	}
+	if r.pos != len(r.data) {
+		return nil, fmt.Errorf("chunk is %d bytes, page ends at %d", len(r.data), r.pos)
+	}
+	if header.int(1) != pageData || header.int(2) != header.int(3) {
+		return nil, fmt.Errorf("page type = %d, sizes = %d/%d", header.int(1), header.int(2), header.int(3))
+	}
+	dataHeader := header.structure(5)
+	if dataHeader.int(1) != int64(n) || dataHeader.int(2) != encodingPlain {
+		return nil, fmt.Errorf("page holds %d values with encoding %d", dataHeader.int(1), dataHeader.int(2))
+	}
+
+	defined := make([]bool, n)
+	for i := range defined {
+		defined[i] = true
+	}
+	if column.Optional {
+		if len(page) < 4 {
+			return nil, errTruncated
+		}
+		length := int(binary.LittleEndian.Uint32(page))
+		if length > len(page)-4 {
+			return nil, errTruncated
+		}
+		var err error
+		defined, err = decodeLevels(page[4:4+length], n)
+		if err != nil {
+			return nil, err
+		}
+		page = page[4+length:]
+	}
+
+	values := make([]any, n)
+	pr := thriftReader{data: page}
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch column.Type {
+		case Int32:
+			values[i] = int32(binary.LittleEndian.Uint32(pr.bytes(4)))
+		case Int64:
+			values[i] = int64(binary.LittleEndian.Uint64(pr.bytes(8)))
+		case Double:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(pr.bytes(8)))
+		case String:
+			values[i] = string(pr.bytes(int(binary.LittleEndian.Uint32(pr.bytes(4)))))
+		}
+		if pr.err != nil {
+			return nil, fmt.Errorf("values: %w", pr.err)
+		}
+	}
+	if pr.pos != len(page) {
+		return nil, fmt.Errorf("%d bytes left after the values", len(page)-pr.pos)
+	}
+	return values, nil
+}
+
+// decodeLevels reads n definition levels of bit width 1 in the RLE hybrid encoding,
+// accepting both RLE and bit-packed runs.
+func decodeLevels(data []byte, n int) ([]bool, error) {
+	var levels []bool
+	for len(levels) < n {
+		header, k := binary.Uvarint(data)
+		if k <= 0 {
+			return nil, errTruncated
+		}
+		data = data[k:]
+
+		count := int(header >> 1)
+		if count == 0 {
+			return nil, errors.New("empty run")
+		}
+		if header&1 == 1 {
+			if len(data) < count {
+				return nil, errTruncated
+			}
+			for i := 0; i < count*8; i++ {
+				levels = append(levels, data[i/8]>>(i%8)&1 == 1)
+			}
+			data = data[count:]
+		} else {
+			if len(data) < 1 {
+				return nil, errTruncated
+			}
+			for i := 0; i < count; i++ {
+				levels = append(levels, data[0]&1 == 1)
+			}
+			data = data[1:]
+		}
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%d bytes left after the levels", len(data))
+	}
+	return levels[:n], nil
+}
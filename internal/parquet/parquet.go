@@ -0,0 +1,389 @@
+// Package parquet writes flat Parquet files one row at a time, so that large exports
+// can be streamed. Rows are buffered until a row group is full and then written out;
+// the file metadata follows the last row group when the writer is closed.
+//
+// The writer covers what tabular exports need and nothing more: columns are
+// required or optional but never nested, values use the plain encoding, and pages
+// are not compressed.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Type is the type of the values of a column.
+type Type int
+
+const (
+	Int32 Type = iota
+	Int64
+	Double
+	String
+)
+
+// Physical types, encodings and other enums of the Parquet format.
+const (
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8 = 0
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageData = 0
+
+	codecUncompressed = 0
+)
+
+// Bounds of a row group. A group is written out when either is reached.
+const (
+	DefaultRowGroupSize = 10000
+	maxRowGroupBytes    = 64 << 20
+)
+
+var magic = []byte("PAR1")
+
+// A Column describes one column of the file. Only optional columns can hold nulls.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+func (c Column) physicalType() int32 {
+	switch c.Type {
+	case Int32:
+		return physicalInt32
+	case Int64:
+		return physicalInt64
+	case Double:
+		return physicalDouble
+	default:
+		return physicalByteArray
+	}
+}
+
+// columnBuffer holds the values of a column in the current row group.
+type columnBuffer struct {
+	defined []bool
+	values  bytes.Buffer
+}
+
+// chunkMeta describes a column chunk that was written out.
+type chunkMeta struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+type rowGroupMeta struct {
+	chunks []chunkMeta
+	size   int64
+	rows   int64
+}
+
+// A Writer writes rows to a Parquet file.
+type Writer struct {
+	// RowGroupSize is the number of rows per row group, DefaultRowGroupSize unless
+	// changed before the first row is written.
+	RowGroupSize int
+
+	w       io.Writer
+	offset  int64
+	columns []Column
+	buffers []columnBuffer
+	rows    int
+	groups  []rowGroupMeta
+	err     error
+}
+
+// NewWriter returns a writer of a file with the given columns.
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	return &Writer{
+		RowGroupSize: DefaultRowGroupSize,
+		w:            w,
+		columns:      columns,
+		buffers:      make([]columnBuffer, len(columns)),
+	}
+}
+
+// Write adds a row, with one value per column: nil for a null, or an int, int32,
+// int64, float64 or string matching the type of the column.
+func (pw *Writer) Write(values ...any) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(values) != len(pw.columns) {
+		return fmt.Errorf("parquet: got %d values for %d columns", len(values), len(pw.columns))
+	}
+
+	// Check the whole row first so that a bad value does not leave it half written.
+	for i, value := range values {
+		err := checkValue(pw.columns[i], value)
+		if err != nil {
+			return err
+		}
+	}
+
+	size := 0
+	for i, value := range values {
+		buffer := &pw.buffers[i]
+		buffer.defined = append(buffer.defined, value != nil)
+		if value != nil {
+			appendPlain(&buffer.values, pw.columns[i], value)
+		}
+		size += buffer.values.Len()
+	}
+	pw.rows++
+
+	if pw.rows >= pw.RowGroupSize || size >= maxRowGroupBytes {
+		return pw.flush()
+	}
+	return nil
+}
+
+func checkValue(column Column, value any) error {
+	if value == nil {
+		if !column.Optional {
+			return fmt.Errorf("parquet: column %q is required", column.Name)
+		}
+		return nil
+	}
+
+	ok := false
+	switch v := value.(type) {
+	case int:
+		ok = column.Type == Int64 || (column.Type == Int32 && v >= math.MinInt32 && v <= math.MaxInt32)
+	case int32:
+		ok = column.Type == Int32
+	case int64:
+		ok = column.Type == Int64
+	case float64:
+		ok = column.Type == Double
+	case string:
+		ok = column.Type == String
+	}
+	if !ok {
+		return fmt.Errorf("parquet: column %q cannot hold %T %v", column.Name, value, value)
+	}
+	return nil
+}
+
+func appendPlain(buf *bytes.Buffer, column Column, value any) {
+	// checkValue made sure that an int fits the column.
+	if v, ok := value.(int); ok {
+		if column.Type == Int32 {
+			value = int32(v)
+		} else {
+			value = int64(v)
+		}
+	}
+
+	var b [8]byte
+	switch v := value.(type) {
+	case int32:
+		binary.LittleEndian.PutUint32(b[:], uint32(v))
+		buf.Write(b[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		buf.Write(b[:8])
+	case float64:
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:8])
+	case string:
+		binary.LittleEndian.PutUint32(b[:], uint32(len(v)))
+		buf.Write(b[:4])
+		buf.WriteString(v)
+	}
+}
+
+func (pw *Writer) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	if err != nil {
+		pw.err = err
+	}
+	return err
+}
+
+// flush writes the buffered rows out as a row group, with one page per column.
+func (pw *Writer) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	if pw.offset == 0 {
+		err := pw.write(magic)
+		if err != nil {
+			return err
+		}
+	}
+
+	group := rowGroupMeta{rows: int64(pw.rows)}
+	for i, column := range pw.columns {
+		buffer := &pw.buffers[i]
+
+		var page bytes.Buffer
+		if column.Optional {
+			levels := encodeDefinitionLevels(buffer.defined)
+			var length [4]byte
+			binary.LittleEndian.PutUint32(length[:], uint32(len(levels)))
+			page.Write(length[:])
+			page.Write(levels)
+		}
+		page.Write(buffer.values.Bytes())
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, pageData)
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.beginField(5)
+		header.i32(1, int32(pw.rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.end()
+		header.end()
+
+		chunk := chunkMeta{
+			offset: pw.offset,
+			size:   int64(header.buf.Len() + page.Len()),
+			values: int64(pw.rows),
+		}
+		err := pw.write(header.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		err = pw.write(page.Bytes())
+		if err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+
+		buffer.defined = buffer.defined[:0]
+		buffer.values.Reset()
+	}
+
+	pw.groups = append(pw.groups, group)
+	pw.rows = 0
+	return nil
+}
+
+// encodeDefinitionLevels encodes the definition levels of an optional column, 1 for a
+// value and 0 for a null, as a single bit-packed run of the RLE hybrid encoding.
+func encodeDefinitionLevels(defined []bool) []byte {
+	groups := (len(defined) + 7) / 8
+
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(groups)<<1|1)
+
+	levels := make([]byte, n+groups)
+	copy(levels, header[:n])
+	for i, ok := range defined {
+		if ok {
+			levels[n+i/8] |= 1 << (i % 8)
+		}
+	}
+	return levels
+}
+
+// Close writes the remaining rows and the file metadata. It does not close the
+// underlying writer.
+func (pw *Writer) Close() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	err := pw.flush()
+	if err != nil {
+		return err
+	}
+	if pw.offset == 0 {
+		err = pw.write(magic)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rows int64
+	for _, group := range pw.groups {
+		rows += group.rows
+	}
+
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1)
+
+	meta.list(2, thriftStruct, len(pw.columns)+1)
+	meta.begin()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.end()
+	for _, column := range pw.columns {
+		meta.begin()
+		meta.i32(1, column.physicalType())
+		if column.Optional {
+			meta.i32(3, repetitionOptional)
+		} else {
+			meta.i32(3, repetitionRequired)
+		}
+		meta.string(4, column.Name)
+		if column.Type == String {
+			meta.i32(6, convertedUTF8)
+		}
+		meta.end()
+	}
+
+	meta.i64(3, rows)
+
+	meta.list(4, thriftStruct, len(pw.groups))
+	for _, group := range pw.groups {
+		meta.begin()
+		meta.list(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			column := pw.columns[i]
+			meta.begin()
+			meta.i64(2, chunk.offset)
+			meta.beginField(3)
+			meta.i32(1, column.physicalType())
+			meta.list(2, thriftI32, 2)
+			meta.i32Elem(encodingPlain)
+			meta.i32Elem(encodingRLE)
+			meta.list(3, thriftBinary, 1)
+			meta.stringElem(column.Name)
+			meta.i32(4, codecUncompressed)
+			meta.i64(5, chunk.values)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, group.size)
+		meta.i64(3, group.rows)
+		meta.end()
+	}
+
+	meta.string(6, "offerland")
+	meta.end()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	for _, p := range [][]byte{meta.buf.Bytes(), length[:], magic} {
+		err = pw.write(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package parquet
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var testColumns = []Column{
+	{Name: "id", Type: Int64},
+	{Name: "name", Type: String},
+	{Name: "score", Type: Double, Optional: true},
+	{Name: "year", Type: Int32, Optional: true},
+	{Name: "note", Type: String, Optional: true},
+}
+
+// testRows returns n rows of testColumns as decodeFile returns them, with nulls in
+// the optional columns at different intervals.
+func testRows(n int) [][]any {
+	rows := make([][]any, n)
+	for i := range rows {
+		rows[i] = []any{int64(i) << 33, fmt.Sprintf("row %d, 名稱", i), nil, nil, nil}
+		if i%2 == 0 {
+			rows[i][2] = float64(i) / 4
+		}
+		if i%3 != 0 {
+			rows[i][3] = int32(2000 + i)
+		}
+		if i%5 == 0 {
+			rows[i][4] = ""
+		}
+	}
+	return rows
+}
+
+func writeFile(t *testing.T, rows [][]any, rowGroupSize int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	pw := NewWriter(&buf, testColumns)
+	pw.RowGroupSize = rowGroupSize
+	for _, row := range rows {
+		values := append([]any(nil), row...)
+		// Exports pass plain ints, so write the years that way.
+		if year, ok := values[3].(int32); ok {
+			values[3] = int(year)
+		}
+		err := pw.Write(values...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := pw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		rows         int
+		rowGroupSize int
+		groups       []int
+	}{
+		{"empty", 0, 10, nil},
+		{"one group", 7, 10, []int{7}},
+		{"full groups", 20, 10, []int{10, 10}},
+		{"partial last group", 25, 10, []int{10, 10, 5}},
+		{"long level runs", 300, 1000, []int{300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := testRows(tt.rows)
+			file, err := decodeFile(writeFile(t, want, tt.rowGroupSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(file.columns, testColumns) {
+				t.Errorf("columns = %+v, want %+v", file.columns, testColumns)
+			}
+			if !reflect.DeepEqual(file.groups, tt.groups) {
+				t.Errorf("row groups = %v, want %v", file.groups, tt.groups)
+			}
+			if len(file.rows) != len(want) {
+				t.Fatalf("rows = %d, want %d", len(file.rows), len(want))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(file.rows[i], want[i]) {
+					t.Errorf("row %d = %v, want %v", i, file.rows[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestGolden compares the output with a file that parquet-go read back correctly, so
+// that a change to the layout shows up even where the test reader would accept it.
+// Run with -update to rewrite it after a deliberate change.
+func TestGolden(t *testing.T) {
+	got := writeFile(t, testRows(25), 10)
+
+	path := filepath.Join("testdata", "rows.parquet")
+	if *update {
+		err := os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s; run with -update if the change is deliberate", path)
+	}
+}
+
+func TestWriteRejectsBadRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []any
+	}{
+		{"too few values", []any{int64(1), "a", nil, nil}},
+		{"null in required column", []any{nil, "a", nil, nil, nil}},
+		{"wrong type", []any{int64(1), 2, nil, nil, nil}},
+		{"int out of range", []any{int64(1), "a", nil, 1 << 40, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw := NewWriter(&bytes.Buffer{}, testColumns)
+			if err := pw.Write(tt.values...); err == nil {
+				t.Error("Write succeeded")
+			}
+		})
+	}
+}
@@ -1,34 +1,255 @@
 package password
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Supported hashing algorithms. Hashes are stored in their standard self-describing
+// formats ("$argon2id$v=19$m=...,t=...,p=...$salt$key" and "$2a$cost$..."), so the
+// algorithm and its parameters can always be recovered from the stored value.
+// Hashes in neither format are legacy unsalted hex SHA-256 digests.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Bounds of the argon2id parameters. Stored hashes carry their own parameters, so
+// without them a crafted hash could make verifying a password take any amount of
+// memory and time.
+const (
+	maxArgon2Memory  = 1 << 20 // 1 GiB, in KiB
+	maxArgon2Time    = 16
+	maxArgon2Threads = 16
+	minArgon2SaltLen = 8
+	maxArgon2SaltLen = 64
+	minArgon2KeyLen  = 16
+	maxArgon2KeyLen  = 64
+)
+
+type Params struct {
+	Algorithm string
+
+	BcryptCost int
+
+	Argon2Memory  uint32 // in KiB
+	Argon2Time    uint32
+	Argon2Threads uint8
+	Argon2SaltLen uint32
+	Argon2KeyLen  uint32
+}
+
+var DefaultParams = Params{
+	Algorithm:     AlgorithmArgon2id,
+	BcryptCost:    12,
+	Argon2Memory:  64 * 1024,
+	Argon2Time:    3,
+	Argon2Threads: 2,
+	Argon2SaltLen: 16,
+	Argon2KeyLen:  32,
+}
+
+var params = DefaultParams
+
+// Configure sets the algorithm and cost used by Hash for new passwords. Existing
+// hashes created with other settings keep verifying, and NeedsRehash reports them
+// so they can be upgraded on the next successful login.
+func Configure(p Params) error {
+	switch p.Algorithm {
+	case AlgorithmArgon2id:
+		if p.Argon2Memory == 0 || p.Argon2Time == 0 || p.Argon2Threads == 0 {
+			return errors.New("argon2id memory, time and threads must be greater than zero")
+		}
+		if p.Argon2SaltLen == 0 {
+			p.Argon2SaltLen = DefaultParams.Argon2SaltLen
+		}
+		if p.Argon2KeyLen == 0 {
+			p.Argon2KeyLen = DefaultParams.Argon2KeyLen
+		}
+		if !argon2ParamsValid(p) {
+			return fmt.Errorf("argon2id parameters must be at most m=%d, t=%d, p=%d, with memory of at least 8 KiB per thread",
+				maxArgon2Memory, maxArgon2Time, maxArgon2Threads)
+		}
+	case AlgorithmBcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q", p.Algorithm)
+	}
+
+	params = p
+	return nil
+}
+
 func Hash(plaintextPassword string) (string, error) {
-	// hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
-	// if err != nil {
-	// 	return "", err
-	// }
-	hasher := sha256.New()
-	hasher.Write([]byte(plaintextPassword))
-	hashedPassword := hex.EncodeToString(hasher.Sum(nil))
-	return hashedPassword, nil
+	switch params.Algorithm {
+	case AlgorithmBcrypt:
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), params.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashedPassword), nil
+	default:
+		return hashArgon2id(plaintextPassword, params)
+	}
 }
 
 func Matches(plaintextPassword, hashedPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plaintextPassword))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
+	switch {
+	case hashedPassword == "":
+		// Accounts created through a social login have no password.
+		return false, nil
+
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		return matchesArgon2id(plaintextPassword, hashedPassword)
+
+	case strings.HasPrefix(hashedPassword, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plaintextPassword))
+		if err != nil {
+			switch {
+			case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+				return false, nil
+			default:
+				return false, err
+			}
 		}
+		return true, nil
+
+	case isLegacySHA256(hashedPassword):
+		sum := sha256.Sum256([]byte(plaintextPassword))
+		expected := hex.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(hashedPassword))) == 1, nil
+
+	default:
+		return false, ErrInvalidHash
 	}
+}
+
+// NeedsRehash reports whether hashedPassword was created with a legacy scheme, a
+// different algorithm, or weaker parameters than the ones currently configured.
+func NeedsRehash(hashedPassword string) bool {
+	switch {
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		if params.Algorithm != AlgorithmArgon2id {
+			return true
+		}
+		p, _, _, err := decodeArgon2id(hashedPassword)
+		if err != nil {
+			return true
+		}
+		return p.Argon2Memory < params.Argon2Memory ||
+			p.Argon2Time < params.Argon2Time ||
+			p.Argon2Threads < params.Argon2Threads ||
+			p.Argon2KeyLen < params.Argon2KeyLen
+
+	case strings.HasPrefix(hashedPassword, "$2"):
+		if params.Algorithm != AlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		if err != nil {
+			return true
+		}
+		return cost < params.BcryptCost
+
+	default:
+		return hashedPassword != ""
+	}
+}
+
+func isLegacySHA256(hashedPassword string) bool {
+	if len(hashedPassword) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hashedPassword)
+	return err == nil
+}
+
+func hashArgon2id(plaintextPassword string, p Params) (string, error) {
+	salt := make([]byte, p.Argon2SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(plaintextPassword), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, p.Argon2KeyLen)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return encoded, nil
+}
+
+func matchesArgon2id(plaintextPassword, hashedPassword string) (bool, error) {
+	p, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(plaintextPassword), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, p.Argon2KeyLen)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func decodeArgon2id(hashedPassword string) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("incompatible argon2 version %d", version)
+	}
+
+	p.Algorithm = AlgorithmArgon2id
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Argon2Memory, &p.Argon2Time, &p.Argon2Threads)
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.Argon2SaltLen = uint32(len(salt))
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.Argon2KeyLen = uint32(len(key))
+
+	if !argon2ParamsValid(p) {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
 
-	return true, nil
+// argon2ParamsValid reports whether the argon2id parameters are within the bounds
+// that hashes are created and verified with.
+func argon2ParamsValid(p Params) bool {
+	return p.Argon2Time >= 1 && p.Argon2Time <= maxArgon2Time &&
+		p.Argon2Threads >= 1 && p.Argon2Threads <= maxArgon2Threads &&
+		p.Argon2Memory >= 8*uint32(p.Argon2Threads) && p.Argon2Memory <= maxArgon2Memory &&
+		p.Argon2SaltLen >= minArgon2SaltLen && p.Argon2SaltLen <= maxArgon2SaltLen &&
+		p.Argon2KeyLen >= minArgon2KeyLen && p.Argon2KeyLen <= maxArgon2KeyLen
 }
@@ -0,0 +1,264 @@
+// Package predict estimates the chance of an applicant being admitted to a program
+// from the decisions the program gave to applicants with similar backgrounds.
+//
+// The estimate is a nearest-neighbour one: the admission rate among the most similar
+// past applicants, weighted by how similar they are and pulled toward the overall
+// admission rate of the program when there is little to go on. To calibrate it, the
+// same estimate is made for each past applicant from all the others, and a logistic
+// curve fitted to how those estimates turned out maps raw estimates onto observed
+// rates.
+package predict
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"offerland.cc/internal/similarity"
+)
+
+var ErrNotEnoughCases = errors.New("predict: not enough cases")
+
+const (
+	// Neighbors is the number of most similar cases an estimate is based on.
+	Neighbors = 25
+
+	// MinCases is the number of cases needed for a prediction, and MinCalibrationCases
+	// the number needed to calibrate one, with at least MinCalibrationClass admitted
+	// and rejected cases each.
+	MinCases            = 10
+	MinCalibrationCases = 40
+	MinCalibrationClass = 5
+
+	// priorWeight is how many cases the admission rate of the program counts as.
+	priorWeight = 2
+
+	// minBandwidth keeps the kernel from weighting only exact matches when the
+	// nearest neighbours are all very close.
+	minBandwidth = 0.25
+
+	// z is the quantile of the standard normal distribution for 95% intervals.
+	z = 1.959964
+)
+
+// A Case is the background of a past applicant to a program and its decision.
+type Case struct {
+	Profile  similarity.Profile
+	Admitted bool
+}
+
+// A Neighbor is a case an estimate was based on, by index into the cases it was
+// made from.
+type Neighbor struct {
+	Index    int
+	Distance float64
+	Weight   float64
+}
+
+// A Prediction is the estimated chance of admission of an applicant.
+type Prediction struct {
+	// Probability is the calibrated chance of admission, and Low and High the bounds
+	// of its 95% interval.
+	Probability float64
+	Low         float64
+	High        float64
+
+	// Raw is the estimate before calibration, and BaseRate the admission rate of all
+	// the cases.
+	Raw      float64
+	BaseRate float64
+
+	// Cases is the number of cases the prediction was made from, and EffectiveCases
+	// how many equally weighted cases the neighbours amount to.
+	Cases          int
+	EffectiveCases float64
+
+	// Calibrated reports whether there were enough cases to calibrate the estimate.
+	// BrierScore is the mean squared error of the leave-one-out estimates, after
+	// calibration when there was one.
+	Calibrated bool
+	BrierScore float64
+
+	// Neighbors are the cases the estimate was based on, most similar first.
+	Neighbors []Neighbor
+}
+
+// Predict estimates the chance of admission of an applicant with profile query from
+// the decisions in cases.
+func Predict(query similarity.Profile, cases []Case) (*Prediction, error) {
+	if len(cases) < MinCases {
+		return nil, ErrNotEnoughCases
+	}
+
+	admitted := 0
+	for _, c := range cases {
+		if c.Admitted {
+			admitted++
+		}
+	}
+	p := &Prediction{
+		Cases:    len(cases),
+		BaseRate: float64(admitted) / float64(len(cases)),
+	}
+
+	neighbors := nearest(&query, cases, -1)
+	if len(neighbors) == 0 {
+		return nil, ErrNotEnoughCases
+	}
+	p.Raw = estimate(neighbors, cases, p.BaseRate)
+	p.Neighbors = neighbors
+
+	var sum, squares float64
+	for _, n := range neighbors {
+		sum += n.Weight
+		squares += n.Weight * n.Weight
+	}
+	p.EffectiveCases = sum * sum / squares
+
+	// Leave-one-out estimates for each case, from the others. The base rate leaves the
+	// case out too, or it would leak its decision into its own estimate.
+	raws := make([]float64, 0, len(cases))
+	outcomes := make([]bool, 0, len(cases))
+	for i := range cases {
+		others := admitted
+		if cases[i].Admitted {
+			others--
+		}
+		base := float64(others) / float64(len(cases)-1)
+
+		n := nearest(&cases[i].Profile, cases, i)
+		if len(n) == 0 {
+			continue
+		}
+		raws = append(raws, estimate(n, cases, base))
+		outcomes = append(outcomes, cases[i].Admitted)
+	}
+
+	calibrate := func(raw float64) float64 { return raw }
+	if len(raws) >= MinCalibrationCases && admitted >= MinCalibrationClass && len(cases)-admitted >= MinCalibrationClass {
+		a, b := fitPlatt(raws, outcomes)
+		calibrate = func(raw float64) float64 { return sigmoid(a*logit(raw) + b) }
+		p.Calibrated = true
+	}
+
+	for i, raw := range raws {
+		y := 0.0
+		if outcomes[i] {
+			y = 1
+		}
+		e := calibrate(raw) - y
+		p.BrierScore += e * e
+	}
+	if len(raws) > 0 {
+		p.BrierScore /= float64(len(raws))
+	}
+
+	p.Probability = calibrate(p.Raw)
+	p.Low, p.High = wilson(p.Probability, p.EffectiveCases+priorWeight)
+	return p, nil
+}
+
+// nearest returns the Neighbors cases closest to query, leaving out the case at index
+// skip, and weighs them with a Gaussian kernel as wide as the distance to the
+// farthest of them.
+func nearest(query *similarity.Profile, cases []Case, skip int) []Neighbor {
+	var neighbors []Neighbor
+	for i := range cases {
+		if i == skip {
+			continue
+		}
+		d, ok := similarity.Distance(query, &cases[i].Profile)
+		if ok {
+			neighbors = append(neighbors, Neighbor{Index: i, Distance: d})
+		}
+	}
+
+	sort.SliceStable(neighbors, func(i, j int) bool {
+		return neighbors[i].Distance < neighbors[j].Distance
+	})
+	if len(neighbors) > Neighbors {
+		neighbors = neighbors[:Neighbors]
+	}
+	if len(neighbors) == 0 {
+		return nil
+	}
+
+	h := math.Max(neighbors[len(neighbors)-1].Distance, minBandwidth)
+	for i := range neighbors {
+		u := neighbors[i].Distance / h
+		neighbors[i].Weight = math.Exp(-u * u / 2)
+	}
+	return neighbors
+}
+
+// estimate returns the weighted admission rate of the neighbours, smoothed toward
+// base.
+func estimate(neighbors []Neighbor, cases []Case, base float64) float64 {
+	admitted, total := priorWeight*base, float64(priorWeight)
+	for _, n := range neighbors {
+		if cases[n.Index].Admitted {
+			admitted += n.Weight
+		}
+		total += n.Weight
+	}
+	return admitted / total
+}
+
+// fitPlatt fits the logistic curve sigmoid(a*logit(raw)+b) to outcomes by Newton's
+// method, with a slight pull toward the identity a=1, b=0 to keep it well-behaved on
+// small or separable data.
+func fitPlatt(raws []float64, outcomes []bool) (a, b float64) {
+	const ridge = 1e-2
+
+	a, b = 1, 0
+	for iter := 0; iter < 50; iter++ {
+		// Gradient and Hessian of the negative log-likelihood plus the ridge term.
+		ga, gb := ridge*(a-1), ridge*b
+		haa, hab, hbb := ridge, 0.0, ridge
+		for i, raw := range raws {
+			x := logit(raw)
+			p := sigmoid(a*x + b)
+			y := 0.0
+			if outcomes[i] {
+				y = 1
+			}
+			w := p * (1 - p)
+			ga += (p - y) * x
+			gb += p - y
+			haa += w * x * x
+			hab += w * x
+			hbb += w
+		}
+
+		det := haa*hbb - hab*hab
+		if det <= 0 {
+			break
+		}
+		da := (hbb*ga - hab*gb) / det
+		db := (haa*gb - hab*ga) / det
+		a -= da
+		b -= db
+		if math.Abs(da) < 1e-8 && math.Abs(db) < 1e-8 {
+			break
+		}
+	}
+	return a, b
+}
+
+// wilson returns the Wilson score interval of a proportion p observed over n cases.
+func wilson(p, n float64) (low, high float64) {
+	z2 := z * z
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := z / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return math.Max(center-margin, 0), math.Min(center+margin, 1)
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// logit is the inverse of sigmoid, clamped away from 0 and 1.
+func logit(p float64) float64 {
+	p = math.Min(math.Max(p, 1e-6), 1-1e-6)
+	return math.Log(p / (1 - p))
+}
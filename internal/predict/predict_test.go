@@ -0,0 +1,188 @@
+package predict
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"offerland.cc/internal/similarity"
+)
+
+func gpa(value float64) similarity.Profile {
+	return similarity.Profile{GPA: &value}
+}
+
+// gpaCases returns n cases with GPAs spread over 2.0 to 4.0, admitted with a chance
+// that grows with the GPA.
+func gpaCases(n int, seed int64) []Case {
+	rng := rand.New(rand.NewSource(seed))
+	cases := make([]Case, n)
+	for i := range cases {
+		g := 2 + 2*rng.Float64()
+		cases[i] = Case{Profile: gpa(g), Admitted: rng.Float64() < sigmoid(4*(g-3))}
+	}
+	return cases
+}
+
+// sameCases returns n cases with the same profile, every other one admitted.
+func sameCases(n int) []Case {
+	cases := make([]Case, n)
+	for i := range cases {
+		cases[i] = Case{Profile: gpa(3.5), Admitted: i%2 == 0}
+	}
+	return cases
+}
+
+func TestPredictNeedsMinCases(t *testing.T) {
+	_, err := Predict(gpa(3.5), sameCases(MinCases-1))
+	if !errors.Is(err, ErrNotEnoughCases) {
+		t.Errorf("err = %v, want %v", err, ErrNotEnoughCases)
+	}
+
+	_, err = Predict(gpa(3.5), sameCases(MinCases))
+	if err != nil {
+		t.Errorf("err = %v with %d cases", err, MinCases)
+	}
+
+	// Cases that share nothing with the query are no cases at all.
+	cases := make([]Case, MinCases)
+	for i := range cases {
+		cases[i] = Case{Profile: similarity.Profile{Country: "TW"}}
+	}
+	_, err = Predict(gpa(3.5), cases)
+	if !errors.Is(err, ErrNotEnoughCases) {
+		t.Errorf("err = %v for cases without shared features, want %v", err, ErrNotEnoughCases)
+	}
+}
+
+func TestPredictCalibrationIsMonotone(t *testing.T) {
+	cases := gpaCases(200, 1)
+
+	var predictions []*Prediction
+	for g := 2.0; g <= 4.0; g += 0.1 {
+		p, err := Predict(gpa(g), cases)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Calibrated {
+			t.Fatal("prediction from 200 cases is not calibrated")
+		}
+		predictions = append(predictions, p)
+	}
+
+	// All predictions from the same cases share one calibration curve, which must
+	// keep the order of the raw estimates.
+	sort.Slice(predictions, func(i, j int) bool { return predictions[i].Raw < predictions[j].Raw })
+	for i := 1; i < len(predictions); i++ {
+		if predictions[i].Probability < predictions[i-1].Probability-1e-12 {
+			t.Errorf("raw %.4f calibrates to %.4f, below raw %.4f at %.4f",
+				predictions[i].Raw, predictions[i].Probability, predictions[i-1].Raw, predictions[i-1].Probability)
+		}
+	}
+
+	low, high := predictions[0], predictions[len(predictions)-1]
+	if high.Probability-low.Probability < 0.5 {
+		t.Errorf("probabilities span %.3f to %.3f, want a clear rise with the GPA", low.Probability, high.Probability)
+	}
+}
+
+func TestPredictInterval(t *testing.T) {
+	var previous *Prediction
+	for _, n := range []int{MinCases, 15, Neighbors} {
+		p, err := Predict(gpa(3.5), sameCases(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if math.Abs(p.EffectiveCases-float64(n)) > 1e-9 {
+			t.Errorf("%d identical cases: EffectiveCases = %f", n, p.EffectiveCases)
+		}
+		if p.Low > p.Probability || p.Probability > p.High {
+			t.Errorf("%d cases: interval [%f, %f] does not contain %f", n, p.Low, p.High, p.Probability)
+		}
+		if previous != nil && p.High-p.Low >= previous.High-previous.Low {
+			t.Errorf("interval of %d cases is %f wide, not narrower than %f with %d",
+				n, p.High-p.Low, previous.High-previous.Low, previous.Cases)
+		}
+		previous = p
+	}
+}
+
+func TestPredictBrierScore(t *testing.T) {
+	// Two clearly separated groups: the leave-one-out estimates should be near
+	// certain and right.
+	var separated []Case
+	for i := 0; i < 25; i++ {
+		separated = append(separated, Case{Profile: gpa(4.0), Admitted: true})
+		separated = append(separated, Case{Profile: gpa(2.0), Admitted: false})
+	}
+	p, err := Predict(gpa(4.0), separated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Calibrated || p.BrierScore > 0.05 {
+		t.Errorf("separated cases: calibrated = %v, Brier score = %f, want below 0.05", p.Calibrated, p.BrierScore)
+	}
+	if p.Probability < 0.9 {
+		t.Errorf("separated cases: probability = %f, want above 0.9", p.Probability)
+	}
+
+	// Decisions unrelated to the profile cannot be predicted better than the base
+	// rate. An estimate that saw its own decision would score far better.
+	rng := rand.New(rand.NewSource(2))
+	var noise []Case
+	for i := 0; i < 200; i++ {
+		noise = append(noise, Case{Profile: gpa(2 + 2*rng.Float64()), Admitted: rng.Intn(2) == 0})
+	}
+	p, err = Predict(gpa(3.0), noise)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.BrierScore < 0.22 {
+		t.Errorf("random decisions: Brier score = %f, want about 0.25", p.BrierScore)
+	}
+}
+
+func TestFitPlatt(t *testing.T) {
+	// Outcomes drawn from a known curve should give back its parameters.
+	rng := rand.New(rand.NewSource(3))
+	var raws []float64
+	var outcomes []bool
+	for i := 0; i < 20000; i++ {
+		raw := 0.02 + 0.96*rng.Float64()
+		raws = append(raws, raw)
+		outcomes = append(outcomes, rng.Float64() < sigmoid(2*logit(raw)-0.5))
+	}
+	a, b := fitPlatt(raws, outcomes)
+	if math.Abs(a-2) > 0.15 || math.Abs(b+0.5) > 0.15 {
+		t.Errorf("fitPlatt = %f, %f, want about 2, -0.5", a, b)
+	}
+
+	// Perfectly separable outcomes would drive the slope to infinity without the
+	// pull toward the identity.
+	raws = []float64{0.1, 0.2, 0.3, 0.7, 0.8, 0.9}
+	outcomes = []bool{false, false, false, true, true, true}
+	a, b = fitPlatt(raws, outcomes)
+	if math.IsNaN(a) || math.IsInf(a, 0) || math.IsNaN(b) || a <= 0 || a > 100 {
+		t.Errorf("fitPlatt on separable data = %f, %f", a, b)
+	}
+}
+
+func TestWilson(t *testing.T) {
+	for _, p := range []float64{0, 0.01, 0.3, 0.5, 0.9, 1} {
+		previousWidth := math.Inf(1)
+		for _, n := range []float64{2, 5, 10, 27, 100, 1000} {
+			low, high := wilson(p, n)
+			// The bounds meet p at 0 and 1, up to rounding.
+			if low < 0 || high > 1 || low > p+1e-12 || p > high+1e-12 {
+				t.Errorf("wilson(%v, %v) = [%f, %f]", p, n, low, high)
+			}
+			if high-low >= previousWidth {
+				t.Errorf("wilson(%v, %v) is %f wide, not narrower than with fewer cases", p, n, high-low)
+			}
+			previousWidth = high - low
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package ratelimit implements token-bucket rate limiting. Buckets are kept in a
+// Store, either in memory for a single instance or in Postgres so that all instances
+// of the API share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Limit allows Burst requests at once, refilled at Burst per Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses limits written as "<requests>/<period>", e.g. "60/1m". An empty
+// string or "0" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q, want <requests>/<period>", s)
+	}
+
+	burst, err := strconv.Atoi(requests)
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid number of requests in %q", s)
+	}
+
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid period in %q", s)
+	}
+
+	return Limit{Burst: burst, Period: duration}, nil
+}
+
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+// rate returns the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// Result describes the state of a bucket after a request was counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request will be allowed, if this one
+	// was not.
+	RetryAfter time.Duration
+}
+
+// Store takes one token from the bucket identified by key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// take refills a bucket holding tokens as of last, and takes one token if there is
+// one. It returns the new number of tokens.
+func take(tokens float64, last time.Time, limit Limit, now time.Time) (float64, Result) {
+	elapsed := now.Sub(last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.rate())
+
+	result := Result{Limit: limit.Burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((float64(limit.Burst) - tokens) / limit.rate())
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Limiter applies named limits, e.g. "global" or "auth", to keys such as client
+// addresses.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Allow counts a request against the named limit for key. Requests under a limit
+// that is not configured are always allowed, and ok is false.
+func (l *Limiter) Allow(ctx context.Context, name, key string) (result Result, ok bool, err error) {
+	limit, found := l.limits[name]
+	if !found || !limit.Enabled() {
+		return Result{Allowed: true}, false, nil
+	}
+
+	result, err = l.store.Take(ctx, name+":"+key, limit, time.Now())
+	if err != nil {
+		return Result{}, false, err
+	}
+	return result, true, nil
+}
+
+// DeleteExpired removes the buckets that have filled up again from stores that do
+// not do so on their own, and returns how many there were.
+func (l *Limiter) DeleteExpired(ctx context.Context) (int64, error) {
+	store, ok := l.store.(interface {
+		DeleteExpired(ctx context.Context) (int64, error)
+	})
+	if !ok {
+		return 0, nil
+	}
+	return store.DeleteExpired(ctx)
+}
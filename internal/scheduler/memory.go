@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryHistory is how many runs MemoryStore remembers.
+const memoryHistory = 1000
+
+// MemoryStore claims runs and keeps their history in memory. It is only suitable for
+// a single instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	running map[string]bool
+	last    map[string]time.Time
+	runs    []Run
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{running: map[string]bool{}, last: map[string]time.Time{}}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, job string, scheduledAt time.Time) (*Run, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running[job] || !scheduledAt.After(s.last[job]) {
+		return nil, false, nil
+	}
+	s.running[job] = true
+	s.last[job] = scheduledAt
+
+	s.nextID++
+	run := &Run{
+		ID:          s.nextID,
+		Job:         job,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		Status:      StatusRunning,
+	}
+	run.release = func(ctx context.Context) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.running, job)
+		return nil
+	}
+	return run, true, nil
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, run *Run) error {
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+
+	s.mu.Lock()
+	s.runs = append(s.runs, *run)
+	if len(s.runs) > memoryHistory {
+		s.runs = s.runs[len(s.runs)-memoryHistory:]
+	}
+	s.mu.Unlock()
+
+	return run.release(ctx)
+}
+
+func (s *MemoryStore) Runs(ctx context.Context, job string, limit int) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := []Run{}
+	for i := len(s.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if job == "" || s.runs[i].Job == job {
+			runs = append(runs, s.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.runs[:0]
+	for _, run := range s.runs {
+		if !run.StartedAt.Before(before) {
+			kept = append(kept, run)
+		}
+	}
+	pruned := int64(len(s.runs) - len(kept))
+	s.runs = kept
+	return pruned, nil
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreClaim(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	at := date(2024, 1, 1, 3, 0)
+
+	run, ok, err := store.Claim(ctx, "cleanup", at)
+	if err != nil || !ok {
+		t.Fatalf("first claim: ok = %v, err = %v", ok, err)
+	}
+
+	_, ok, err = store.Claim(ctx, "cleanup", at)
+	if err != nil || ok {
+		t.Errorf("second claim of the same run: ok = %v, err = %v", ok, err)
+	}
+	_, ok, err = store.Claim(ctx, "cleanup", at.Add(time.Hour))
+	if err != nil || ok {
+		t.Errorf("claim of a later run while one is running: ok = %v, err = %v", ok, err)
+	}
+	_, ok, err = store.Claim(ctx, "digest", at)
+	if err != nil || !ok {
+		t.Errorf("claim of another job: ok = %v, err = %v", ok, err)
+	}
+
+	run.Status = StatusSucceeded
+	err = store.Finish(ctx, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok, err = store.Claim(ctx, "cleanup", at)
+	if err != nil || ok {
+		t.Errorf("claim of a finished run: ok = %v, err = %v", ok, err)
+	}
+	_, ok, err = store.Claim(ctx, "cleanup", at.Add(-time.Hour))
+	if err != nil || ok {
+		t.Errorf("claim of an earlier run: ok = %v, err = %v", ok, err)
+	}
+	_, ok, err = store.Claim(ctx, "cleanup", at.Add(time.Hour))
+	if err != nil || !ok {
+		t.Errorf("claim of the next run: ok = %v, err = %v", ok, err)
+	}
+
+	runs, err := store.Runs(ctx, "cleanup", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID || runs[0].Status != StatusSucceeded || runs[0].FinishedAt == nil {
+		t.Errorf("runs = %+v, want the finished run", runs)
+	}
+}
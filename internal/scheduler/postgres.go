@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"hash/fnv"
+	"time"
+)
+
+// PostgresStore elects the instance that runs a job with a Postgres advisory lock, and
+// keeps the history of runs in the job_runs table. The lock is held on a dedicated
+// connection for as long as the run lasts, so it is released even if the instance
+// dies in the middle of a run.
+type PostgresStore struct {
+	DB *sql.DB
+	// Instance identifies this instance in the history, e.g. its hostname.
+	Instance string
+}
+
+func NewPostgresStore(db *sql.DB, instance string) *PostgresStore {
+	return &PostgresStore{DB: db, Instance: instance}
+}
+
+// lockKey maps a job name onto the 64-bit key space of advisory locks.
+func lockKey(job string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("scheduler:" + job))
+	return int64(h.Sum64())
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, job string, scheduledAt time.Time) (*Run, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := lockKey(job)
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release := func(ctx context.Context) error {
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key)
+		if err != nil {
+			// Never hand a connection that may still hold the lock back to the pool.
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+		return err
+	}
+
+	// An instance whose timer fired late may try to claim a run that another
+	// instance has already finished; the unique key on (job, scheduled_at) stops it.
+	query := `
+		INSERT INTO job_runs (job, scheduled_at, instance)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (job, scheduled_at) DO NOTHING
+		RETURNING id, started_at, status`
+
+	run := &Run{Job: job, Instance: s.Instance, ScheduledAt: scheduledAt, release: release}
+
+	err = conn.QueryRowContext(ctx, query, job, scheduledAt, s.Instance).Scan(&run.ID, &run.StartedAt, &run.Status)
+	if err != nil {
+		releaseErr := release(context.Background())
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, false, releaseErr
+		default:
+			return nil, false, err
+		}
+	}
+
+	return run, true, nil
+}
+
+func (s *PostgresStore) Finish(ctx context.Context, run *Run) error {
+	query := `
+		UPDATE job_runs
+		SET status = $1, error = $2, finished_at = NOW()
+		WHERE id = $3
+		RETURNING finished_at`
+
+	var finishedAt time.Time
+	err := s.DB.QueryRowContext(ctx, query, run.Status, run.Error, run.ID).Scan(&finishedAt)
+	if err == nil {
+		run.FinishedAt = &finishedAt
+	}
+
+	releaseErr := run.release(ctx)
+	if err != nil {
+		return err
+	}
+	return releaseErr
+}
+
+func (s *PostgresStore) Runs(ctx context.Context, job string, limit int) ([]Run, error) {
+	query := `
+		SELECT id, job, instance, scheduled_at, started_at, finished_at, status, error
+		FROM job_runs
+		WHERE job = $1 OR $1 = ''
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, job, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		var run Run
+		err := rows.Scan(&run.ID, &run.Job, &run.Instance, &run.ScheduledAt, &run.StartedAt, &run.FinishedAt, &run.Status, &run.Error)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM job_runs WHERE started_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
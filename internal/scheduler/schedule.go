@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule returns the next time a job is due after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a schedule. It accepts the five fields of a crontab line (minute,
+// hour, day of month, month, day of week), the shorthands @yearly, @monthly, @weekly,
+// @daily and @hourly, and "@every <duration>" for fixed intervals.
+//
+// Cron fields accept "*", single values, ranges ("1-5"), lists ("1,15") and steps
+// ("*/15", "0-30/10"). Day of week runs from 0 (Sunday) to 6; 7 is Sunday as well.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("scheduler: invalid schedule %q: %w", spec, err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("scheduler: invalid schedule %q: interval must be at least 1s", spec)
+		}
+		return every(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("scheduler: invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	var s cron
+	var err error
+	for i, bounds := range cronFields {
+		s.fields[i], err = parseField(fields[i], bounds.min, bounds.max)
+		if err != nil {
+			return nil, fmt.Errorf("scheduler: invalid schedule %q: %s: %w", spec, bounds.name, err)
+		}
+	}
+
+	// Sunday can be written as 0 or 7.
+	if s.fields[dow]&(1<<7) != 0 {
+		s.fields[dow] |= 1
+	}
+	s.domRestricted = !strings.HasPrefix(fields[dom], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[dow], "*")
+
+	return s, nil
+}
+
+// every runs at fixed multiples of the interval, rather than relative to when the
+// scheduler started, so that all instances agree on when a run is due.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	interval := time.Duration(e)
+	return t.Truncate(interval).Add(interval)
+}
+
+const (
+	minute = iota
+	hour
+	dom
+	month
+	dow
+)
+
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cron holds one bit per allowed value of every field.
+type cron struct {
+	fields        [5]uint64
+	domRestricted bool
+	dowRestricted bool
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = min, max
+		case strings.Contains(rangePart, "-"):
+			loPart, hiPart, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(loPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q", loPart)
+			}
+			if hi, err = strconv.Atoi(hiPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q", hiPart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo, hi = value, value
+			// "5/10" means from 5 to the end in steps of 10.
+			if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", rangePart, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s cron) has(field int, value int) bool {
+	return s.fields[field]&(1<<value) != 0
+}
+
+// dayMatches applies the crontab rule that, when both day of month and day of week
+// are restricted, a day matching either one is due.
+func (s cron) dayMatches(t time.Time) bool {
+	domMatch := s.has(dom, t.Day())
+	dowMatch := s.has(dow, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Next returns the first minute after t that matches the schedule, in the location
+// of t. It gives up, returning the zero time, on schedules that never match, like
+// February 30th.
+func (s cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.has(month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.has(hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.has(minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", date(2024, 1, 1, 10, 7).Add(30 * time.Second), date(2024, 1, 1, 10, 8)},
+		{"strictly after", "7 10 * * *", date(2024, 1, 1, 10, 7), date(2024, 1, 2, 10, 7)},
+		{"step", "*/15 * * * *", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 10, 15)},
+		{"step from a value", "5/10 * * * *", date(2024, 1, 1, 10, 6), date(2024, 1, 1, 10, 15)},
+		{"list", "0 8,20 * * *", date(2024, 1, 1, 9, 0), date(2024, 1, 1, 20, 0)},
+		{"stepped range", "0-30/10 9-17 * * 1-5", date(2024, 1, 1, 17, 31), date(2024, 1, 2, 9, 0)},
+		{"range skips the weekend", "0-30/10 9-17 * * 1-5", date(2024, 1, 6, 12, 0), date(2024, 1, 8, 9, 0)},
+		{"sunday as 0", "30 9 * * 0", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 9, 30)},
+		{"sunday as 7", "30 9 * * 7", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 9, 30)},
+		{"range ending on 7", "0 0 * * 6-7", date(2024, 1, 1, 0, 0), date(2024, 1, 6, 0, 0)},
+		{"day of week only", "0 0 * * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"day of month only", "0 0 13 * *", date(2024, 1, 1, 0, 0), date(2024, 1, 13, 0, 0)},
+		// With both restricted, the 13th or any Friday is due.
+		{"either day matches: friday", "0 0 13 * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"either day matches: 13th", "0 0 13 * 5", date(2024, 1, 12, 0, 0), date(2024, 1, 13, 0, 0)},
+		{"stepped day of month is unrestricted", "0 0 */2 * 5", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		{"skips short months", "0 0 31 * *", date(2024, 1, 31, 0, 0), date(2024, 3, 31, 0, 0)},
+		{"last minute of the year", "59 23 31 12 *", date(2024, 12, 31, 23, 59), date(2025, 12, 31, 23, 59)},
+		{"leap day", "0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"yearly", "@yearly", date(2024, 6, 15, 12, 0), date(2025, 1, 1, 0, 0)},
+		{"weekly", "@weekly", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 0, 0)},
+		{"hourly", "@hourly", date(2024, 1, 1, 23, 30), date(2024, 1, 2, 0, 0)},
+		{"every", "@every 1h", date(2024, 1, 1, 10, 7), date(2024, 1, 1, 11, 0)},
+		{"never: february 30th", "0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+		{"never: april 31st", "0 0 31 4 *", date(2024, 1, 1, 0, 0), time.Time{}},
+		// The next leap day after 2096 is in 2104, as 2100 is not a leap year.
+		{"beyond the search limit", "0 0 29 2 *", date(2096, 3, 1, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := schedule.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+
+	schedule, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2024, 1, 1, 10, 0, 0, 0, taipei))
+	want := time.Date(2024, 1, 2, 9, 0, 0, 0, taipei)
+	if !got.Equal(want) || got.Location() != taipei {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+		"@every",
+		"@every x",
+		"@every 500ms",
+		"@sometimes",
+	}
+
+	for _, spec := range specs {
+		_, err := Parse(spec)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
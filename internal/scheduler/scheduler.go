@@ -0,0 +1,218 @@
+// Package scheduler runs periodic jobs inside the API process. Every instance runs
+// the same scheduler, and a Store makes sure each due run of a job happens on one
+// instance only: in memory for a single instance, or through Postgres advisory locks
+// when several instances share a database. The Store also keeps the history of runs.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"offerland.cc/internal/leveledlog"
+)
+
+// DefaultTimeout bounds a run of a job that does not set its own timeout.
+const DefaultTimeout = 10 * time.Minute
+
+// Run statuses.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusTimedOut  = "timed_out"
+)
+
+// A Job is a unit of periodic work. Run should return once ctx is done.
+type Job struct {
+	Name string
+	// Spec is the schedule of the job, in the syntax accepted by Parse.
+	Spec    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+
+	schedule Schedule
+}
+
+// A Run is one execution of a job.
+type Run struct {
+	ID          int64      `json:"id"`
+	Job         string     `json:"job"`
+	Instance    string     `json:"instance"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+
+	// release frees the job for the next run, once the outcome is recorded.
+	release func(ctx context.Context) error
+}
+
+// Store claims runs and records their outcome.
+type Store interface {
+	// Claim starts the run of job due at scheduledAt. It returns false if another
+	// instance is still running the job or has already run it for scheduledAt.
+	Claim(ctx context.Context, job string, scheduledAt time.Time) (*Run, bool, error)
+	// Finish records the outcome of a run and frees the job.
+	Finish(ctx context.Context, run *Run) error
+	// Runs returns the latest runs of job, or of all jobs if job is empty, newest
+	// first.
+	Runs(ctx context.Context, job string, limit int) ([]Run, error)
+	// Prune deletes the runs that started before before.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Scheduler struct {
+	store  Store
+	logger *leveledlog.Logger
+
+	mu      sync.Mutex
+	jobs    []*Job
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func New(store Store, logger *leveledlog.Logger) *Scheduler {
+	return &Scheduler{store: store, logger: logger}
+}
+
+// Add registers a job. Jobs must be added before Start.
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return errors.New("scheduler: a job needs a name and a function")
+	}
+
+	schedule, err := Parse(job.Spec)
+	if err != nil {
+		return err
+	}
+	job.schedule = schedule
+	if job.Timeout <= 0 {
+		job.Timeout = DefaultTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.jobs {
+		if existing.Name == job.Name {
+			return fmt.Errorf("scheduler: job %q is already registered", job.Name)
+		}
+	}
+	s.jobs = append(s.jobs, &job)
+	return nil
+}
+
+// Start runs every registered job on its schedule until Stop is called.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		s.running.Add(1)
+		go func(job *Job) {
+			defer s.running.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Stop stops scheduling new runs, cancels the context of the runs in progress and
+// waits for them to return.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.running.Wait()
+}
+
+// Runs returns the latest runs of job, or of all jobs if job is empty.
+func (s *Scheduler) Runs(ctx context.Context, job string, limit int) ([]Run, error) {
+	return s.store.Runs(ctx, job, limit)
+}
+
+// Prune deletes the history of runs that started before before.
+func (s *Scheduler) Prune(ctx context.Context, before time.Time) (int64, error) {
+	return s.store.Prune(ctx, before)
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *Job) {
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warning("Job %s will never run again", job.Name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.execute(ctx, job, next)
+	}
+}
+
+// execute runs the job for the run due at scheduledAt, if this instance gets to claim
+// it.
+func (s *Scheduler) execute(ctx context.Context, job *Job, scheduledAt time.Time) {
+	run, ok, err := s.store.Claim(ctx, job.Name, scheduledAt)
+	if err != nil {
+		s.logger.Error(fmt.Errorf("scheduler: claiming %s: %w", job.Name, err))
+		return
+	}
+	if !ok {
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	err = safeRun(runCtx, job.Run)
+	cancel()
+
+	switch {
+	case err == nil:
+		run.Status = StatusSucceeded
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		run.Status = StatusTimedOut
+		run.Error = err.Error()
+	default:
+		run.Status = StatusFailed
+		run.Error = err.Error()
+	}
+	if err != nil {
+		s.logger.Error(fmt.Errorf("scheduler: job %s: %w", job.Name, err))
+	}
+
+	// The outcome is recorded even when the scheduler is shutting down.
+	finishCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = s.store.Finish(finishCtx, run)
+	if err != nil {
+		s.logger.Error(fmt.Errorf("scheduler: finishing %s: %w", job.Name, err))
+	}
+}
+
+// safeRun turns a panic of the job into an error, so one broken job cannot take the
+// process down.
+func safeRun(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,180 @@
+// Package similarity compares applicants by their academic background and by the
+// programs they applied to.
+package similarity
+
+import (
+	"math"
+	"strings"
+)
+
+// A Profile holds the features applicants are compared on. Nil and empty fields are
+// unknown and left out of comparisons. GPA is on a 4.0 scale, and the categorical
+// fields should be canonical, like catalog IDs, or at least normalized names.
+type Profile struct {
+	GPA                  *float64
+	GREVerbal            *float64
+	GREQuant             *float64
+	GREWriting           *float64
+	TOEFL                *float64
+	IELTS                *float64
+	WorkExperienceMonths *float64
+	Publications         *float64
+
+	UndergradSchool string
+	UndergradMajor  string
+	Country         string
+}
+
+// A numeric feature counts as one unit of distance per scale of difference, up to
+// maxUnits, so that a single outlier cannot outweigh everything else.
+type numericFeature struct {
+	value  func(p *Profile) *float64
+	scale  float64
+	weight float64
+}
+
+const maxUnits = 3
+
+var numericFeatures = []numericFeature{
+	{func(p *Profile) *float64 { return p.GPA }, 0.3, 3},
+	{func(p *Profile) *float64 { return p.GREQuant }, 5, 2},
+	{func(p *Profile) *float64 { return p.GREVerbal }, 5, 1.5},
+	{func(p *Profile) *float64 { return p.GREWriting }, 0.5, 0.5},
+	{func(p *Profile) *float64 { return p.TOEFL }, 6, 1},
+	{func(p *Profile) *float64 { return p.IELTS }, 0.5, 1},
+	{func(p *Profile) *float64 { return p.WorkExperienceMonths }, 24, 1},
+	{func(p *Profile) *float64 { return p.Publications }, 2, 1},
+}
+
+// Categorical features count as one unit of distance when they differ.
+type categoricalFeature struct {
+	value  func(p *Profile) string
+	weight float64
+}
+
+var categoricalFeatures = []categoricalFeature{
+	{func(p *Profile) string { return p.UndergradSchool }, 1.5},
+	{func(p *Profile) string { return p.UndergradMajor }, 1},
+	{func(p *Profile) string { return p.Country }, 0.5},
+}
+
+// Distance returns how far apart the backgrounds of a and b are, from 0 for the same
+// background. Differences are averaged over the features both profiles have, and
+// each feature a has but b lacks adds to the distance, so that b is not made to look
+// close by leaving things out. ok is false when the profiles share no features.
+func Distance(a, b *Profile) (distance float64, ok bool) {
+	var sum, shared, known float64
+
+	for _, f := range numericFeatures {
+		x, y := f.value(a), f.value(b)
+		if x == nil {
+			continue
+		}
+		known += f.weight
+		if y == nil {
+			continue
+		}
+		units := math.Min(math.Abs(*x-*y)/f.scale, maxUnits)
+		sum += f.weight * units * units
+		shared += f.weight
+	}
+
+	for _, f := range categoricalFeatures {
+		x, y := f.value(a), f.value(b)
+		if x == "" {
+			continue
+		}
+		known += f.weight
+		if y == "" {
+			continue
+		}
+		if !strings.EqualFold(x, y) {
+			sum += f.weight
+		}
+		shared += f.weight
+	}
+
+	if shared == 0 {
+		return 0, false
+	}
+	return math.Sqrt(sum/shared) + (1 - shared/known), true
+}
+
+// Score turns a distance into a similarity between 0 and 1, 1 for the same
+// background.
+func Score(distance float64) float64 {
+	return 1 / (1 + distance)
+}
+
+// An Applicant is what applicants are compared on: their background, nil when it is
+// not known, and the programs they applied to, as keys that are equal for the same
+// program.
+type Applicant struct {
+	Profile  *Profile
+	Programs []string
+}
+
+// A Match is how similar two applicants are, each score between 0 and 1.
+type Match struct {
+	Score float64
+	// Background is the similarity of the backgrounds, and Programs the Jaccard index
+	// of the programs applied to. Each is nil when either applicant lacks it.
+	Background     *float64
+	Programs       *float64
+	SharedPrograms int
+}
+
+// ProgramWeight is the share of the programs applied to in the score of a Match, with
+// the background making up the rest. When only one of them can be compared, it is
+// the score on its own.
+const ProgramWeight = 0.4
+
+// Compare returns how similar b is to a.
+func Compare(a, b *Applicant) Match {
+	var m Match
+	if a.Profile != nil && b.Profile != nil {
+		if d, ok := Distance(a.Profile, b.Profile); ok {
+			score := Score(d)
+			m.Background = &score
+		}
+	}
+	if len(a.Programs) > 0 && len(b.Programs) > 0 {
+		intersection, union := overlap(a.Programs, b.Programs)
+		score := float64(intersection) / float64(union)
+		m.Programs = &score
+		m.SharedPrograms = intersection
+	}
+
+	switch {
+	case m.Background != nil && m.Programs != nil:
+		m.Score = (1-ProgramWeight)**m.Background + ProgramWeight**m.Programs
+	case m.Background != nil:
+		m.Score = *m.Background
+	case m.Programs != nil:
+		m.Score = *m.Programs
+	}
+	return m
+}
+
+// overlap counts the distinct elements both a and b have, and those either has.
+func overlap[T comparable](a, b []T) (intersection, union int) {
+	set := make(map[T]bool, len(a))
+	for _, x := range a {
+		set[x] = true
+	}
+
+	union = len(set)
+	seen := make(map[T]bool, len(b))
+	for _, x := range b {
+		if seen[x] {
+			continue
+		}
+		seen[x] = true
+		if set[x] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+	return intersection, union
+}
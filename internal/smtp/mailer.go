@@ -3,77 +3,105 @@ package smtp
 import (
 	"bytes"
 	"html/template"
-	"time"
+	"io/fs"
+	"strings"
 
-	"gopkg.in/mail.v2"
 	"offerland.cc/assets"
 	"offerland.cc/internal/funcs"
 )
 
 type Mailer struct {
-	dialer *mail.Dialer
-	from   string
+	transport Transport
+	from      string
 }
 
-func NewMailer(host string, port int, username, password, from string) *Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
-
+func NewMailer(transport Transport, from string) *Mailer {
 	return &Mailer{
-		dialer: dialer,
-		from:   from,
+		transport: transport,
+		from:      from,
 	}
 }
 
 func (m *Mailer) Send(recipient string, data any, patterns ...string) error {
-	for i := range patterns {
-		patterns[i] = "emails/" + patterns[i]
+	return m.SendLocalized(recipient, "", data, patterns...)
+}
+
+// SendLocalized is like Send, but prefers the templates translated into locale.
+func (m *Mailer) SendLocalized(recipient string, locale string, data any, patterns ...string) error {
+	msg, err := m.Render(recipient, locale, data, patterns...)
+	if err != nil {
+		return err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.from)
+	return m.transport.Deliver(msg)
+}
+
+// Render executes the "subject", "plainBody" and optional "htmlBody" templates
+// found in the given email template files and returns the resulting message
+// without delivering it. Each template is looked up in emails/<locale>/ first, then
+// in the directory of the locale's base language (emails/zh/ for zh-TW), and
+// finally falls back to the default templates in emails/.
+func (m *Mailer) Render(recipient string, locale string, data any, patterns ...string) (*Message, error) {
+	fullPatterns := make([]string, len(patterns))
+	for i := range patterns {
+		fullPatterns[i] = templatePath(locale, patterns[i])
+	}
 
-	ts, err := template.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, patterns...)
+	ts, err := template.New("").Funcs(funcs.TemplateFuncs).ParseFS(assets.EmbeddedFiles, fullPatterns...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	msg := &Message{
+		To:   recipient,
+		From: m.from,
 	}
 
 	subject := new(bytes.Buffer)
 	err = ts.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msg.SetHeader("Subject", subject.String())
+	msg.Subject = subject.String()
 
 	plainBody := new(bytes.Buffer)
 	err = ts.ExecuteTemplate(plainBody, "plainBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	msg.SetBody("text/plain", plainBody.String())
+	msg.PlainBody = plainBody.String()
 
 	if ts.Lookup("htmlBody") != nil {
 		htmlBody := new(bytes.Buffer)
 		err = ts.ExecuteTemplate(htmlBody, "htmlBody", data)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		msg.AddAlternative("text/html", htmlBody.String())
+		msg.HTMLBody = htmlBody.String()
 	}
 
-	for i := 1; i <= 3; i++ {
-		err = m.dialer.DialAndSend(msg)
-		// If it sends correctly, return nil
-		if nil == err {
-			return nil
+	return msg, nil
+}
+
+func templatePath(locale string, pattern string) string {
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, "emails/"+locale+"/"+pattern)
+
+		if base, _, found := strings.Cut(locale, "-"); found {
+			candidates = append(candidates, "emails/"+base+"/"+pattern)
 		}
+	}
 
-		time.Sleep(2 * time.Second)
+	for _, candidate := range candidates {
+		matches, err := fs.Glob(assets.EmbeddedFiles, candidate)
+		if err == nil && len(matches) > 0 {
+			return candidate
+		}
 	}
 
-	return err
+	return "emails/" + pattern
 }
@@ -0,0 +1,94 @@
+package smtp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendLocalizedActivation(t *testing.T) {
+	data := map[string]any{
+		"username":       "ada",
+		"passcode":       "123456",
+		"activationLink": "https://offerland.cc/activate/abc",
+	}
+
+	tests := []struct {
+		locale  string
+		subject string
+		plain   []string
+		html    []string
+	}{
+		{
+			locale:  "en",
+			subject: "Welcome to OfferLand!",
+			plain:   []string{"Hi ada!", "Here is your activation code 123456", "Enter it at https://offerland.cc/activate/abc"},
+			html:    []string{"<p>Hi ada!</p>", "activation code 123456", `<a href="https://offerland.cc/activate/abc">here</a>`},
+		},
+		{
+			locale:  "zh-TW",
+			subject: "歡迎加入 OfferLand！",
+			plain:   []string{"ada 您好！", "您的啟用驗證碼為 123456", "請前往 https://offerland.cc/activate/abc 輸入驗證碼"},
+			html:    []string{"<p>ada 您好！</p>", "您的啟用驗證碼為 123456", `<a href="https://offerland.cc/activate/abc">前往此處</a>`},
+		},
+		{
+			// Locales without translations fall back to English.
+			locale:  "fr",
+			subject: "Welcome to OfferLand!",
+			plain:   []string{"Hi ada!"},
+			html:    []string{"<p>Hi ada!</p>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			transport := NewCaptureTransport()
+			mailer := NewMailer(transport, "OfferLand <no-reply@offerland.cc>")
+
+			err := mailer.SendLocalized("ada@example.com", tt.locale, data, "user_activation.tmpl")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messages := transport.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("delivered %d messages, want 1", len(messages))
+			}
+			msg := messages[0]
+
+			if msg.To != "ada@example.com" || msg.From != "OfferLand <no-reply@offerland.cc>" {
+				t.Errorf("To = %q, From = %q", msg.To, msg.From)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.subject)
+			}
+			for _, want := range tt.plain {
+				if !strings.Contains(msg.PlainBody, want) {
+					t.Errorf("plain body does not contain %q:\n%s", want, msg.PlainBody)
+				}
+			}
+			for _, want := range tt.html {
+				if !strings.Contains(msg.HTMLBody, want) {
+					t.Errorf("HTML body does not contain %q:\n%s", want, msg.HTMLBody)
+				}
+			}
+		})
+	}
+}
+
+func TestSendLocalizedWithoutActivationLink(t *testing.T) {
+	transport := NewCaptureTransport()
+	mailer := NewMailer(transport, "no-reply@offerland.cc")
+
+	err := mailer.SendLocalized("ada@example.com", "zh-TW", map[string]any{"username": "ada", "passcode": "123456"}, "user_activation.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := transport.Last()
+	if !ok {
+		t.Fatal("nothing was delivered")
+	}
+	if strings.Contains(msg.PlainBody, "請前往") || strings.Contains(msg.HTMLBody, "<a ") {
+		t.Errorf("message without a link mentions one:\n%s\n%s", msg.PlainBody, msg.HTMLBody)
+	}
+}
@@ -0,0 +1,172 @@
+package smtp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/mail.v2"
+)
+
+// Message is a fully rendered email, ready to be handed to a Transport.
+type Message struct {
+	To        string
+	From      string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Transport delivers rendered messages. The Mailer renders templates and hands the
+// result to a Transport, so the delivery mechanism can be swapped without touching
+// the handlers that send email.
+type Transport interface {
+	Deliver(msg *Message) error
+}
+
+func (msg *Message) toMailMessage() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+
+	if msg.HTMLBody != "" {
+		m.AddAlternative("text/html", msg.HTMLBody)
+	}
+
+	return m
+}
+
+// SMTPTransport sends messages through an SMTP server, retrying up to three times.
+type SMTPTransport struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPTransport{dialer: dialer}
+}
+
+func (t *SMTPTransport) Deliver(msg *Message) error {
+	var err error
+
+	for i := 1; i <= 3; i++ {
+		err = t.dialer.DialAndSend(msg.toMailMessage())
+		// If it sends correctly, return nil
+		if nil == err {
+			return nil
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+
+	return err
+}
+
+// FileTransport writes every message as an RFC 5322 .eml file into the "new"
+// subdirectory of a maildir, so outgoing mail can be inspected during local
+// development without an SMTP server.
+type FileTransport struct {
+	dir string
+}
+
+func NewFileTransport(dir string) (*FileTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Deliver(msg *Message) error {
+	randomBytes := make([]byte, 8)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%s.eml", time.Now().UnixNano(), hex.EncodeToString(randomBytes))
+
+	// Write into tmp first and then rename into new, so that readers never see a
+	// partially written file.
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.toMailMessage().WriteTo(f)
+	if err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(t.dir, "new", name))
+}
+
+// CaptureTransport keeps delivered messages in memory. It is intended for tests,
+// which can inspect the rendered subject and bodies of every message sent.
+type CaptureTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewCaptureTransport() *CaptureTransport {
+	return &CaptureTransport{}
+}
+
+func (t *CaptureTransport) Deliver(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of every message delivered so far.
+func (t *CaptureTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	messages := make([]Message, len(t.messages))
+	copy(messages, t.messages)
+	return messages
+}
+
+// Last returns the most recently delivered message, or false if nothing has been
+// delivered yet.
+func (t *CaptureTransport) Last() (Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.messages) == 0 {
+		return Message{}, false
+	}
+
+	return t.messages[len(t.messages)-1], true
+}
+
+// Reset discards all captured messages.
+func (t *CaptureTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
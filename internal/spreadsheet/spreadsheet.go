@@ -0,0 +1,121 @@
+// Package spreadsheet reads tables from the CSV and XLSX files people export from
+// their spreadsheet apps. The first non-empty row of a table is its header. Every
+// cell is read as text; XLSX dates come out as YYYY-MM-DD.
+package spreadsheet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrEmpty             = errors.New("spreadsheet: the file has no rows")
+	ErrUnsupportedFormat = errors.New("spreadsheet: unsupported format, save the file as .xlsx or .csv")
+)
+
+// A Table is the content of a CSV file or of one sheet of a workbook.
+type Table struct {
+	Header []string
+	Rows   []Row
+
+	// Sheet is the sheet the table was read from, and Sheets all the sheets of the
+	// workbook, in order. Both are empty for CSV files.
+	Sheet  string
+	Sheets []string
+}
+
+// A Row holds the cells of a row under the header, with as many cells as the header
+// has columns. Number is the row number shown by spreadsheet apps, from 1.
+type Row struct {
+	Number int
+	Cells  []string
+}
+
+// Read reads a table from a CSV or XLSX file, telling them apart by their content.
+// For workbooks, sheet names the sheet to read, the first one when empty.
+func Read(data []byte, sheet string) (*Table, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return ReadXLSX(data, sheet)
+	case bytes.HasPrefix(data, []byte("\xd0\xcf\x11\xe0")):
+		// The binary format of Excel 97-2003.
+		return nil, ErrUnsupportedFormat
+	default:
+		return ReadCSV(bytes.NewReader(data))
+	}
+}
+
+// ReadCSV reads a table from a CSV file. Rows may have any number of fields.
+func ReadCSV(r io.Reader) (*Table, error) {
+	br := bufio.NewReader(r)
+	// Spreadsheets like to start UTF-8 files with a byte order mark.
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("spreadsheet: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, Row{Number: line, Cells: record})
+	}
+	return newTable(rows)
+}
+
+// newTable takes the first non-empty row as the header, and drops empty rows.
+func newTable(rows []Row) (*Table, error) {
+	table := &Table{}
+	for _, row := range rows {
+		for i := range row.Cells {
+			row.Cells[i] = strings.TrimSpace(row.Cells[i])
+		}
+		if isEmpty(row.Cells) {
+			continue
+		}
+
+		if table.Header == nil {
+			table.Header = trimTrailingEmpty(row.Cells)
+			continue
+		}
+
+		cells := make([]string, len(table.Header))
+		copy(cells, row.Cells)
+		table.Rows = append(table.Rows, Row{Number: row.Number, Cells: cells})
+	}
+	if table.Header == nil {
+		return nil, ErrEmpty
+	}
+	return table, nil
+}
+
+func isEmpty(cells []string) bool {
+	for _, cell := range cells {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func trimTrailingEmpty(cells []string) []string {
+	n := len(cells)
+	for n > 0 && cells[n-1] == "" {
+		n--
+	}
+	return cells[:n]
+}
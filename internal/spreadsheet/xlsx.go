@@ -0,0 +1,303 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxXLSXPart bounds the uncompressed size of a part of a workbook, so that a small
+// upload cannot unpack into gigabytes.
+const maxXLSXPart = 64 << 20
+
+// Parts of a workbook, trimmed to the elements that are read.
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			S      int      `xml:"s,attr"`
+			V      string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX reads a table from the sheet of an XLSX workbook, the first sheet when
+// sheet is empty.
+func ReadXLSX(data []byte, sheet string) (*Table, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	parts := map[string]*zip.File{}
+	for _, file := range archive.File {
+		parts[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	var workbook xlsxWorkbook
+	err = readXLSXPart(parts, "xl/workbook.xml", &workbook)
+	if err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, ErrEmpty
+	}
+
+	var rels xlsxRelationships
+	err = readXLSXPart(parts, "xl/_rels/workbook.xml.rels", &rels)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheets []string
+	relationID := ""
+	for _, s := range workbook.Sheets {
+		sheets = append(sheets, s.Name)
+		if relationID == "" && (sheet == "" || s.Name == sheet) {
+			sheet = s.Name
+			relationID = s.ID
+		}
+	}
+	if relationID == "" {
+		return nil, fmt.Errorf("spreadsheet: the workbook has no sheet %q", sheet)
+	}
+
+	sheetPart := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == relationID {
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPart = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPart = path.Join("xl", rel.Target)
+			}
+		}
+	}
+
+	// Workbooks without any text or formatting leave these parts out.
+	var sharedStrings xlsxSharedStrings
+	if parts["xl/sharedStrings.xml"] != nil {
+		err = readXLSXPart(parts, "xl/sharedStrings.xml", &sharedStrings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var styles xlsxStyles
+	if parts["xl/styles.xml"] != nil {
+		err = readXLSXPart(parts, "xl/styles.xml", &styles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	isDate := dateStyles(styles)
+
+	var ws xlsxSheet
+	err = readXLSXPart(parts, sheetPart, &ws)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for i, r := range ws.Rows {
+		number := r.R
+		if number == 0 {
+			number = i + 1
+		}
+		row := Row{Number: number}
+
+		for j, c := range r.Cells {
+			column := j
+			if c.R != "" {
+				column, err = columnIndex(c.R)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			var value string
+			switch c.T {
+			case "s":
+				index, err := strconv.Atoi(c.V)
+				if err != nil || index < 0 || index >= len(sharedStrings.Items) {
+					return nil, fmt.Errorf("spreadsheet: cell %s refers to a missing string", c.R)
+				}
+				value = sharedStrings.Items[index].String()
+			case "inlineStr":
+				value = c.Inline.String()
+			case "b":
+				value = map[string]string{"0": "FALSE", "1": "TRUE"}[c.V]
+			case "e":
+				// Formula errors like #N/A read as empty cells.
+			case "n", "":
+				value = c.V
+				if c.S < len(isDate) && isDate[c.S] {
+					value = formatSerialDate(c.V, workbook.Properties.Date1904)
+				}
+			default:
+				value = c.V
+			}
+
+			for len(row.Cells) <= column {
+				row.Cells = append(row.Cells, "")
+			}
+			row.Cells[column] = value
+		}
+		rows = append(rows, row)
+	}
+
+	table, err := newTable(rows)
+	if err != nil {
+		return nil, err
+	}
+	table.Sheet, table.Sheets = sheet, sheets
+	return table, nil
+}
+
+func readXLSXPart(parts map[string]*zip.File, name string, v any) error {
+	file := parts[name]
+	if file == nil {
+		return fmt.Errorf("spreadsheet: the workbook has no %s", name)
+	}
+	if file.UncompressedSize64 > maxXLSXPart {
+		return fmt.Errorf("spreadsheet: %s is too large", name)
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("spreadsheet: %w", err)
+	}
+	defer r.Close()
+
+	err = xml.NewDecoder(io.LimitReader(r, maxXLSXPart)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("spreadsheet: %s: %w", name, err)
+	}
+	return nil
+}
+
+// columnIndex returns the index of the column of a cell reference like "AB12".
+func columnIndex(ref string) (int, error) {
+	index := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return 0, fmt.Errorf("spreadsheet: invalid cell reference %q", ref)
+	}
+	return index - 1, nil
+}
+
+// dateStyles reports for each cell style whether it formats numbers as dates: one of
+// the built-in date formats, or a custom format with days or years in it.
+func dateStyles(styles xlsxStyles) []bool {
+	custom := map[int]bool{}
+	for _, format := range styles.NumFmts {
+		custom[format.ID] = isDateFormat(format.Code)
+	}
+
+	isDate := make([]bool, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		id := xf.NumFmtID
+		isDate[i] = (id >= 14 && id <= 17) || id == 22 || (id >= 27 && id <= 36) || (id >= 50 && id <= 58) || custom[id]
+	}
+	return isDate
+}
+
+func isDateFormat(code string) bool {
+	var b strings.Builder
+	quoted, bracketed := false, false
+	for _, r := range code {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '[':
+			bracketed = true
+		case r == ']':
+			bracketed = false
+		case bracketed:
+		default:
+			b.WriteRune(r)
+		}
+	}
+	plain := strings.ToLower(b.String())
+	return strings.ContainsAny(plain, "dy")
+}
+
+// formatSerialDate turns the serial number of a date cell into YYYY-MM-DD. Serial
+// numbers count days since the end of 1899, or since 1904 in workbooks made by old
+// Mac versions of Excel.
+func formatSerialDate(value string, date1904 bool) string {
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 {
+		return value
+	}
+
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return epoch.AddDate(0, 0, int(math.Floor(serial))).Format("2006-01-02")
+}
@@ -0,0 +1,220 @@
+// Package timeline lays out when a program announced its decisions in past admission
+// cycles, and forecasts when it will in the current one.
+//
+// A cycle runs from August to July and is named after the year it ends in. Dates are
+// compared across cycles by their offset from the start of their cycle.
+package timeline
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// ForecastCycles is the number of most recent past cycles a forecast is based on.
+	ForecastCycles = 5
+
+	dateLayout = "2006-01-02"
+)
+
+// A Decision is the announcement of an admission or rejection.
+type Decision struct {
+	Date     time.Time
+	Admitted bool
+}
+
+// A Cycle is the timeline of the decisions of one cycle. Dates are YYYY-MM-DD.
+type Cycle struct {
+	Cycle    int    `json:"cycle"`
+	Admitted int    `json:"admitted"`
+	Rejected int    `json:"rejected"`
+	First    string `json:"first"`
+	Median   string `json:"median"`
+	Last     string `json:"last"`
+	Weeks    []Week `json:"weeks"`
+}
+
+// A Week counts the decisions announced in the week starting on Monday Start.
+type Week struct {
+	Start    string `json:"start"`
+	Admitted int    `json:"admitted"`
+	Rejected int    `json:"rejected"`
+}
+
+// A Window is a span of dates, YYYY-MM-DD.
+type Window struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// A Forecast is when decisions are expected in a cycle, from past cycles.
+type Forecast struct {
+	Cycle   int   `json:"cycle"`
+	BasedOn []int `json:"based_on"`
+
+	// FirstDecision spans the dates of the first decisions of past cycles, and
+	// ExpectedFirst is their median.
+	FirstDecision Window `json:"first_decision"`
+	ExpectedFirst string `json:"expected_first"`
+
+	// Bulk spans the middle half of past decisions, and Admissions and Rejections that
+	// of each kind, when there were any.
+	Bulk       Window  `json:"bulk"`
+	Admissions *Window `json:"admissions"`
+	Rejections *Window `json:"rejections"`
+}
+
+// CycleOf returns the cycle of a date.
+func CycleOf(t time.Time) int {
+	return t.AddDate(0, 5, 0).Year()
+}
+
+// CycleStart returns the first day of a cycle, August 1 of the year before it is
+// named after.
+func CycleStart(cycle int) time.Time {
+	return time.Date(cycle-1, time.August, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// offset returns the number of days from the start of its cycle to a date.
+func offset(t time.Time) int {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int(day.Sub(CycleStart(CycleOf(t))).Hours() / 24)
+}
+
+// dateAt returns the date the offset falls on in a cycle.
+func dateAt(cycle, offset int) string {
+	return CycleStart(cycle).AddDate(0, 0, offset).Format(dateLayout)
+}
+
+// Build groups decisions into cycles, most recent first.
+func Build(decisions []Decision) []Cycle {
+	byCycle := map[int][]Decision{}
+	for _, d := range decisions {
+		cycle := CycleOf(d.Date)
+		byCycle[cycle] = append(byCycle[cycle], d)
+	}
+
+	cycles := make([]Cycle, 0, len(byCycle))
+	for cycle, ds := range byCycle {
+		sort.SliceStable(ds, func(i, j int) bool { return ds[i].Date.Before(ds[j].Date) })
+
+		c := Cycle{
+			Cycle:  cycle,
+			First:  ds[0].Date.Format(dateLayout),
+			Median: ds[(len(ds)-1)/2].Date.Format(dateLayout),
+			Last:   ds[len(ds)-1].Date.Format(dateLayout),
+			Weeks:  []Week{},
+		}
+		for _, d := range ds {
+			if d.Admitted {
+				c.Admitted++
+			} else {
+				c.Rejected++
+			}
+
+			start := weekStart(d.Date)
+			if n := len(c.Weeks); n == 0 || c.Weeks[n-1].Start != start {
+				c.Weeks = append(c.Weeks, Week{Start: start})
+			}
+			week := &c.Weeks[len(c.Weeks)-1]
+			if d.Admitted {
+				week.Admitted++
+			} else {
+				week.Rejected++
+			}
+		}
+		cycles = append(cycles, c)
+	}
+
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i].Cycle > cycles[j].Cycle })
+	return cycles
+}
+
+// weekStart returns the Monday of the week of a date.
+func weekStart(t time.Time) string {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -daysSinceMonday).Format(dateLayout)
+}
+
+// Predict forecasts when decisions will be announced in cycle, from the decisions of
+// up to ForecastCycles cycles before it. It returns nil when there are none.
+func Predict(decisions []Decision, cycle int) *Forecast {
+	byCycle := map[int][]int{}
+	admitted, rejected := []int{}, []int{}
+	for _, d := range decisions {
+		c := CycleOf(d.Date)
+		if c >= cycle {
+			continue
+		}
+		byCycle[c] = append(byCycle[c], offset(d.Date))
+	}
+
+	var past []int
+	for c := range byCycle {
+		past = append(past, c)
+	}
+	if len(past) == 0 {
+		return nil
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(past)))
+	if len(past) > ForecastCycles {
+		past = past[:ForecastCycles]
+	}
+	included := map[int]bool{}
+	for _, c := range past {
+		included[c] = true
+	}
+
+	var all, firsts []int
+	for _, c := range past {
+		offsets := byCycle[c]
+		sort.Ints(offsets)
+		firsts = append(firsts, offsets[0])
+		all = append(all, offsets...)
+	}
+	for _, d := range decisions {
+		if !included[CycleOf(d.Date)] {
+			continue
+		}
+		if d.Admitted {
+			admitted = append(admitted, offset(d.Date))
+		} else {
+			rejected = append(rejected, offset(d.Date))
+		}
+	}
+
+	sort.Ints(firsts)
+	sort.Ints(all)
+	f := &Forecast{
+		Cycle:         cycle,
+		BasedOn:       past,
+		FirstDecision: Window{From: dateAt(cycle, firsts[0]), To: dateAt(cycle, firsts[len(firsts)-1])},
+		ExpectedFirst: dateAt(cycle, quantile(firsts, 0.5)),
+		Bulk:          middleHalf(all, cycle),
+	}
+	if len(admitted) > 0 {
+		sort.Ints(admitted)
+		w := middleHalf(admitted, cycle)
+		f.Admissions = &w
+	}
+	if len(rejected) > 0 {
+		sort.Ints(rejected)
+		w := middleHalf(rejected, cycle)
+		f.Rejections = &w
+	}
+	return f
+}
+
+func middleHalf(sorted []int, cycle int) Window {
+	return Window{From: dateAt(cycle, quantile(sorted, 0.25)), To: dateAt(cycle, quantile(sorted, 0.75))}
+}
+
+// quantile returns the q-quantile of sorted offsets, rounded to a whole day.
+func quantile(sorted []int, q float64) int {
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	value := float64(sorted[lower]) + (pos-float64(lower))*float64(sorted[upper]-sorted[lower])
+	return int(math.Round(value))
+}